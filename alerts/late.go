@@ -0,0 +1,170 @@
+// Package alerts flags the jobs planned to finish after their due date and
+// notifies them through hooks.
+package alerts
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/henvic/embroidery/schedule"
+	"github.com/henvic/embroidery/server"
+	"github.com/kisielk/sqlstruct"
+)
+
+var db = server.Instance.DB
+
+// LateJob is a job whose planned end on the schedule is past its due date
+type LateJob struct {
+	JobID        string
+	OrderID      string
+	ClientID     string
+	MachineID    string
+	Status       string
+	Priority     int
+	DueDate      string
+	PlannedEnd   string
+	DetectedTime string
+	NotifiedTime *string
+}
+
+// Hooks notified of the jobs that became late
+var Hooks []Hook
+
+// Hook for notifying late jobs
+type Hook interface {
+	Notify(ctx context.Context, j LateJob) error
+}
+
+const lateColumns = `l.job_id,j.order_id,j.client_id,s.machine_id,j.status,j.priority,
+l.due_date,l.planned_end,l.detected_time,l.notified_time`
+
+const lateJoins = ` FROM late_job l
+JOIN job j ON j.job_id = l.job_id
+JOIN schedule_slot s ON s.job_id = l.job_id`
+
+// Check the schedule for late jobs, keeping the late_job table in sync, and
+// notify the hooks of the jobs that became late
+// The schedule is recomputed first, so jobs falling behind on machines with
+// no activity and new due dates are seen. Jobs that are no longer late
+// (finished, rescheduled or with a new due date) are removed, and notified
+// again if they become late once more.
+func Check(ctx context.Context) error {
+	if err := schedule.Recompute(ctx); err != nil {
+		return errwrap.Wrapf("Error recomputing schedule: {{err}}", err)
+	}
+
+	tx, err := db().BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM late_job WHERE job_id NOT IN (
+SELECT s.job_id FROM schedule_slot s JOIN job j ON j.job_id = s.job_id
+WHERE j.due_date IS NOT NULL AND s.planned_end >= DATE_ADD(j.due_date, INTERVAL 1 DAY))`)
+
+	if err != nil {
+		return errwrap.Wrapf("Error removing jobs that aren't late: {{err}}", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO late_job (job_id, due_date, planned_end)
+SELECT s.job_id, j.due_date, s.planned_end FROM schedule_slot s JOIN job j ON j.job_id = s.job_id
+WHERE j.due_date IS NOT NULL AND s.planned_end >= DATE_ADD(j.due_date, INTERVAL 1 DAY)
+ON DUPLICATE KEY UPDATE due_date = VALUES(due_date), planned_end = VALUES(planned_end)`)
+
+	if err != nil {
+		return errwrap.Wrapf("Error flagging late jobs: {{err}}", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return notify(ctx)
+}
+
+// notify the hooks of the late jobs not notified yet
+// A job is marked as notified only if all hooks succeed, so failures are
+// retried on the next check.
+func notify(ctx context.Context) error {
+	js, err := list(ctx, " WHERE l.notified_time IS NULL")
+
+	if err != nil {
+		return err
+	}
+
+	for _, j := range js {
+		var failed bool
+
+		for _, h := range Hooks {
+			if err := h.Notify(ctx, j); err != nil {
+				fmt.Fprintf(os.Stderr, "Error notifying late job %v: %v\n", j.JobID, err)
+				failed = true
+			}
+		}
+
+		if failed {
+			continue
+		}
+
+		_, err := db().ExecContext(ctx, "UPDATE late_job SET notified_time = CURRENT_TIMESTAMP WHERE job_id = ?", j.JobID)
+
+		if err != nil {
+			return errwrap.Wrapf("Error marking late job as notified: {{err}}", err)
+		}
+	}
+
+	return nil
+}
+
+// List the late jobs, by due date
+func List(ctx context.Context) ([]LateJob, error) {
+	return list(ctx, "")
+}
+
+func list(ctx context.Context, where string) (js []LateJob, err error) {
+	rows, err := db().QueryContext(ctx, "SELECT "+lateColumns+lateJoins+where+
+		" ORDER BY l.due_date, j.priority DESC, l.planned_end")
+
+	if err != nil {
+		return nil, errwrap.Wrapf("Error querying late jobs: {{err}}", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var j LateJob
+
+		if err := sqlstruct.Scan(&j, rows); err != nil {
+			return nil, errwrap.Wrapf("Error scanning late job rows: {{err}}", err)
+		}
+
+		js = append(js, j)
+	}
+
+	return js, rows.Err()
+}
+
+// Watch the schedule for late jobs periodically, until the context is done
+// The interval must be positive.
+func Watch(ctx context.Context, interval time.Duration) {
+	var ticker = time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := Check(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "Error checking late jobs: %v\n", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Webhook posts late jobs as JSON to a URL
+type Webhook struct {
+	URL string
+}
+
+// webhookClient gives up on slow receivers so the checker isn't held up
+var webhookClient = &http.Client{
+	Timeout: 10 * time.Second,
+}
+
+type webhookPayload struct {
+	Event      string `json:"event"`
+	JobID      string `json:"job_id"`
+	OrderID    string `json:"order_id"`
+	ClientID   string `json:"client_id"`
+	MachineID  string `json:"machine_id"`
+	Status     string `json:"status"`
+	Priority   int    `json:"priority"`
+	DueDate    string `json:"due_date"`
+	PlannedEnd string `json:"planned_end"`
+}
+
+// Notify a late job
+func (w Webhook) Notify(ctx context.Context, j LateJob) error {
+	body, err := json.Marshal(webhookPayload{
+		Event:      "job.late",
+		JobID:      j.JobID,
+		OrderID:    j.OrderID,
+		ClientID:   j.ClientID,
+		MachineID:  j.MachineID,
+		Status:     j.Status,
+		Priority:   j.Priority,
+		DueDate:    j.DueDate,
+		PlannedEnd: j.PlannedEnd,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := webhookClient.Do(req.WithContext(ctx))
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Webhook responded with %v", resp.Status)
+	}
+
+	return nil
+}
@@ -3,6 +3,7 @@ package asset
 import (
 	"context"
 	"database/sql"
+	"strings"
 
 	"github.com/hashicorp/errwrap"
 	"github.com/henvic/embroidery/server"
@@ -14,42 +15,47 @@ var db = server.Instance.DB
 
 // Asset of a client or store
 type Asset struct {
-	AssetID          string `schema:"asset_id"`
-	ClientID         string `schema:"client_id"`
-	Filepath         string `schema:"filepath"`
-	Status           string `schema:"status"`
-	OriginalFilepath string `schema:"original_filepath"`
-	ReceivedDate     string `schema:"received_date"`
+	AssetID          string  `schema:"asset_id"`
+	ClientID         string  `schema:"client_id"`
+	Filepath         string  `schema:"filepath"`
+	Status           string  `schema:"status"`
+	OriginalFilepath string  `schema:"original_filepath"`
+	ReceivedDate     string  `schema:"received_date"`
+	Size             int64   `schema:"size"`
+	Hash             string  `schema:"hash"`
+	MimeType         string  `schema:"mime_type"`
+	SourceAssetID    *string `schema:"source_asset_id"`
 }
 
 // ListFilter sets the filter settings
 type ListFilter struct {
-	ClientID     string
-	ShowArchived bool
+	ClientID      string
+	SourceAssetID string
+	ShowArchived  bool
 }
 
 // List assets
 func List(ctx context.Context, f ListFilter) (assets []Asset, err error) {
-	var q = "SELECT asset_id,client_id,filepath,status,original_filepath,received_date FROM asset"
-
-	// horrible 'WHERE'...
-	if f.ClientID != "" || !f.ShowArchived {
-		q += " WHERE"
-	}
+	var q = "SELECT asset_id,client_id,filepath,status,original_filepath,received_date,size,hash,mime_type,source_asset_id FROM asset"
+	var where []string
+	var i []interface{}
 
 	if !f.ShowArchived {
-		q += " status != 'ARCHIVED'"
+		where = append(where, "status != 'ARCHIVED'")
 	}
 
-	if f.ClientID != "" && !f.ShowArchived {
-		q += " AND"
+	if f.ClientID != "" {
+		where = append(where, "client_id = ?")
+		i = append(i, f.ClientID)
 	}
 
-	var i []interface{}
+	if f.SourceAssetID != "" {
+		where = append(where, "source_asset_id = ?")
+		i = append(i, f.SourceAssetID)
+	}
 
-	if f.ClientID != "" {
-		q += " client_id = ?"
-		i = append(i, f.ClientID)
+	if len(where) != 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
 	}
 
 	q += " ORDER BY received_date DESC"
@@ -90,9 +96,13 @@ func Insert(ctx context.Context, asset Asset) (uid string, err error) {
 		client_id,
 		filepath,
 		status,
-		original_filepath
+		original_filepath,
+		size,
+		hash,
+		mime_type,
+		source_asset_id
 		)
-		VALUES (?, ?, ?, ?, ?)`
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
 	stmt, err := db().PrepareContext(ctx, query)
 
@@ -110,6 +120,10 @@ func Insert(ctx context.Context, asset Asset) (uid string, err error) {
 		asset.Filepath,
 		asset.Status,
 		asset.OriginalFilepath,
+		asset.Size,
+		asset.Hash,
+		asset.MimeType,
+		asset.SourceAssetID,
 	)
 
 	if err != nil {
@@ -122,7 +136,7 @@ func Insert(ctx context.Context, asset Asset) (uid string, err error) {
 // Update asset
 func Update(ctx context.Context, asset Asset) error {
 	stmt, err := db().PrepareContext(ctx,
-		`UPDATE asset SET filepath = ?, status = ? WHERE asset_id = ?`)
+		`UPDATE asset SET status = ? WHERE asset_id = ?`)
 
 	if err != nil {
 		return errwrap.Wrapf("Error preparing employee update query: {{err}}", err)
@@ -131,7 +145,6 @@ func Update(ctx context.Context, asset Asset) error {
 	defer stmt.Close()
 
 	_, err = stmt.ExecContext(ctx,
-		asset.Filepath,
 		asset.Status,
 		asset.AssetID,
 	)
@@ -142,7 +155,7 @@ func Update(ctx context.Context, asset Asset) error {
 // Get asset by ID
 func Get(ctx context.Context, clientID, assetID string) (Asset, error) {
 	stmt, err := db().PrepareContext(ctx,
-		`SELECT asset_id,client_id,filepath,status,original_filepath,received_date
+		`SELECT asset_id,client_id,filepath,status,original_filepath,received_date,size,hash,mime_type,source_asset_id
 FROM asset WHERE client_id = ? AND asset_id = ?`)
 
 	if err != nil {
@@ -0,0 +1,68 @@
+package asset
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/henvic/embroidery/stitch"
+	"github.com/henvic/embroidery/storage"
+)
+
+// Convert the design of an asset to another stitch format
+// The result is stored as a new asset derived from the source asset
+func Convert(ctx context.Context, source Asset, format string) (Asset, error) {
+	var p, err = ReadPattern(source)
+
+	if err != nil {
+		return Asset{}, err
+	}
+
+	var buf bytes.Buffer
+
+	if err := stitch.Write(&buf, p, format); err != nil {
+		return Asset{}, errwrap.Wrapf("Error encoding design: {{err}}", err)
+	}
+
+	var name = strings.TrimSuffix(source.OriginalFilepath, filepath.Ext(source.OriginalFilepath)) + "." + format
+	stored, err := storage.Store(&buf, name)
+
+	if err != nil {
+		return Asset{}, err
+	}
+
+	path, err := storage.Path(stored.Hash)
+
+	if err != nil {
+		return Asset{}, err
+	}
+
+	var sourceID = source.AssetID
+
+	var a = Asset{
+		ClientID:         source.ClientID,
+		Filepath:         path,
+		OriginalFilepath: name,
+		Status:           "ACTIVE",
+		Size:             stored.Size,
+		Hash:             stored.Hash,
+		MimeType:         stored.MIMEType,
+		SourceAssetID:    &sourceID,
+	}
+
+	if a.AssetID, err = Insert(ctx, a); err != nil {
+		return Asset{}, err
+	}
+
+	// the converted asset is kept even if its design can't be analyzed, as
+	// uploaded files are
+	if _, err := Analyze(ctx, a); err != nil {
+		fmt.Fprintf(os.Stderr, "Can't analyze design of asset %v: %v\n", a.AssetID, err)
+	}
+
+	return a, nil
+}
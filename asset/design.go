@@ -0,0 +1,265 @@
+package asset
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/henvic/embroidery/stitch"
+	"github.com/henvic/embroidery/storage"
+	"github.com/kisielk/sqlstruct"
+)
+
+// Design metadata extracted from the stitch file of an asset
+// Positions and lengths are in mm
+type Design struct {
+	AssetID      string
+	Format       string
+	Label        string
+	StitchCount  int
+	ColorChanges int
+	Trims        int
+	Jumps        int
+	MinX         float64
+	MinY         float64
+	MaxX         float64
+	MaxY         float64
+	ThreadLength float64
+	Threads      []Thread
+}
+
+// Thread of a color block of a design
+type Thread struct {
+	AssetID  string
+	Position int
+	Color    string
+	Name     string
+	Code     string
+}
+
+// Width of the design in mm
+func (d Design) Width() float64 {
+	return d.MaxX - d.MinX
+}
+
+// Height of the design in mm
+func (d Design) Height() float64 {
+	return d.MaxY - d.MinY
+}
+
+// ReadPattern decodes the stored stitch file of an asset
+func ReadPattern(a Asset) (*stitch.Pattern, error) {
+	var format = stitch.Format(a.OriginalFilepath)
+	f, err := storage.Open(a.Hash)
+
+	if err != nil {
+		return nil, errwrap.Wrapf("Error opening asset file: {{err}}", err)
+	}
+
+	defer f.Close()
+
+	return stitch.Read(f, format)
+}
+
+// Analyze the stitch file of an asset and save its design metadata
+// stitch.ErrUnknownFormat is returned for files that aren't designs
+func Analyze(ctx context.Context, a Asset) (Design, error) {
+	var p, err = ReadPattern(a)
+
+	if err != nil {
+		return Design{}, err
+	}
+
+	var s = p.Stats()
+
+	var d = Design{
+		AssetID:      a.AssetID,
+		Format:       p.Format,
+		Label:        p.Label,
+		StitchCount:  s.Stitches,
+		ColorChanges: s.ColorChanges,
+		Trims:        s.Trims,
+		Jumps:        s.Jumps,
+		MinX:         s.MinX,
+		MinY:         s.MinY,
+		MaxX:         s.MaxX,
+		MaxY:         s.MaxY,
+		ThreadLength: s.ThreadLength,
+	}
+
+	for i, t := range p.Threads {
+		d.Threads = append(d.Threads, Thread{
+			AssetID:  a.AssetID,
+			Position: i,
+			Color:    t.Color,
+			Name:     t.Name,
+			Code:     t.Code,
+		})
+	}
+
+	return d, SaveDesign(ctx, d)
+}
+
+// SaveDesign metadata of an asset, replacing its thread list
+func SaveDesign(ctx context.Context, d Design) error {
+	tx, err := db().BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := saveDesign(ctx, tx, d); err != nil {
+		return err
+	}
+
+	if err := saveThreads(ctx, tx, d.AssetID, d.Threads); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func saveDesign(ctx context.Context, tx *sql.Tx, d Design) error {
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO asset_design (
+		asset_id,
+		format,
+		label,
+		stitch_count,
+		color_changes,
+		trims,
+		jumps,
+		min_x,
+		min_y,
+		max_x,
+		max_y,
+		thread_length
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+		format = VALUES(format),
+		label = VALUES(label),
+		stitch_count = VALUES(stitch_count),
+		color_changes = VALUES(color_changes),
+		trims = VALUES(trims),
+		jumps = VALUES(jumps),
+		min_x = VALUES(min_x),
+		min_y = VALUES(min_y),
+		max_x = VALUES(max_x),
+		max_y = VALUES(max_y),
+		thread_length = VALUES(thread_length)`)
+
+	if err != nil {
+		return errwrap.Wrapf("Error preparing asset design insert query: {{err}}", err)
+	}
+
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx,
+		d.AssetID,
+		d.Format,
+		d.Label,
+		d.StitchCount,
+		d.ColorChanges,
+		d.Trims,
+		d.Jumps,
+		d.MinX,
+		d.MinY,
+		d.MaxX,
+		d.MaxY,
+		d.ThreadLength,
+	)
+
+	return err
+}
+
+func saveThreads(ctx context.Context, tx *sql.Tx, assetID string, threads []Thread) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM asset_thread WHERE asset_id = ?", assetID); err != nil {
+		return errwrap.Wrapf("Error deleting asset threads: {{err}}", err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx,
+		"INSERT INTO asset_thread (asset_id, position, color, name, code) VALUES (?, ?, ?, ?, ?)")
+
+	if err != nil {
+		return errwrap.Wrapf("Error preparing asset thread insert query: {{err}}", err)
+	}
+
+	defer stmt.Close()
+
+	for i, t := range threads {
+		if _, err := stmt.ExecContext(ctx, assetID, i, t.Color, t.Name, t.Code); err != nil {
+			return errwrap.Wrapf("Error inserting asset thread: {{err}}", err)
+		}
+	}
+
+	return nil
+}
+
+// ListThreads of a design, in sewing order
+func ListThreads(ctx context.Context, assetID string) (threads []Thread, err error) {
+	stmt, err := db().PrepareContext(ctx,
+		"SELECT asset_id,position,color,name,code FROM asset_thread WHERE asset_id = ? ORDER BY position")
+
+	if err != nil {
+		return nil, errwrap.Wrapf("Error preparing asset thread query: {{err}}", err)
+	}
+
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, assetID)
+
+	if err != nil {
+		return nil, errwrap.Wrapf("Error querying asset threads: {{err}}", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var t Thread
+
+		if err := sqlstruct.Scan(&t, rows); err != nil {
+			return nil, errwrap.Wrapf("Error scanning asset thread rows: {{err}}", err)
+		}
+
+		threads = append(threads, t)
+	}
+
+	return threads, rows.Err()
+}
+
+// GetDesign metadata of an asset
+// sql.ErrNoRows is returned if the asset isn't a known design
+func GetDesign(ctx context.Context, assetID string) (Design, error) {
+	stmt, err := db().PrepareContext(ctx,
+		`SELECT asset_id,format,label,stitch_count,color_changes,trims,jumps,min_x,min_y,max_x,max_y,thread_length
+FROM asset_design WHERE asset_id = ?`)
+
+	if err != nil {
+		return Design{}, errwrap.Wrapf("Error preparing asset design query: {{err}}", err)
+	}
+
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, assetID)
+
+	if err != nil {
+		return Design{}, errwrap.Wrapf("Error querying asset design: {{err}}", err)
+	}
+
+	defer rows.Close()
+
+	var d Design
+
+	if ok := rows.Next(); !ok {
+		return d, sql.ErrNoRows
+	}
+
+	if err := sqlstruct.Scan(&d, rows); err != nil {
+		return d, errwrap.Wrapf("Error scanning asset design rows: {{err}}", err)
+	}
+
+	d.Threads, err = ListThreads(ctx, assetID)
+	return d, err
+}
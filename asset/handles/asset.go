@@ -2,10 +2,14 @@ package assethandles
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
+	"mime"
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
+	"time"
 
 	schema "github.com/gorilla/Schema"
 	"github.com/gorilla/mux"
@@ -15,6 +19,8 @@ import (
 	"github.com/henvic/embroidery/handles"
 	"github.com/henvic/embroidery/server"
 	"github.com/henvic/embroidery/sitetemplate"
+	"github.com/henvic/embroidery/stitch"
+	"github.com/henvic/embroidery/storage"
 )
 
 var router = server.Instance.Mux
@@ -24,16 +30,16 @@ func init() {
 	router().Handle("/clients/{client_id}/assets", handles.AuthenticatedHandler(assetsHandler))
 	router().Handle("/clients/{client_id}/assets/add", handles.AuthenticatedHandler(assetsAddHandler))
 	router().Handle("/clients/{client_id}/assets/{asset_id}", handles.AuthenticatedHandler(assetsEditHandler))
+	router().Handle("/clients/{client_id}/assets/{asset_id}/download", handles.AuthenticatedHandler(assetDownloadHandler))
+	router().Handle("/clients/{client_id}/assets/{asset_id}/convert", handles.AuthenticatedHandler(assetConvertHandler))
+	router().Handle("/clients/{client_id}/assets/{asset_id}/preview.{kind:svg|png}", handles.AuthenticatedHandler(assetPreviewHandler))
 }
 
-type assetAddForm struct {
-	Filepath         string `schema:"filepath"`
-	OriginalFilepath string `schema:"original_filepath"`
-}
+// maxUploadSize is the maximum size of an uploaded design file
+const maxUploadSize = 64 << 20
 
 type assetEditForm struct {
-	Filepath string `schema:"filepath"`
-	Status   string `schema:"status"`
+	Status string `schema:"status"`
 }
 
 func assetsFinderHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
@@ -79,7 +85,31 @@ func assetsEditHandler(w http.ResponseWriter, r *http.Request, s *sessions.Sessi
 		return
 	}
 
-	asset, err := asset.Get(r.Context(), client.ClientID, assetID)
+	a, err := asset.Get(r.Context(), client.ClientID, assetID)
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	var design *asset.Design
+
+	switch d, err := asset.GetDesign(r.Context(), a.AssetID); err {
+	case nil:
+		design = &d
+	case sql.ErrNoRows:
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	conversions, err := asset.List(r.Context(), asset.ListFilter{
+		ClientID:      client.ClientID,
+		SourceAssetID: a.AssetID,
+		ShowArchived:  true,
+	})
 
 	if err != nil {
 		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -94,8 +124,11 @@ func assetsEditHandler(w http.ResponseWriter, r *http.Request, s *sessions.Sessi
 			Section:   "assets",
 			Filenames: []string{"gui/assets/client-asset.html"},
 			Data: map[string]interface{}{
-				"Client": client,
-				"Asset":  asset,
+				"Client":       client,
+				"Asset":        a,
+				"Design":       design,
+				"Conversions":  conversions,
+				"WriteFormats": stitch.WriteFormats,
 			},
 			Request:        r,
 			ResponseWriter: w,
@@ -103,7 +136,7 @@ func assetsEditHandler(w http.ResponseWriter, r *http.Request, s *sessions.Sessi
 
 		t.Respond()
 	case http.MethodPost:
-		assetPostEditHandler(client, asset, w, r)
+		assetPostEditHandler(client, a, w, r)
 		return
 	default:
 		handles.ErrorHandler(w, r, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
@@ -149,37 +182,56 @@ func assetsAddHandler(w http.ResponseWriter, r *http.Request, s *sessions.Sessio
 }
 
 func assetPostAddHandler(client clients.Client, w http.ResponseWriter, r *http.Request) {
-	if err := r.ParseForm(); err != nil {
-		handles.ErrorHandler(w, r, "Invalid form", http.StatusBadRequest)
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+
+	if err := r.ParseMultipartForm(maxUploadSize); err != nil {
+		handles.ErrorHandler(w, r, "Invalid form: file is missing or too big", http.StatusBadRequest)
 		return
 	}
 
-	decoder := schema.NewDecoder()
-	caf := assetAddForm{}
+	file, header, err := r.FormFile("file")
 
-	if err := decoder.Decode(&caf, r.PostForm); err != nil {
-		handles.ErrorHandler(w, r, fmt.Sprintf("Error decoding request body: %v", err), http.StatusBadRequest)
+	if err != nil {
+		handles.ErrorHandler(w, r, "File can't be empty", http.StatusBadRequest)
 		return
 	}
 
-	if len(caf.OriginalFilepath) == 0 {
-		handles.ErrorHandler(w, r, "Original filepath can't be empty", http.StatusBadRequest)
+	defer file.Close()
+
+	var original = filepath.Base(header.Filename)
+
+	if original == "." || original == string(filepath.Separator) {
+		handles.ErrorHandler(w, r, "Original filename can't be empty", http.StatusBadRequest)
 		return
 	}
 
-	if len(caf.Filepath) == 0 {
-		handles.ErrorHandler(w, r, "Filepath can't be empty", http.StatusBadRequest)
+	stored, err := storage.Store(file, original)
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	p, err := storage.Path(stored.Hash)
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
 		return
 	}
 
 	c := asset.Asset{
 		ClientID:         client.ClientID,
-		Filepath:         caf.Filepath,
-		OriginalFilepath: caf.OriginalFilepath,
+		Filepath:         p,
+		OriginalFilepath: original,
 		Status:           "ACTIVE",
+		Size:             stored.Size,
+		Hash:             stored.Hash,
+		MimeType:         stored.MIMEType,
 	}
 
-	_, err := asset.Insert(context.Background(), c)
+	c.AssetID, err = asset.Insert(context.Background(), c)
 
 	if err != nil {
 		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -187,6 +239,11 @@ func assetPostAddHandler(client clients.Client, w http.ResponseWriter, r *http.R
 		return
 	}
 
+	// the file is kept even if it can't be decoded, so it can be downloaded
+	if _, err := asset.Analyze(context.Background(), c); err != nil && err != stitch.ErrUnknownFormat {
+		fmt.Fprintf(os.Stderr, "Can't analyze design of asset %v: %v\n", c.AssetID, err)
+	}
+
 	http.Redirect(w, r, fmt.Sprintf("/clients/%v/assets", url.QueryEscape(c.ClientID)), http.StatusSeeOther)
 }
 
@@ -211,12 +268,6 @@ func assetPostEditHandler(client clients.Client, a asset.Asset, w http.ResponseW
 		return
 	}
 
-	if len(caf.Filepath) == 0 {
-		handles.ErrorHandler(w, r, "Filepath can't be empty", http.StatusBadRequest)
-		return
-	}
-
-	a.Filepath = caf.Filepath
 	a.Status = caf.Status
 
 	err := asset.Update(r.Context(), a)
@@ -230,6 +281,159 @@ func assetPostEditHandler(client clients.Client, a asset.Asset, w http.ResponseW
 	http.Redirect(w, r, fmt.Sprintf("/clients/%v/assets", url.QueryEscape(client.ClientID)), http.StatusSeeOther)
 }
 
+func assetDownloadHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	vars := mux.Vars(r)
+	clientID, ok1 := vars["client_id"]
+	assetID, ok2 := vars["asset_id"]
+
+	if !ok1 || !ok2 {
+		handles.ErrorHandler(w, r, "Missing client or asset ID parameter", http.StatusBadRequest)
+		return
+	}
+
+	a, err := asset.Get(r.Context(), clientID, assetID)
+
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		handles.ErrorHandler(w, r, "Asset not found", http.StatusNotFound)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	f, err := storage.Open(a.Hash)
+
+	if err != nil {
+		handles.ErrorHandler(w, r, "File not found on storage", http.StatusNotFound)
+		fmt.Fprintf(os.Stderr, "Asset %v file not found: %v\n", a.AssetID, err)
+		return
+	}
+
+	defer f.Close()
+
+	// stored files are served for download only, never rendered inline
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": a.OriginalFilepath,
+	}))
+	w.Header().Set("Content-Type", a.MimeType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, a.OriginalFilepath, time.Time{}, f)
+}
+
+var previewTypes = map[string]string{
+	"svg": "image/svg+xml",
+	"png": "image/png",
+}
+
+func assetPreviewHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	vars := mux.Vars(r)
+	clientID, ok1 := vars["client_id"]
+	assetID, ok2 := vars["asset_id"]
+	kind := vars["kind"]
+
+	if !ok1 || !ok2 {
+		handles.ErrorHandler(w, r, "Missing client or asset ID parameter", http.StatusBadRequest)
+		return
+	}
+
+	a, err := asset.Get(r.Context(), clientID, assetID)
+
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		handles.ErrorHandler(w, r, "Asset not found", http.StatusNotFound)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	if !a.IsDesign() {
+		handles.ErrorHandler(w, r, "Asset is not an embroidery design", http.StatusNotFound)
+		return
+	}
+
+	f, err := asset.Preview(a, kind)
+
+	if err != nil {
+		handles.ErrorHandler(w, r, "Can't render preview", http.StatusNotFound)
+		fmt.Fprintf(os.Stderr, "Asset %v preview error: %v\n", a.AssetID, err)
+		return
+	}
+
+	defer f.Close()
+
+	// stored files never change, so the preview of an asset never does either
+	w.Header().Set("Content-Type", previewTypes[kind])
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	http.ServeContent(w, r, "preview."+kind, time.Time{}, f)
+}
+
+func assetConvertHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	if r.Method != http.MethodPost {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, ok1 := vars["client_id"]
+	assetID, ok2 := vars["asset_id"]
+
+	if !ok1 || !ok2 {
+		handles.ErrorHandler(w, r, "Missing client or asset ID parameter", http.StatusBadRequest)
+		return
+	}
+
+	source, err := asset.Get(r.Context(), clientID, assetID)
+
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		handles.ErrorHandler(w, r, "Asset not found", http.StatusNotFound)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	var format = r.FormValue("format")
+	var known bool
+
+	for _, f := range stitch.WriteFormats {
+		if f == format {
+			known = true
+		}
+	}
+
+	if !known {
+		handles.ErrorHandler(w, r, "Invalid stitch format", http.StatusBadRequest)
+		return
+	}
+
+	converted, err := asset.Convert(r.Context(), source, format)
+
+	switch err {
+	case nil:
+	case stitch.ErrUnknownFormat, stitch.ErrInvalidFile:
+		handles.ErrorHandler(w, r, "Asset isn't a design that can be converted", http.StatusBadRequest)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/clients/%v/assets/%v",
+		url.QueryEscape(converted.ClientID),
+		url.QueryEscape(converted.AssetID)), http.StatusSeeOther)
+}
+
 func assetsHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
 	var showArchived = (r.URL.Query().Get("showArchived") != "")
 	vars := mux.Vars(r)
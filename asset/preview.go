@@ -0,0 +1,46 @@
+package asset
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/henvic/embroidery/preview"
+	"github.com/henvic/embroidery/stitch"
+	"github.com/henvic/embroidery/storage"
+)
+
+// ThumbnailSize is the size of the PNG previews, in pixels
+const ThumbnailSize = 256
+
+// IsDesign tells if the asset is a stitch file that can be decoded
+func (a Asset) IsDesign() bool {
+	return stitch.Readable(stitch.Format(a.OriginalFilepath))
+}
+
+// Preview of the design of an asset, as "svg" or "png"
+// Previews are cached on the storage next to the design file
+func Preview(a Asset, kind string) (*os.File, error) {
+	var render func(w io.Writer, p *stitch.Pattern) error
+
+	switch kind {
+	case "svg":
+		render = preview.SVG
+	case "png":
+		render = func(w io.Writer, p *stitch.Pattern) error {
+			return preview.PNG(w, p, ThumbnailSize)
+		}
+	default:
+		return nil, fmt.Errorf("Unknown preview kind %v", kind)
+	}
+
+	return storage.Cached(a.Hash, ".preview."+kind, func(w io.Writer) error {
+		var p, err = ReadPattern(a)
+
+		if err != nil {
+			return err
+		}
+
+		return render(w, p)
+	})
+}
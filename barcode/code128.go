@@ -0,0 +1,135 @@
+// Package barcode encodes Code 128 barcodes for the labels of the shop floor
+// and Interleaved 2 of 5 (ITF) barcodes for boletos.
+package barcode
+
+import (
+	"fmt"
+)
+
+// InvalidCharacterError is used when a text has characters Code 128 can't
+// encode (only printable ASCII is supported)
+type InvalidCharacterError struct {
+	Char rune
+}
+
+func (i InvalidCharacterError) Error() string {
+	return fmt.Sprintf("Character %q can't be encoded on a barcode", i.Char)
+}
+
+// patterns of the Code 128 symbols: the widths of the alternating bars and
+// spaces, in modules, starting with a bar
+var patterns = [...]string{
+	"212222", "222122", "222221", "121223", "121322", "131222", "122213", "122312", "132212", "221213",
+	"221312", "231212", "112232", "122132", "122231", "113222", "123122", "123221", "223211", "221132",
+	"221231", "213212", "223112", "312131", "311222", "321122", "321221", "312212", "322112", "322211",
+	"212123", "212321", "232121", "111323", "131123", "131321", "112313", "132113", "132311", "211313",
+	"231113", "231311", "112133", "112331", "132131", "113123", "113321", "133121", "313121", "211331",
+	"231131", "213113", "213311", "213131", "311123", "311321", "331121", "312113", "312311", "332111",
+	"314111", "221411", "431111", "111224", "111422", "121124", "121421", "141122", "141221", "112214",
+	"112412", "122114", "122411", "142112", "142211", "241211", "221114", "413111", "241112", "134111",
+	"111242", "121142", "121241", "114212", "124112", "124211", "411212", "421112", "421211", "212141",
+	"214121", "412121", "111143", "111341", "131141", "114113", "114311", "411113", "411311", "113141",
+	"114131", "311141", "411131", "211412", "211214", "211232",
+}
+
+// stop pattern, with the final bar
+const stop = "2331112"
+
+// symbols switching and starting the code sets
+const (
+	codeC  = 99
+	codeB  = 100
+	startB = 104
+	startC = 105
+)
+
+// QuietZone on each side of a barcode, in modules
+const QuietZone = 10
+
+// Code128 encodes a text as the widths of the alternating bars and spaces
+// of its barcode, starting and ending with a bar
+// Runs of digits are encoded in pairs (code set C) to keep the barcode short.
+func Code128(text string) ([]int, error) {
+	for _, r := range text {
+		if r < 32 || r > 126 {
+			return nil, InvalidCharacterError{r}
+		}
+	}
+
+	var symbols []int
+	var inC = digitRun(text, 0) >= 4 && digitRun(text, 0)%2 == 0 || digitRun(text, 0) == len(text) && len(text) >= 2
+
+	if inC {
+		symbols = append(symbols, startC)
+	} else {
+		symbols = append(symbols, startB)
+	}
+
+	for i := 0; i < len(text); {
+		var run = digitRun(text, i)
+
+		switch {
+		case inC && run >= 2:
+			symbols = append(symbols, int(text[i]-'0')*10+int(text[i+1]-'0'))
+			i += 2
+			continue
+		case inC:
+			symbols = append(symbols, codeB)
+			inC = false
+		case run >= 6 || (run >= 4 && i+run == len(text)):
+			// an odd digit is left on code set B so the run is split in pairs
+			if run%2 == 1 {
+				symbols = append(symbols, int(text[i])-32)
+				i++
+			}
+
+			symbols = append(symbols, codeC)
+			inC = true
+			continue
+		}
+
+		symbols = append(symbols, int(text[i])-32)
+		i++
+	}
+
+	var checksum = symbols[0]
+
+	for i, s := range symbols[1:] {
+		checksum += (i + 1) * s
+	}
+
+	symbols = append(symbols, checksum%103)
+
+	var widths []int
+
+	for _, s := range symbols {
+		widths = appendPattern(widths, patterns[s])
+	}
+
+	return appendPattern(widths, stop), nil
+}
+
+func digitRun(text string, from int) (n int) {
+	for i := from; i < len(text) && text[i] >= '0' && text[i] <= '9'; i++ {
+		n++
+	}
+
+	return n
+}
+
+func appendPattern(widths []int, pattern string) []int {
+	for _, c := range pattern {
+		widths = append(widths, int(c-'0'))
+	}
+
+	return widths
+}
+
+// Modules of a barcode: the sum of its widths
+func Modules(widths []int) (n int) {
+	for _, w := range widths {
+		n += w
+	}
+
+	return n
+}
@@ -0,0 +1,50 @@
+package barcode
+
+import "errors"
+
+// ErrOddDigits is used when encoding an odd number of digits as ITF
+var ErrOddDigits = errors.New("ITF encodes an even number of digits")
+
+// itfPatterns of the digits: n for narrow and w for wide elements
+var itfPatterns = [...]string{
+	"nnwwn", "wnnnw", "nwnnw", "wwnnn", "nnwnw", "wnwnn", "nwwnn", "nnnww", "wnnwn", "nwnwn",
+}
+
+// ITFWide is the width of the wide elements of ITF barcodes, in modules
+const ITFWide = 3
+
+// ITF encodes digits as Interleaved 2 of 5, used on the barcode of boletos,
+// as the widths of the alternating bars and spaces (see Code128)
+// Digits are encoded in pairs: the first one on the bars and the second one
+// on the spaces between them.
+func ITF(digits string) ([]int, error) {
+	if len(digits)%2 != 0 {
+		return nil, ErrOddDigits
+	}
+
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return nil, InvalidCharacterError{r}
+		}
+	}
+
+	var widths = []int{1, 1, 1, 1}
+
+	for i := 0; i < len(digits); i += 2 {
+		var bars, spaces = itfPatterns[digits[i]-'0'], itfPatterns[digits[i+1]-'0']
+
+		for j := 0; j < 5; j++ {
+			widths = append(widths, itfWidth(bars[j]), itfWidth(spaces[j]))
+		}
+	}
+
+	return append(widths, ITFWide, 1, 1), nil
+}
+
+func itfWidth(c byte) int {
+	if c == 'w' {
+		return ITFWide
+	}
+
+	return 1
+}
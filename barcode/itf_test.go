@@ -0,0 +1,77 @@
+package barcode
+
+import (
+	"reflect"
+	"testing"
+)
+
+var itfCases = []struct {
+	digits string
+	want   []int
+	err    error
+}{
+	{
+		"",
+		[]int{1, 1, 1, 1, 3, 1, 1},
+		nil,
+	},
+	{
+		// 1 (wnnnw) on the bars and 2 (nwnnw) on the spaces
+		"12",
+		[]int{1, 1, 1, 1, 3, 1, 1, 3, 1, 1, 1, 1, 3, 3, 3, 1, 1},
+		nil,
+	},
+	{
+		// 0 (nnwwn) on the bars and 9 (nwnwn) on the spaces, then 5 (wnwnn)
+		// on the bars and 5 on the spaces
+		"0955",
+		[]int{1, 1, 1, 1,
+			1, 1, 1, 3, 3, 1, 3, 3, 1, 1,
+			3, 3, 1, 1, 3, 3, 1, 1, 1, 1,
+			3, 1, 1},
+		nil,
+	},
+	{"123", nil, ErrOddDigits},
+	{"12a4", nil, InvalidCharacterError{'a'}},
+}
+
+func TestITF(t *testing.T) {
+	for _, c := range itfCases {
+		got, err := ITF(c.digits)
+
+		if err != c.err {
+			t.Errorf("Expected error for %q to be %v, got %v instead", c.digits, c.err, err)
+		}
+
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Expected widths of %q to be %v, got %v instead", c.digits, c.want, got)
+		}
+	}
+}
+
+func TestITFBoletoWidth(t *testing.T) {
+	// each pair of digits has 4 wide and 6 narrow elements
+	var barcode = "00193373700000001000500940144816060680935031"
+	var want = 4 + 22*(4*ITFWide+6) + ITFWide + 2
+
+	widths, err := ITF(barcode)
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v instead", err)
+	}
+
+	var modules int
+
+	for _, w := range widths {
+		modules += w
+	}
+
+	if modules != want {
+		t.Errorf("Expected barcode to have %v modules, got %v instead", want, modules)
+	}
+
+	// bars and spaces alternate, starting and ending with a bar
+	if len(widths)%2 != 1 {
+		t.Errorf("Expected an odd number of elements, got %v instead", len(widths))
+	}
+}
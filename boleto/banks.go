@@ -0,0 +1,115 @@
+package boleto
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ErrUnsupportedBank is used when the configured bank has no layout
+var ErrUnsupportedBank = errors.New("Boletos aren't supported for the bank")
+
+// ErrInvalidSettings is used when the agreement, agency, account or wallet
+// don't fit on the layout of the bank
+var ErrInvalidSettings = errors.New("Invalid boleto settings for the bank")
+
+// layout of the boletos of a bank
+// digit is the check digit of the bank code printed on the boletos.
+// ourNumber is the "nosso número" of a boleto from its sequence, as stored
+// and read from return files; display adds the check digits printed on it.
+// The positions of the nosso número on the CNAB 400 detail records and on
+// the CNAB 240 segment T records are 1-based and inclusive.
+type layout struct {
+	name      string
+	digit     string
+	ourNumber func(s Settings, sequence int64) (string, error)
+	display   func(s Settings, ourNumber string) string
+	freeField func(s Settings, ourNumber string) (string, error)
+	cnab400   [2]int
+	cnab240   [2]int
+}
+
+var layouts = map[string]layout{
+	// Banco do Brasil, agreements (convênios) of 7 digits
+	"001": {
+		name:  "Banco do Brasil",
+		digit: "9",
+		ourNumber: func(s Settings, sequence int64) (string, error) {
+			if len(s.Agreement) != 7 || !digits(s.Agreement) || sequence > 9999999999 {
+				return "", ErrInvalidSettings
+			}
+
+			return fmt.Sprintf("%v%010d", s.Agreement, sequence), nil
+		},
+		display: func(s Settings, ourNumber string) string {
+			return ourNumber
+		},
+		freeField: func(s Settings, ourNumber string) (string, error) {
+			if len(s.Wallet) != 2 || !digits(s.Wallet) {
+				return "", ErrInvalidSettings
+			}
+
+			return "000000" + ourNumber + s.Wallet, nil
+		},
+		cnab400: [2]int{64, 80},
+		cnab240: [2]int{38, 54},
+	},
+	// Bradesco
+	"237": {
+		name:  "Bradesco",
+		digit: "2",
+		ourNumber: func(s Settings, sequence int64) (string, error) {
+			if sequence > 99999999999 {
+				return "", ErrInvalidSettings
+			}
+
+			return fmt.Sprintf("%011d", sequence), nil
+		},
+		display: func(s Settings, ourNumber string) string {
+			return s.Wallet + "/" + ourNumber + "-" + bradescoDigit(s.Wallet+ourNumber)
+		},
+		freeField: func(s Settings, ourNumber string) (string, error) {
+			var agency, account = pad(s.Agency, 4), pad(s.Account, 7)
+
+			if len(agency) != 4 || len(account) != 7 || len(s.Wallet) != 2 || !digits(agency+account+s.Wallet) {
+				return "", ErrInvalidSettings
+			}
+
+			return agency + s.Wallet + ourNumber + account + "0", nil
+		},
+		cnab400: [2]int{71, 81},
+		cnab240: [2]int{41, 51},
+	},
+}
+
+// bradescoDigit of the nosso número with the wallet: mod 11 with weights 2
+// to 7, where 1 is P and 0 is 0
+func bradescoDigit(digits string) string {
+	var sum, weight = 0, 2
+
+	for i := len(digits) - 1; i >= 0; i-- {
+		sum += int(digits[i]-'0') * weight
+
+		if weight++; weight > 7 {
+			weight = 2
+		}
+	}
+
+	switch r := sum % 11; r {
+	case 0:
+		return "0"
+	case 1:
+		return "P"
+	default:
+		return strconv.Itoa(11 - r)
+	}
+}
+
+// pad digits with zeros on the left
+func pad(s string, size int) string {
+	for len(s) < size {
+		s = "0" + s
+	}
+
+	return s
+}
@@ -0,0 +1,355 @@
+// Package boleto issues boletos bancários for the outstanding balance of
+// orders and settles them from the return files of the bank.
+//
+// The barcode and the digitable line follow the FEBRABAN rules, with the
+// free field laid out by the bank receiving the payments. Return files are
+// read on the CNAB 240 and CNAB 400 formats.
+package boleto
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/henvic/embroidery/payment"
+	"github.com/henvic/embroidery/server"
+	"github.com/kisielk/sqlstruct"
+)
+
+var db = server.Instance.DB
+
+// Settings of the bank account receiving the payments
+// Boletos are disabled while the bank code is empty. Agreement is the
+// agreement (convênio) with the bank and Wallet the carteira of the
+// boletos. DueDays is used when issuing boletos without a due date.
+type Settings struct {
+	BankCode     string
+	Agency       string
+	Account      string
+	Wallet       string
+	Agreement    string
+	Beneficiary  string
+	Document     string
+	DueDays      int
+	Instructions string
+}
+
+// Config of boletos, set on startup
+var Config Settings
+
+// Enabled tells if boletos are configured
+func Enabled() bool {
+	return Config.BankCode != ""
+}
+
+// Boleto issued for an order
+// The account of the settings it was issued under is kept with it, so it is
+// still printed as on its barcode if the settings change. Dates are on the
+// YYYY-MM-DD format. The paid fields are set when the boleto is settled on a
+// return file, recording a payment on the order.
+type Boleto struct {
+	BoletoID      int64
+	OrderID       string
+	ClientID      string
+	BankCode      string
+	Agency        string
+	Account       string
+	Wallet        string
+	Agreement     string
+	OurNumber     string
+	Amount        int64
+	DueDate       string
+	Barcode       string
+	DigitableLine string
+	Status        string
+	PaidAmount    *int64
+	PaidDate      *string
+	PaymentID     *string
+	CreatedTime   string
+}
+
+// BankName of the bank of the boleto
+func (b Boleto) BankName() string {
+	return layouts[b.BankCode].name
+}
+
+// BankCodeDisplay is the bank code with its check digit, as printed on the
+// boleto
+func (b Boleto) BankCodeDisplay() string {
+	if l, ok := layouts[b.BankCode]; ok {
+		return b.BankCode + "-" + l.digit
+	}
+
+	return b.BankCode
+}
+
+// OurNumberDisplay is the nosso número as printed on the boleto
+func (b Boleto) OurNumberDisplay() string {
+	if l, ok := layouts[b.BankCode]; ok {
+		return l.display(b.settings(), b.OurNumber)
+	}
+
+	return b.OurNumber
+}
+
+// settings the boleto was issued under
+func (b Boleto) settings() Settings {
+	return Settings{
+		BankCode:  b.BankCode,
+		Agency:    b.Agency,
+		Account:   b.Account,
+		Wallet:    b.Wallet,
+		Agreement: b.Agreement,
+	}
+}
+
+var (
+	// ErrNotConfigured is used when boletos are used without a bank
+	ErrNotConfigured = errors.New("Boletos aren't configured")
+
+	// ErrOrderCanceled is used when issuing boletos for canceled orders
+	ErrOrderCanceled = errors.New("Boletos can't be issued for canceled orders")
+
+	// ErrInvalidAmount is used for boletos that aren't positive or are more
+	// than the outstanding balance of the order not yet on open boletos
+	ErrInvalidAmount = errors.New("The boleto amount must be positive and up to the outstanding balance of the order")
+
+	// ErrInvalidDueDate is used for due dates in the past
+	ErrInvalidDueDate = errors.New("The due date of the boleto can't be in the past")
+
+	// ErrNotOpen is used when canceling boletos that were already paid or
+	// canceled
+	ErrNotOpen = errors.New("The boleto isn't open")
+)
+
+const columns = "boleto_id,order_id,client_id,bank_code,agency,account,wallet,agreement,our_number,amount,due_date,barcode,digitable_line," +
+	"status,paid_amount,paid_date,payment_id,created_time"
+
+// ListFilter for boletos
+type ListFilter struct {
+	OrderID string
+	Status  string
+}
+
+// List boletos
+func List(ctx context.Context, f ListFilter) (bs []Boleto, err error) {
+	var q = "SELECT " + columns + " FROM boleto"
+	var where []string
+	var args []interface{}
+
+	if f.OrderID != "" {
+		where = append(where, "order_id = ?")
+		args = append(args, f.OrderID)
+	}
+
+	if f.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, f.Status)
+	}
+
+	if len(where) != 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
+	}
+
+	rows, err := db().QueryContext(ctx, q+" ORDER BY created_time DESC, boleto_id DESC", args...)
+
+	if err != nil {
+		return nil, errwrap.Wrapf("Error querying boletos: {{err}}", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var b Boleto
+
+		if err := sqlstruct.Scan(&b, rows); err != nil {
+			return nil, errwrap.Wrapf("Error scanning boleto rows: {{err}}", err)
+		}
+
+		bs = append(bs, b)
+	}
+
+	return bs, rows.Err()
+}
+
+// Get boleto by ID
+func Get(ctx context.Context, boletoID int64) (b Boleto, err error) {
+	rows, err := db().QueryContext(ctx, "SELECT "+columns+" FROM boleto WHERE boleto_id = ?", boletoID)
+
+	if err != nil {
+		return b, errwrap.Wrapf("Error querying boleto: {{err}}", err)
+	}
+
+	defer rows.Close()
+
+	if !rows.Next() {
+		return b, sql.ErrNoRows
+	}
+
+	if err := sqlstruct.Scan(&b, rows); err != nil {
+		return b, errwrap.Wrapf("Error scanning boleto rows: {{err}}", err)
+	}
+
+	return b, nil
+}
+
+// Issue a boleto for an order
+// A zero amount issues the boleto for the outstanding balance not yet on
+// open boletos and a zero due date uses the due days of the settings.
+func Issue(ctx context.Context, orderID string, amount int64, due time.Time) (b Boleto, err error) {
+	if !Enabled() {
+		return b, ErrNotConfigured
+	}
+
+	l, ok := layouts[Config.BankCode]
+
+	if !ok {
+		return b, ErrUnsupportedBank
+	}
+
+	if due.IsZero() {
+		due = time.Now().AddDate(0, 0, Config.DueDays)
+	}
+
+	if due.Format("2006-01-02") < time.Now().Format("2006-01-02") {
+		return b, ErrInvalidDueDate
+	}
+
+	tx, err := db().BeginTx(ctx, nil)
+
+	if err != nil {
+		return b, err
+	}
+
+	defer tx.Rollback()
+
+	// lock the order row so concurrent requests don't issue boletos over the
+	// balance of the order
+	var clientID, status string
+	err = tx.QueryRowContext(ctx, "SELECT client_id, status FROM `order` WHERE order_id = ? FOR UPDATE", orderID).Scan(&clientID, &status)
+
+	if err == sql.ErrNoRows {
+		return b, err
+	}
+
+	if err != nil {
+		return b, errwrap.Wrapf("Error locking order: {{err}}", err)
+	}
+
+	if status == "CANCELED" {
+		return b, ErrOrderCanceled
+	}
+
+	balance, err := payment.GetBalanceTx(ctx, tx, orderID)
+
+	if err != nil {
+		return b, err
+	}
+
+	var open int64
+	err = tx.QueryRowContext(ctx,
+		"SELECT IFNULL(SUM(amount), 0) FROM boleto WHERE order_id = ? AND status = 'OPEN'", orderID).Scan(&open)
+
+	if err != nil {
+		return b, errwrap.Wrapf("Error querying open boletos: {{err}}", err)
+	}
+
+	var available = balance.Outstanding() - open
+
+	if amount == 0 {
+		amount = available
+	}
+
+	if amount <= 0 || amount > available {
+		return b, ErrInvalidAmount
+	}
+
+	b = Boleto{
+		OrderID:   orderID,
+		ClientID:  clientID,
+		BankCode:  Config.BankCode,
+		Agency:    Config.Agency,
+		Account:   Config.Account,
+		Wallet:    Config.Wallet,
+		Agreement: Config.Agreement,
+		Amount:    amount,
+		DueDate:   due.Format("2006-01-02"),
+		Status:    "OPEN",
+	}
+
+	// the nosso número comes from the sequence of the boleto
+	res, err := tx.ExecContext(ctx, `INSERT INTO boleto (order_id, client_id, bank_code, agency, account, wallet, agreement, amount, due_date)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		b.OrderID, b.ClientID, b.BankCode, b.Agency, b.Account, b.Wallet, b.Agreement, b.Amount, b.DueDate)
+
+	if err != nil {
+		return b, errwrap.Wrapf("Error inserting boleto: {{err}}", err)
+	}
+
+	if b.BoletoID, err = res.LastInsertId(); err != nil {
+		return b, errwrap.Wrapf("Error getting boleto ID: {{err}}", err)
+	}
+
+	if b.OurNumber, err = l.ourNumber(b.settings(), b.BoletoID); err != nil {
+		return b, err
+	}
+
+	freeField, err := l.freeField(b.settings(), b.OurNumber)
+
+	if err != nil {
+		return b, err
+	}
+
+	if b.Barcode, err = Barcode(b.BankCode, freeField, due, b.Amount); err != nil {
+		return b, err
+	}
+
+	if b.DigitableLine, err = DigitableLine(b.Barcode); err != nil {
+		return b, err
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE boleto SET our_number = ?, barcode = ?, digitable_line = ? WHERE boleto_id = ?",
+		b.OurNumber, b.Barcode, b.DigitableLine, b.BoletoID)
+
+	if err != nil {
+		return b, errwrap.Wrapf("Error updating boleto: {{err}}", err)
+	}
+
+	return b, tx.Commit()
+}
+
+// Cancel an open boleto
+// The boleto must also be canceled (baixa) on the bank, or it might still be
+// paid and settled on a return file.
+func Cancel(ctx context.Context, boletoID int64) error {
+	res, err := db().ExecContext(ctx, "UPDATE boleto SET status = 'CANCELED' WHERE boleto_id = ? AND status = 'OPEN'", boletoID)
+
+	if err != nil {
+		return errwrap.Wrapf("Error canceling boleto: {{err}}", err)
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n != 0 {
+		return err
+	}
+
+	if _, err := Get(ctx, boletoID); err != nil {
+		return err
+	}
+
+	return ErrNotOpen
+}
+
+// GetStatusFilter for boletos
+func GetStatusFilter() map[string]string {
+	return statusFilter
+}
+
+var statusFilter = map[string]string{
+	"":         "all",
+	"open":     "open",
+	"paid":     "paid",
+	"canceled": "canceled",
+}
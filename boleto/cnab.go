@@ -0,0 +1,316 @@
+package boleto
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/henvic/embroidery/orders"
+	"github.com/henvic/embroidery/payment"
+	"github.com/kisielk/sqlstruct"
+)
+
+var (
+	// ErrInvalidReturnFile is used for files that aren't CNAB 240 or CNAB 400
+	// return files
+	ErrInvalidReturnFile = errors.New("Invalid CNAB return file")
+
+	// ErrWrongBank is used for return files of another bank
+	ErrWrongBank = errors.New("The return file is from another bank")
+)
+
+// Settlement of a boleto read from a return file
+// Amount is what was paid, in cents, and Date is on the YYYY-MM-DD format.
+type Settlement struct {
+	OurNumber string
+	Amount    int64
+	Date      string
+}
+
+// Report of an imported return file
+// Unknown settlements don't match any boleto issued on the bank and must be
+// checked by hand.
+type Report struct {
+	Paid        []Boleto
+	AlreadyPaid []Boleto
+	Unknown     []Settlement
+}
+
+// occurrences of the return files settling boletos (liquidação)
+var (
+	cnab400Settled = map[string]bool{"05": true, "06": true, "07": true, "08": true, "15": true, "17": true}
+	cnab240Settled = map[string]bool{"06": true, "17": true}
+)
+
+// Parse a CNAB 240 or CNAB 400 return file, as told by the size of its
+// lines, returning the bank code and the settlements on it
+func Parse(r io.Reader) (bank string, ss []Settlement, err error) {
+	var lines []string
+	var scanner = bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		if line := strings.TrimRight(scanner.Text(), "\r\n\x1a"); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", nil, errwrap.Wrapf("Error reading return file: {{err}}", err)
+	}
+
+	if len(lines) == 0 {
+		return "", nil, ErrInvalidReturnFile
+	}
+
+	var size = len(lines[0])
+
+	for _, line := range lines {
+		if len(line) != size {
+			return "", nil, ErrInvalidReturnFile
+		}
+	}
+
+	switch size {
+	case 400:
+		return parse400(lines)
+	case 240:
+		return parse240(lines)
+	default:
+		return "", nil, ErrInvalidReturnFile
+	}
+}
+
+// field of a record, from 1-based and inclusive positions as on the layouts
+func field(line string, from, to int) string {
+	return line[from-1 : to]
+}
+
+// parse400 reads the header (0), detail (1, or 7 for the agreements of 7
+// digits of Banco do Brasil) and trailer (9) records of a CNAB 400 file
+func parse400(lines []string) (bank string, ss []Settlement, err error) {
+	if field(lines[0], 1, 9) != "02RETORNO" {
+		return "", nil, ErrInvalidReturnFile
+	}
+
+	bank = field(lines[0], 77, 79)
+	l, ok := layouts[bank]
+
+	if !ok {
+		return bank, nil, ErrUnsupportedBank
+	}
+
+	for _, line := range lines[1:] {
+		if t := line[0]; t != '1' && t != '7' {
+			continue
+		}
+
+		if !cnab400Settled[field(line, 109, 110)] {
+			continue
+		}
+
+		var s = Settlement{
+			OurNumber: strings.TrimSpace(field(line, l.cnab400[0], l.cnab400[1])),
+		}
+
+		if s.Amount, err = strconv.ParseInt(field(line, 254, 266), 10, 64); err != nil {
+			return bank, nil, ErrInvalidReturnFile
+		}
+
+		// dates are on the DDMMYY format
+		var date = field(line, 111, 116)
+
+		if !digits(date) {
+			return bank, nil, ErrInvalidReturnFile
+		}
+
+		s.Date = fmt.Sprintf("20%v-%v-%v", date[4:6], date[2:4], date[0:2])
+		ss = append(ss, s)
+	}
+
+	return bank, ss, nil
+}
+
+// parse240 reads the segments T and U of the detail records (3) of a CNAB
+// 240 file: T has the nosso número and the occurrence, and U, right after
+// it, has the paid amount and the date of the payment
+func parse240(lines []string) (bank string, ss []Settlement, err error) {
+	if field(lines[0], 8, 8) != "0" {
+		return "", nil, ErrInvalidReturnFile
+	}
+
+	bank = field(lines[0], 1, 3)
+	l, ok := layouts[bank]
+
+	if !ok {
+		return bank, nil, ErrUnsupportedBank
+	}
+
+	for i, line := range lines {
+		if field(line, 8, 8) != "3" || field(line, 14, 14) != "T" || !cnab240Settled[field(line, 16, 17)] {
+			continue
+		}
+
+		if i+1 == len(lines) || field(lines[i+1], 8, 8) != "3" || field(lines[i+1], 14, 14) != "U" {
+			return bank, nil, ErrInvalidReturnFile
+		}
+
+		var u = lines[i+1]
+
+		var s = Settlement{
+			OurNumber: strings.TrimSpace(field(line, l.cnab240[0], l.cnab240[1])),
+		}
+
+		if s.Amount, err = strconv.ParseInt(field(u, 78, 92), 10, 64); err != nil {
+			return bank, nil, ErrInvalidReturnFile
+		}
+
+		// dates are on the DDMMYYYY format
+		var date = field(u, 138, 145)
+
+		if !digits(date) {
+			return bank, nil, ErrInvalidReturnFile
+		}
+
+		s.Date = fmt.Sprintf("%v-%v-%v", date[4:8], date[2:4], date[0:2])
+		ss = append(ss, s)
+	}
+
+	return bank, ss, nil
+}
+
+// Import a return file of the bank, settling the boletos paid
+// Each boleto is settled on its own transaction, recording a payment on its
+// order, so importing the same file again doesn't pay them twice. Canceled
+// boletos are also settled, as the money was received anyway. The orders paid
+// are synced with their payments on the transactions settling them.
+func Import(ctx context.Context, r io.Reader, employeeID string) (report Report, err error) {
+	if !Enabled() {
+		return report, ErrNotConfigured
+	}
+
+	bank, ss, err := Parse(r)
+
+	if err != nil {
+		return report, err
+	}
+
+	if bank != Config.BankCode {
+		return report, ErrWrongBank
+	}
+
+	for _, s := range ss {
+		b, paid, err := settle(ctx, bank, s, employeeID)
+
+		switch {
+		case err == sql.ErrNoRows:
+			report.Unknown = append(report.Unknown, s)
+		case err != nil:
+			return report, err
+		case paid:
+			report.Paid = append(report.Paid, b)
+		default:
+			report.AlreadyPaid = append(report.AlreadyPaid, b)
+		}
+	}
+
+	return report, nil
+}
+
+// settle a boleto, unless it was already paid
+// sql.ErrNoRows is returned for settlements of unknown boletos.
+func settle(ctx context.Context, bank string, s Settlement, employeeID string) (b Boleto, paid bool, err error) {
+	tx, err := db().BeginTx(ctx, nil)
+
+	if err != nil {
+		return b, false, err
+	}
+
+	defer tx.Rollback()
+
+	// the order is locked before the boleto, as when issuing boletos, so
+	// settling and issuing for the same order don't deadlock
+	var orderID string
+	err = tx.QueryRowContext(ctx, "SELECT order_id FROM boleto WHERE bank_code = ? AND our_number = ?",
+		bank, s.OurNumber).Scan(&orderID)
+
+	if err == sql.ErrNoRows {
+		return b, false, err
+	}
+
+	if err != nil {
+		return b, false, errwrap.Wrapf("Error querying boleto: {{err}}", err)
+	}
+
+	err = tx.QueryRowContext(ctx, "SELECT order_id FROM `order` WHERE order_id = ? FOR UPDATE", orderID).Scan(&orderID)
+
+	if err != nil {
+		return b, false, errwrap.Wrapf("Error locking order: {{err}}", err)
+	}
+
+	rows, err := tx.QueryContext(ctx,
+		"SELECT "+columns+" FROM boleto WHERE bank_code = ? AND our_number = ? FOR UPDATE", bank, s.OurNumber)
+
+	if err != nil {
+		return b, false, errwrap.Wrapf("Error querying boleto: {{err}}", err)
+	}
+
+	if !rows.Next() {
+		rows.Close()
+		return b, false, sql.ErrNoRows
+	}
+
+	err = sqlstruct.Scan(&b, rows)
+	rows.Close()
+
+	if err != nil {
+		return b, false, errwrap.Wrapf("Error scanning boleto rows: {{err}}", err)
+	}
+
+	if b.Status == "PAID" {
+		return b, false, nil
+	}
+
+	// some banks leave the paid amount empty when it is the amount of the
+	// boleto
+	if s.Amount == 0 {
+		s.Amount = b.Amount
+	}
+
+	paymentID, err := payment.RecordTx(ctx, tx, payment.Payment{
+		ClientID:   b.ClientID,
+		OrderID:    b.OrderID,
+		Kind:       payment.KindPayment,
+		PriceTotal: s.Amount,
+		Provider:   "BOLETO",
+		Note:       "Boleto " + b.OurNumberDisplay(),
+	}, true)
+
+	if err != nil {
+		return b, false, err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE boleto SET status = 'PAID', paid_amount = ?, paid_date = ?, payment_id = ? WHERE boleto_id = ?",
+		s.Amount, s.Date, paymentID, b.BoletoID)
+
+	if err != nil {
+		return b, false, errwrap.Wrapf("Error settling boleto: {{err}}", err)
+	}
+
+	// orders fully paid by the boletos are moved on as with other payments
+	if err := orders.SyncTx(ctx, tx, b.OrderID, employeeID); err != nil {
+		return b, false, err
+	}
+
+	b.Status = "PAID"
+	b.PaidAmount = &s.Amount
+	b.PaidDate = &s.Date
+	b.PaymentID = &paymentID
+	return b, true, tx.Commit()
+}
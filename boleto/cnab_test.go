@@ -0,0 +1,171 @@
+package boleto
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fields of a record, by their 1-based position on the layout
+type fields map[int]string
+
+// record of the given size with the fields on their positions
+func record(size int, fs fields) string {
+	var b = []byte(strings.Repeat(" ", size))
+
+	for pos, v := range fs {
+		copy(b[pos-1:], v)
+	}
+
+	return string(b)
+}
+
+func cnab400(records ...fields) string {
+	var lines []string
+
+	for _, r := range records {
+		lines = append(lines, record(400, r))
+	}
+
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+func cnab240(records ...fields) string {
+	var lines []string
+
+	for _, r := range records {
+		lines = append(lines, record(240, r))
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+var parseCases = []struct {
+	name string
+	file string
+	bank string
+	want []Settlement
+	err  error
+}{
+	{
+		"CNAB 400 of Banco do Brasil",
+		cnab400(
+			fields{1: "02RETORNO", 77: "001"},
+			fields{1: "7", 64: "12345670000000042", 109: "06", 111: "201026", 254: "0000000012345"},
+			// entries that aren't settlements are skipped
+			fields{1: "7", 64: "12345670000000043", 109: "02", 111: "201026", 254: "0000000010000"},
+			fields{1: "9"},
+		),
+		"001",
+		[]Settlement{{OurNumber: "12345670000000042", Amount: 12345, Date: "2026-10-20"}},
+		nil,
+	},
+	{
+		"CNAB 400 of Bradesco",
+		cnab400(
+			fields{1: "02RETORNO", 77: "237"},
+			fields{1: "1", 71: "00000000042", 109: "06", 111: "211026", 254: "0000000012345"},
+			fields{1: "1", 71: "00000000043", 109: "17", 111: "221026", 254: "0000000000990"},
+			fields{1: "9"},
+		),
+		"237",
+		[]Settlement{
+			{OurNumber: "00000000042", Amount: 12345, Date: "2026-10-21"},
+			{OurNumber: "00000000043", Amount: 990, Date: "2026-10-22"},
+		},
+		nil,
+	},
+	{
+		"CNAB 240 of Bradesco",
+		cnab240(
+			fields{1: "23700000"},
+			fields{1: "23700011"},
+			fields{1: "2370001300001T 06", 41: "00000000042"},
+			fields{1: "2370001300002U 06", 78: "000000000012345", 138: "21102026"},
+			// entries that aren't settlements are skipped
+			fields{1: "2370001300003T 02", 41: "00000000043"},
+			fields{1: "2370001300004U 02", 78: "000000000010000", 138: "21102026"},
+			fields{1: "23700015"},
+			fields{1: "23799999"},
+		),
+		"237",
+		[]Settlement{{OurNumber: "00000000042", Amount: 12345, Date: "2026-10-21"}},
+		nil,
+	},
+	{
+		"CNAB 240 of Banco do Brasil",
+		cnab240(
+			fields{1: "00100000"},
+			fields{1: "0010001300001T 06", 38: "12345670000000042"},
+			fields{1: "0010001300002U 06", 78: "000000000012345", 138: "20102026"},
+			fields{1: "00199999"},
+		),
+		"001",
+		[]Settlement{{OurNumber: "12345670000000042", Amount: 12345, Date: "2026-10-20"}},
+		nil,
+	},
+	{
+		"CNAB 240 segment T without U",
+		cnab240(
+			fields{1: "23700000"},
+			fields{1: "2370001300001T 06", 41: "00000000042"},
+			fields{1: "23799999"},
+		),
+		"237",
+		nil,
+		ErrInvalidReturnFile,
+	},
+	{
+		"unsupported bank",
+		cnab400(
+			fields{1: "02RETORNO", 77: "341"},
+			fields{1: "9"},
+		),
+		"341",
+		nil,
+		ErrUnsupportedBank,
+	},
+	{
+		"lines of different sizes",
+		record(400, fields{1: "02RETORNO", 77: "001"}) + "\n" + record(240, fields{1: "9"}) + "\n",
+		"",
+		nil,
+		ErrInvalidReturnFile,
+	},
+	{
+		"not a return file",
+		cnab400(
+			fields{1: "01REMESSA", 77: "001"},
+		),
+		"",
+		nil,
+		ErrInvalidReturnFile,
+	},
+	{
+		"empty",
+		"",
+		"",
+		nil,
+		ErrInvalidReturnFile,
+	},
+}
+
+func TestParse(t *testing.T) {
+	for _, c := range parseCases {
+		t.Run(c.name, func(t *testing.T) {
+			bank, ss, err := Parse(strings.NewReader(c.file))
+
+			if err != c.err {
+				t.Fatalf("Expected error to be %v, got %v instead", c.err, err)
+			}
+
+			if bank != c.bank {
+				t.Errorf("Expected bank to be %v, got %v instead", c.bank, bank)
+			}
+
+			if !reflect.DeepEqual(ss, c.want) {
+				t.Errorf("Expected settlements to be %v, got %v instead", c.want, ss)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package boleto
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidBarcode is used for barcodes that don't have 44 digits
+var ErrInvalidBarcode = errors.New("Boleto barcodes have 44 digits")
+
+// ErrAmountTooLarge is used for amounts that don't fit on the barcode
+var ErrAmountTooLarge = errors.New("Amount too large for a boleto")
+
+// factorBase is the day before the first due factor (1000 is 2000-07-03)
+var factorBase = time.Date(1997, 10, 7, 0, 0, 0, 0, time.UTC)
+
+// Factor of a due date: the days since 1997-10-07
+// The factor reached 9999 on 2025-02-21 and restarted from 1000 on the next
+// day, so it is only unique within a window of 9000 days.
+func Factor(due time.Time) int {
+	var days = int(time.Date(due.Year(), due.Month(), due.Day(), 0, 0, 0, 0, time.UTC).Sub(factorBase).Hours() / 24)
+
+	if days <= 9999 {
+		return days
+	}
+
+	return (days-1000)%9000 + 1000
+}
+
+// mod10 check digit of the fields of the digitable line
+// Digits are weighted 2 and 1 from the right and the digits of the products
+// are added.
+func mod10(digits string) int {
+	var sum, weight = 0, 2
+
+	for i := len(digits) - 1; i >= 0; i-- {
+		var p = int(digits[i]-'0') * weight
+
+		sum += p/10 + p%10
+		weight = 3 - weight
+	}
+
+	return (10 - sum%10) % 10
+}
+
+// mod11 general check digit of the barcode
+// Digits are weighted 2 to 9 from the right; 0, 10 and 11 become 1.
+func mod11(digits string) int {
+	var sum, weight = 0, 2
+
+	for i := len(digits) - 1; i >= 0; i-- {
+		sum += int(digits[i]-'0') * weight
+
+		if weight++; weight > 9 {
+			weight = 2
+		}
+	}
+
+	switch dv := 11 - sum%11; dv {
+	case 0, 10, 11:
+		return 1
+	default:
+		return dv
+	}
+}
+
+// Barcode of a boleto, with 44 digits:
+// bank (3), currency (1, 9 for reais), check digit (1), due factor (4),
+// amount in cents (10) and the free field of the bank (25)
+func Barcode(bank, freeField string, due time.Time, amount int64) (string, error) {
+	if len(bank) != 3 || len(freeField) != 25 || !digits(bank+freeField) {
+		return "", ErrInvalidBarcode
+	}
+
+	if amount < 0 || amount > 9999999999 {
+		return "", ErrAmountTooLarge
+	}
+
+	var rest = fmt.Sprintf("%04d%010d%v", Factor(due), amount, freeField)
+
+	// the check digit is calculated without itself
+	return fmt.Sprintf("%v9%d%v", bank, mod11(bank+"9"+rest), rest), nil
+}
+
+// DigitableLine of a barcode, as typed by the payer:
+// three fields with their mod10 check digits, the general check digit and
+// the due factor with the amount
+func DigitableLine(barcode string) (string, error) {
+	if len(barcode) != 44 || !digits(barcode) {
+		return "", ErrInvalidBarcode
+	}
+
+	var f1 = barcode[0:4] + barcode[19:24]
+	var f2 = barcode[24:34]
+	var f3 = barcode[34:44]
+
+	return fmt.Sprintf("%v.%v%d %v.%v%d %v.%v%d %v %v",
+		f1[:5], f1[5:], mod10(f1),
+		f2[:5], f2[5:], mod10(f2),
+		f3[:5], f3[5:], mod10(f3),
+		barcode[4:5], barcode[5:19]), nil
+}
+
+func digits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,170 @@
+package boleto
+
+import (
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+var factorCases = []struct {
+	due  time.Time
+	want int
+}{
+	{date(2000, time.July, 3), 1000},
+	{date(2010, time.November, 17), 4789},
+	{date(2025, time.February, 21), 9999},
+	{date(2025, time.February, 22), 1000},
+	{date(2026, time.October, 20), 1605},
+}
+
+func TestFactor(t *testing.T) {
+	for _, c := range factorCases {
+		if got := Factor(c.due); got != c.want {
+			t.Errorf("Expected factor of %v to be %v, got %v instead", c.due.Format("2006-01-02"), c.want, got)
+		}
+	}
+}
+
+var checkDigitCases = []struct {
+	digits string
+	mod10  int
+	mod11  int
+}{
+	{"001905009", 5, 7},
+	{"4014481606", 9, 6},
+	{"0680935031", 4, 8},
+	{"2379123409", 1, 5},
+	{"0000000000", 0, 1},
+}
+
+func TestCheckDigits(t *testing.T) {
+	for _, c := range checkDigitCases {
+		if got := mod10(c.digits); got != c.mod10 {
+			t.Errorf("Expected mod10 of %v to be %v, got %v instead", c.digits, c.mod10, got)
+		}
+
+		if got := mod11(c.digits); got != c.mod11 {
+			t.Errorf("Expected mod11 of %v to be %v, got %v instead", c.digits, c.mod11, got)
+		}
+	}
+}
+
+func TestBradescoDigit(t *testing.T) {
+	// example of the manual of Bradesco: wallet 19 and nosso número 00000000002
+	if got := bradescoDigit("1900000000002"); got != "8" {
+		t.Errorf("Expected digit to be 8, got %v instead", got)
+	}
+}
+
+var barcodeCases = []struct {
+	name      string
+	bank      string
+	freeField string
+	due       time.Time
+	amount    int64
+	barcode   string
+	line      string
+	err       error
+}{
+	{
+		"Banco do Brasil",
+		"001",
+		"0000001234567000000004218",
+		date(2026, time.October, 20),
+		12345,
+		"00195160500000123450000001234567000000004218",
+		"00190.00009 01234.567004 00000.042184 5 16050000012345",
+		nil,
+	},
+	{
+		"Bradesco",
+		"237",
+		"1234090000000004200123450",
+		date(2026, time.October, 20),
+		12345,
+		"23791160500000123451234090000000004200123450",
+		"23791.23405 90000.000001 42001.234501 1 16050000012345",
+		nil,
+	},
+	{
+		"short free field",
+		"001",
+		"000000123456700000000421",
+		date(2026, time.October, 20),
+		12345,
+		"",
+		"",
+		ErrInvalidBarcode,
+	},
+	{
+		"amount too large",
+		"001",
+		"0000001234567000000004218",
+		date(2026, time.October, 20),
+		10000000000,
+		"",
+		"",
+		ErrAmountTooLarge,
+	},
+}
+
+func TestBarcode(t *testing.T) {
+	for _, c := range barcodeCases {
+		t.Run(c.name, func(t *testing.T) {
+			barcode, err := Barcode(c.bank, c.freeField, c.due, c.amount)
+
+			if err != c.err {
+				t.Fatalf("Expected error to be %v, got %v instead", c.err, err)
+			}
+
+			if barcode != c.barcode {
+				t.Errorf("Expected barcode to be %v, got %v instead", c.barcode, barcode)
+			}
+
+			if err != nil {
+				return
+			}
+
+			line, err := DigitableLine(barcode)
+
+			if err != nil {
+				t.Fatalf("Expected no error, got %v instead", err)
+			}
+
+			if line != c.line {
+				t.Errorf("Expected digitable line to be %v, got %v instead", c.line, line)
+			}
+		})
+	}
+}
+
+var digitableLineCases = []struct {
+	barcode string
+	want    string
+	err     error
+}{
+	{
+		"00193373700000001000500940144816060680935031",
+		"00190.50095 40144.816069 06809.350314 3 37370000000100",
+		nil,
+	},
+	{"0019337370000000100050094014481606068093503", "", ErrInvalidBarcode},
+	{"0019337370000000100050094014481606068093503X", "", ErrInvalidBarcode},
+}
+
+func TestDigitableLine(t *testing.T) {
+	for _, c := range digitableLineCases {
+		got, err := DigitableLine(c.barcode)
+
+		if err != c.err {
+			t.Errorf("Expected error for %v to be %v, got %v instead", c.barcode, c.err, err)
+		}
+
+		if got != c.want {
+			t.Errorf("Expected digitable line of %v to be %v, got %v instead", c.barcode, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package boletohandles
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+	"github.com/henvic/embroidery/boleto"
+	"github.com/henvic/embroidery/handles"
+	"github.com/henvic/embroidery/server"
+	"github.com/henvic/embroidery/sitetemplate"
+	"github.com/henvic/embroidery/ticket"
+)
+
+var router = server.Instance.Mux
+
+func init() {
+	router().Handle("/orders/{order_id}/boletos", handles.AuthenticatedHandler(boletoIssueHandler))
+	router().Handle("/boletos", handles.AuthenticatedHandler(boletosHandler))
+	router().Handle("/boletos/import", handles.AuthenticatedHandler(boletoImportHandler))
+	router().Handle("/boletos/{boleto_id}/boleto.pdf", handles.AuthenticatedHandler(boletoPDFHandler))
+	router().Handle("/boletos/{boleto_id}/cancel", handles.AuthenticatedHandler(boletoCancelHandler))
+}
+
+// maxReturnFileSize is the maximum size of an uploaded CNAB return file
+const maxReturnFileSize = 8 << 20
+
+func boletosHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	var status = r.URL.Query().Get("status")
+
+	if _, ok := boleto.GetStatusFilter()[status]; !ok {
+		handles.ErrorHandler(w, r, "Boleto status doesn't exists", http.StatusBadRequest)
+		return
+	}
+
+	var f = boleto.ListFilter{
+		OrderID: r.URL.Query().Get("order_id"),
+		Status:  strings.ToUpper(status),
+	}
+
+	bs, err := boleto.List(r.Context(), f)
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	var t = sitetemplate.Template{
+		Title:     "Boletos",
+		Section:   "boletos",
+		Filenames: []string{"gui/boletos/list.html"},
+		Data: map[string]interface{}{
+			"Boletos":       bs,
+			"Filter":        f,
+			"AllStatus":     boleto.GetStatusFilter(),
+			"CurrentStatus": status,
+			"Enabled":       boleto.Enabled(),
+		},
+		Request:        r,
+		ResponseWriter: w,
+	}
+
+	t.Respond()
+}
+
+func boletoIssueHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	if r.Method != http.MethodPost {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var amount int64
+	var due time.Time
+	var err error
+
+	// an empty amount or due date is filled in when issuing the boleto
+	if v := strings.TrimSpace(r.FormValue("amount")); v != "" {
+		if amount, err = strconv.ParseInt(v, 10, 64); err != nil || amount <= 0 {
+			handles.ErrorHandler(w, r, "Invalid amount", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if v := strings.TrimSpace(r.FormValue("due_date")); v != "" {
+		if due, err = time.Parse("2006-01-02", v); err != nil {
+			handles.ErrorHandler(w, r, "Invalid due date", http.StatusBadRequest)
+			return
+		}
+	}
+
+	b, err := boleto.Issue(r.Context(), mux.Vars(r)["order_id"], amount, due)
+
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		handles.ErrorHandler(w, r, "Order not found", http.StatusNotFound)
+		return
+	case boleto.ErrInvalidAmount, boleto.ErrInvalidDueDate:
+		handles.ErrorHandler(w, r, err.Error(), http.StatusBadRequest)
+		return
+	case boleto.ErrOrderCanceled, boleto.ErrNotConfigured:
+		handles.ErrorHandler(w, r, err.Error(), http.StatusConflict)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/orders/%v", url.QueryEscape(b.OrderID)), http.StatusSeeOther)
+}
+
+func boletoCancelHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	if r.Method != http.MethodPost {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	boletoID, err := strconv.ParseInt(mux.Vars(r)["boleto_id"], 10, 64)
+
+	if err != nil {
+		handles.ErrorHandler(w, r, "Boleto not found", http.StatusNotFound)
+		return
+	}
+
+	err = boleto.Cancel(r.Context(), boletoID)
+
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		handles.ErrorHandler(w, r, "Boleto not found", http.StatusNotFound)
+		return
+	case boleto.ErrNotOpen:
+		handles.ErrorHandler(w, r, err.Error(), http.StatusConflict)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	b, err := boleto.Get(r.Context(), boletoID)
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/orders/%v", url.QueryEscape(b.OrderID)), http.StatusSeeOther)
+}
+
+func boletoPDFHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	if r.Method != http.MethodGet {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	boletoID, err := strconv.ParseInt(mux.Vars(r)["boleto_id"], 10, 64)
+
+	if err != nil {
+		handles.ErrorHandler(w, r, "Boleto not found", http.StatusNotFound)
+		return
+	}
+
+	d, err := ticket.LoadBoleto(r.Context(), boletoID)
+
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		handles.ErrorHandler(w, r, "Boleto not found", http.StatusNotFound)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	// render first so errors aren't sent as a broken document
+	var b bytes.Buffer
+
+	if err := d.Write(&b); err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"boleto-%v.pdf\"", d.Boleto.OurNumber))
+	w.Write(b.Bytes())
+}
+
+func boletoImportHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	var data = map[string]interface{}{
+		"Enabled": boleto.Enabled(),
+	}
+
+	var t = sitetemplate.Template{
+		Title:          "Importar retorno de boletos",
+		Section:        "boletos",
+		Filenames:      []string{"gui/boletos/import.html"},
+		Data:           data,
+		Request:        r,
+		ResponseWriter: w,
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		t.Respond()
+		return
+	case http.MethodPost:
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxReturnFileSize)
+
+	if err := r.ParseMultipartForm(maxReturnFileSize); err != nil {
+		handles.ErrorHandler(w, r, "Invalid form", http.StatusBadRequest)
+		return
+	}
+
+	file, _, err := r.FormFile("file")
+
+	if err != nil {
+		handles.ErrorHandler(w, r, "Missing return file", http.StatusBadRequest)
+		return
+	}
+
+	defer file.Close()
+
+	employeeID, _ := s.Values["user"].(string)
+	report, err := boleto.Import(r.Context(), file, employeeID)
+
+	switch err {
+	case nil:
+	case boleto.ErrInvalidReturnFile, boleto.ErrWrongBank, boleto.ErrUnsupportedBank:
+		handles.ErrorHandler(w, r, err.Error(), http.StatusBadRequest)
+		return
+	case boleto.ErrNotConfigured:
+		handles.ErrorHandler(w, r, err.Error(), http.StatusConflict)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	data["Report"] = report
+	t.Respond()
+}
@@ -29,15 +29,49 @@ CREATE TABLE `asset` (
   `client_id` char(36) NOT NULL DEFAULT '',
   `filepath` varchar(100) NOT NULL DEFAULT '',
   `status` enum('ACTIVE','ARCHIVED') NOT NULL DEFAULT 'ACTIVE',
-  `original_filepath` varchar(100) NOT NULL DEFAULT '',
+  `original_filepath` varchar(255) NOT NULL DEFAULT '',
   `received_date` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `size` bigint(20) NOT NULL DEFAULT '0',
+  `hash` char(64) NOT NULL DEFAULT '',
+  `mime_type` varchar(255) NOT NULL DEFAULT '',
+  `source_asset_id` char(36) DEFAULT NULL,
   PRIMARY KEY (`asset_id`),
   KEY `client_id` (`client_id`),
   KEY `filepath` (`filepath`),
   KEY `status` (`status`),
+  KEY `hash` (`hash`),
+  KEY `source_asset_id` (`source_asset_id`),
+  CONSTRAINT `asset_fk_asset_source_asset_id` FOREIGN KEY (`source_asset_id`) REFERENCES `asset` (`asset_id`),
   CONSTRAINT `asset_fk_clients_client_id` FOREIGN KEY (`client_id`) REFERENCES `clients` (`client_id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 
+CREATE TABLE `asset_design` (
+  `asset_id` char(36) NOT NULL,
+  `format` varchar(10) NOT NULL DEFAULT '',
+  `label` varchar(50) NOT NULL DEFAULT '',
+  `stitch_count` int(11) NOT NULL,
+  `color_changes` int(11) NOT NULL,
+  `trims` int(11) NOT NULL,
+  `jumps` int(11) NOT NULL,
+  `min_x` double NOT NULL,
+  `min_y` double NOT NULL,
+  `max_x` double NOT NULL,
+  `max_y` double NOT NULL,
+  `thread_length` double NOT NULL,
+  PRIMARY KEY (`asset_id`),
+  CONSTRAINT `asset_design_fk_asset_asset_id` FOREIGN KEY (`asset_id`) REFERENCES `asset` (`asset_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `asset_thread` (
+  `asset_id` char(36) NOT NULL,
+  `position` int(11) NOT NULL,
+  `color` char(7) NOT NULL DEFAULT '',
+  `name` varchar(50) NOT NULL DEFAULT '',
+  `code` varchar(20) NOT NULL DEFAULT '',
+  PRIMARY KEY (`asset_id`,`position`),
+  CONSTRAINT `asset_thread_fk_asset_design_asset_id` FOREIGN KEY (`asset_id`) REFERENCES `asset_design` (`asset_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
 CREATE TABLE `authentication` (
   `employee_id` char(36) NOT NULL,
   `email` varchar(254) NOT NULL DEFAULT '',
@@ -47,6 +81,33 @@ CREATE TABLE `authentication` (
   UNIQUE KEY `email` (`email`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 
+CREATE TABLE `boleto` (
+  `boleto_id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `order_id` char(36) NOT NULL,
+  `client_id` char(36) NOT NULL,
+  `bank_code` char(3) NOT NULL,
+  `agency` varchar(10) NOT NULL DEFAULT '',
+  `account` varchar(20) NOT NULL DEFAULT '',
+  `wallet` varchar(5) NOT NULL DEFAULT '',
+  `agreement` varchar(20) NOT NULL DEFAULT '',
+  `our_number` varchar(20) DEFAULT NULL,
+  `amount` bigint(20) NOT NULL,
+  `due_date` date NOT NULL,
+  `barcode` char(44) NOT NULL DEFAULT '',
+  `digitable_line` varchar(54) NOT NULL DEFAULT '',
+  `status` enum('OPEN','PAID','CANCELED') NOT NULL DEFAULT 'OPEN',
+  `paid_amount` bigint(20) DEFAULT NULL,
+  `paid_date` date DEFAULT NULL,
+  `payment_id` char(36) DEFAULT NULL,
+  `created_time` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`boleto_id`),
+  KEY `order_id` (`order_id`,`status`),
+  UNIQUE KEY `our_number` (`bank_code`,`our_number`),
+  CONSTRAINT `boleto_fk_clients_client_id` FOREIGN KEY (`client_id`) REFERENCES `clients` (`client_id`),
+  CONSTRAINT `boleto_fk_order_order_id` FOREIGN KEY (`order_id`) REFERENCES `order` (`order_id`),
+  CONSTRAINT `boleto_fk_payment_payment_id` FOREIGN KEY (`payment_id`) REFERENCES `payment` (`payment_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
 CREATE TABLE `clients` (
   `client_id` char(36) NOT NULL,
   `first_name` varchar(60) NOT NULL DEFAULT '',
@@ -79,26 +140,149 @@ CREATE TABLE `goods` (
   CONSTRAINT `goods_fk_jobs_job_id` FOREIGN KEY (`job_id`) REFERENCES `job` (`job_id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 
+CREATE TABLE `invoice` (
+  `invoice_id` char(36) NOT NULL,
+  `kind` enum('INVOICE','CREDIT_NOTE') NOT NULL,
+  `year` int(11) NOT NULL,
+  `number` int(11) NOT NULL,
+  `order_id` char(36) NOT NULL,
+  `client_id` char(36) NOT NULL,
+  `credit_of_invoice_id` char(36) DEFAULT NULL,
+  `client_name` varchar(255) NOT NULL DEFAULT '',
+  `client_email` varchar(255) NOT NULL DEFAULT '',
+  `address_name` varchar(255) NOT NULL DEFAULT '',
+  `address_line1` varchar(255) NOT NULL DEFAULT '',
+  `address_line2` varchar(255) NOT NULL DEFAULT '',
+  `city` varchar(255) NOT NULL DEFAULT '',
+  `state` varchar(255) NOT NULL DEFAULT '',
+  `country` varchar(255) NOT NULL DEFAULT '',
+  `zip_code` varchar(255) NOT NULL DEFAULT '',
+  `total` bigint(20) NOT NULL,
+  `reason` text NOT NULL,
+  `employee_id` char(36) NOT NULL,
+  `issued_time` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`invoice_id`),
+  UNIQUE KEY `number` (`kind`,`year`,`number`),
+  KEY `order_id` (`order_id`),
+  KEY `client_id` (`client_id`),
+  KEY `credit_of_invoice_id` (`credit_of_invoice_id`),
+  CONSTRAINT `invoice_fk_order_order_id` FOREIGN KEY (`order_id`) REFERENCES `order` (`order_id`),
+  CONSTRAINT `invoice_fk_clients_client_id` FOREIGN KEY (`client_id`) REFERENCES `clients` (`client_id`),
+  CONSTRAINT `invoice_fk_invoice_credit_of_invoice_id` FOREIGN KEY (`credit_of_invoice_id`) REFERENCES `invoice` (`invoice_id`),
+  CONSTRAINT `invoice_fk_authentication_employee_id` FOREIGN KEY (`employee_id`) REFERENCES `authentication` (`employee_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `invoice_line` (
+  `invoice_id` char(36) NOT NULL,
+  `position` int(11) NOT NULL,
+  `job_id` char(36) DEFAULT NULL,
+  `description` varchar(255) NOT NULL DEFAULT '',
+  `amount` int(11) NOT NULL,
+  `price` bigint(20) NOT NULL,
+  PRIMARY KEY (`invoice_id`,`position`),
+  KEY `job_id` (`job_id`),
+  CONSTRAINT `invoice_line_fk_invoice_invoice_id` FOREIGN KEY (`invoice_id`) REFERENCES `invoice` (`invoice_id`),
+  CONSTRAINT `invoice_line_fk_job_job_id` FOREIGN KEY (`job_id`) REFERENCES `job` (`job_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `invoice_sequence` (
+  `kind` enum('INVOICE','CREDIT_NOTE') NOT NULL,
+  `year` int(11) NOT NULL,
+  `last_number` int(11) NOT NULL,
+  PRIMARY KEY (`kind`,`year`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
 CREATE TABLE `job` (
   `job_id` char(36) NOT NULL,
   `order_id` char(36) NOT NULL DEFAULT '',
   `client_id` char(36) NOT NULL DEFAULT '',
   `asset_id` char(36) NOT NULL DEFAULT '',
-  `status` enum('CREATED','QUEUE','IN_PROGRESS','CANCELED','DONE') NOT NULL,
-  `type` enum('M1','M2') NOT NULL,
+  `status` enum('CREATED','QUEUE','IN_PROGRESS','QC','CANCELED','DONE') NOT NULL,
+  `machine_id` char(36) NOT NULL,
   `amount` int(11) NOT NULL,
   `price` bigint(20) NOT NULL,
   `start_time` datetime DEFAULT NULL,
   `end_time` datetime DEFAULT NULL,
   `complexity` bigint(20) NOT NULL,
+  `placement` varchar(255) NOT NULL DEFAULT '',
+  `estimated_piece_seconds` bigint(20) DEFAULT NULL,
+  `estimated_total_seconds` bigint(20) DEFAULT NULL,
+  `pricing_rule_set_id` char(36) DEFAULT NULL,
+  `suggested_price` bigint(20) DEFAULT NULL,
+  `due_date` date DEFAULT NULL,
+  `priority` int(11) NOT NULL DEFAULT '0',
+  `created_time` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `rework_of_job_id` char(36) DEFAULT NULL,
   PRIMARY KEY (`job_id`),
   KEY `order_id` (`order_id`),
   KEY `client_id` (`client_id`),
   KEY `asset_id` (`asset_id`),
   KEY `status` (`status`),
+  KEY `machine_id` (`machine_id`),
+  KEY `due_date` (`due_date`),
+  KEY `rework_of_job_id` (`rework_of_job_id`),
   CONSTRAINT `job_fk_asset_assets_id` FOREIGN KEY (`asset_id`) REFERENCES `asset` (`asset_id`),
   CONSTRAINT `job_fk_clients_client_id` FOREIGN KEY (`client_id`) REFERENCES `clients` (`client_id`),
-  CONSTRAINT `job_fk_order_order_id` FOREIGN KEY (`order_id`) REFERENCES `order` (`order_id`)
+  CONSTRAINT `job_fk_machine_machine_id` FOREIGN KEY (`machine_id`) REFERENCES `machine` (`machine_id`),
+  CONSTRAINT `job_fk_order_order_id` FOREIGN KEY (`order_id`) REFERENCES `order` (`order_id`),
+  CONSTRAINT `job_fk_pricing_rule_set_rule_set_id` FOREIGN KEY (`pricing_rule_set_id`) REFERENCES `pricing_rule_set` (`rule_set_id`),
+  CONSTRAINT `job_fk_job_rework_of_job_id` FOREIGN KEY (`rework_of_job_id`) REFERENCES `job` (`job_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `job_event` (
+  `job_event_id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `job_id` char(36) NOT NULL,
+  `from_status` enum('CREATED','QUEUE','IN_PROGRESS','QC','CANCELED','DONE') NOT NULL,
+  `to_status` enum('CREATED','QUEUE','IN_PROGRESS','QC','CANCELED','DONE') NOT NULL,
+  `employee_id` char(36) NOT NULL,
+  `time` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`job_event_id`),
+  KEY `job_id` (`job_id`),
+  KEY `employee_id` (`employee_id`),
+  CONSTRAINT `job_event_fk_job_job_id` FOREIGN KEY (`job_id`) REFERENCES `job` (`job_id`),
+  CONSTRAINT `job_event_fk_authentication_employee_id` FOREIGN KEY (`employee_id`) REFERENCES `authentication` (`employee_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `job_line` (
+  `job_line_id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `job_id` char(36) NOT NULL,
+  `position` int(11) NOT NULL,
+  `garment_type` varchar(100) NOT NULL DEFAULT '',
+  `size` varchar(20) NOT NULL DEFAULT '',
+  `color` varchar(50) NOT NULL DEFAULT '',
+  `quantity` int(11) NOT NULL,
+  `done` int(11) NOT NULL DEFAULT '0',
+  PRIMARY KEY (`job_line_id`),
+  KEY `job_id` (`job_id`,`position`),
+  CONSTRAINT `job_line_fk_job_job_id` FOREIGN KEY (`job_id`) REFERENCES `job` (`job_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `late_job` (
+  `job_id` char(36) NOT NULL,
+  `due_date` date NOT NULL,
+  `planned_end` datetime NOT NULL,
+  `detected_time` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `notified_time` datetime DEFAULT NULL,
+  PRIMARY KEY (`job_id`),
+  CONSTRAINT `late_job_fk_job_job_id` FOREIGN KEY (`job_id`) REFERENCES `job` (`job_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `machine` (
+  `machine_id` char(36) NOT NULL,
+  `name` varchar(255) NOT NULL DEFAULT '',
+  `brand` varchar(255) NOT NULL DEFAULT '',
+  `heads` int(11) NOT NULL DEFAULT '1',
+  `needles` int(11) NOT NULL DEFAULT '1',
+  `max_hoop_width` double NOT NULL DEFAULT '0',
+  `max_hoop_height` double NOT NULL DEFAULT '0',
+  `formats` varchar(255) NOT NULL DEFAULT '',
+  `stitches_per_minute` int(11) NOT NULL,
+  `color_change_seconds` double NOT NULL DEFAULT '0',
+  `trim_seconds` double NOT NULL DEFAULT '0',
+  `jump_seconds` double NOT NULL DEFAULT '0',
+  `active` tinyint(1) NOT NULL DEFAULT '1',
+  PRIMARY KEY (`machine_id`),
+  KEY `active` (`active`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 
 CREATE TABLE `order` (
@@ -109,10 +293,13 @@ CREATE TABLE `order` (
   `close_time` datetime DEFAULT NULL,
   `status` enum('OPEN','WAITING_FOR_PAYMENT','STAND_BY','QUEUE','IN_PROGRESS','CANCELED','DONE') NOT NULL,
   `price_total` bigint(20) NOT NULL,
+  `due_date` date DEFAULT NULL,
+  `priority` int(11) NOT NULL DEFAULT '0',
   PRIMARY KEY (`order_id`),
   KEY `client_id` (`client_id`),
   KEY `client_addres_id` (`client_address_id`),
   KEY `open_time` (`open_time`),
+  KEY `due_date` (`due_date`),
   CONSTRAINT `order_fk_address_address_id` FOREIGN KEY (`client_address_id`) REFERENCES `address` (`address_id`),
   CONSTRAINT `order_fk_clients_client_id` FOREIGN KEY (`client_id`) REFERENCES `clients` (`client_id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -121,8 +308,10 @@ CREATE TABLE `payment` (
   `payment_id` char(36) NOT NULL,
   `client_id` char(36) NOT NULL DEFAULT '',
   `order_id` char(36) NOT NULL DEFAULT '',
+  `kind` enum('PAYMENT','REFUND','ADJUSTMENT') NOT NULL DEFAULT 'PAYMENT',
   `price_total` bigint(20) NOT NULL,
-  `provider` enum('CASH_FLOW','CREDIT_CARD','DEBIT_CARD','MONEY_TRANSFER') NOT NULL,
+  `provider` enum('CASH_FLOW','CREDIT_CARD','DEBIT_CARD','MONEY_TRANSFER','PIX','BOLETO','NONE') NOT NULL,
+  `note` varchar(255) NOT NULL DEFAULT '',
   `date` datetime NOT NULL,
   PRIMARY KEY (`payment_id`),
   KEY `client_id` (`client_id`),
@@ -130,3 +319,158 @@ CREATE TABLE `payment` (
   CONSTRAINT `payment_fk_clients_client_id` FOREIGN KEY (`client_id`) REFERENCES `clients` (`client_id`),
   CONSTRAINT `payment_fk_order_order_id` FOREIGN KEY (`order_id`) REFERENCES `order` (`order_id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `personalization` (
+  `job_id` char(36) NOT NULL,
+  `height` double NOT NULL DEFAULT '10',
+  `offset_x` double NOT NULL DEFAULT '0',
+  `offset_y` double NOT NULL DEFAULT '0',
+  PRIMARY KEY (`job_id`),
+  CONSTRAINT `personalization_fk_job_job_id` FOREIGN KEY (`job_id`) REFERENCES `job` (`job_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `personalization_name` (
+  `job_id` char(36) NOT NULL,
+  `position` int(11) NOT NULL,
+  `name` varchar(100) NOT NULL,
+  `piece` varchar(255) NOT NULL DEFAULT '',
+  PRIMARY KEY (`job_id`,`position`),
+  CONSTRAINT `personalization_name_fk_personalization_job_id` FOREIGN KEY (`job_id`) REFERENCES `personalization` (`job_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `pix_charge` (
+  `txid` varchar(25) NOT NULL,
+  `order_id` char(36) NOT NULL,
+  `amount` bigint(20) NOT NULL,
+  `payload` text NOT NULL,
+  `status` enum('PENDING','CONFIRMED','CANCELED') NOT NULL DEFAULT 'PENDING',
+  `payment_id` char(36) DEFAULT NULL,
+  `created_time` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `confirmed_time` datetime DEFAULT NULL,
+  PRIMARY KEY (`txid`),
+  KEY `order_id` (`order_id`,`status`),
+  CONSTRAINT `pix_charge_fk_order_order_id` FOREIGN KEY (`order_id`) REFERENCES `order` (`order_id`),
+  CONSTRAINT `pix_charge_fk_payment_payment_id` FOREIGN KEY (`payment_id`) REFERENCES `payment` (`payment_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `pricing_rule_set` (
+  `rule_set_id` char(36) NOT NULL,
+  `name` varchar(255) NOT NULL DEFAULT '',
+  `per_thousand_stitches` bigint(20) NOT NULL DEFAULT '0',
+  `setup_fee` bigint(20) NOT NULL DEFAULT '0',
+  `per_color_surcharge` bigint(20) NOT NULL DEFAULT '0',
+  `minimum_charge` bigint(20) NOT NULL DEFAULT '0',
+  `active` tinyint(1) NOT NULL DEFAULT '1',
+  `created_time` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`rule_set_id`),
+  KEY `active` (`active`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `pricing_tier` (
+  `rule_set_id` char(36) NOT NULL,
+  `min_amount` int(11) NOT NULL,
+  `discount_percent` int(11) NOT NULL,
+  PRIMARY KEY (`rule_set_id`,`min_amount`),
+  CONSTRAINT `pricing_tier_fk_pricing_rule_set_rule_set_id` FOREIGN KEY (`rule_set_id`) REFERENCES `pricing_rule_set` (`rule_set_id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `qc_defect` (
+  `inspection_id` bigint(20) NOT NULL,
+  `category` enum('THREAD_BREAK','MISREGISTRATION','PUCKERING','WRONG_COLOR','GARMENT_DAMAGE') NOT NULL,
+  `quantity` int(11) NOT NULL,
+  PRIMARY KEY (`inspection_id`,`category`),
+  CONSTRAINT `qc_defect_fk_qc_inspection_inspection_id` FOREIGN KEY (`inspection_id`) REFERENCES `qc_inspection` (`inspection_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `qc_inspection` (
+  `inspection_id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `job_id` char(36) NOT NULL,
+  `employee_id` char(36) NOT NULL,
+  `accepted` int(11) NOT NULL,
+  `rejected` int(11) NOT NULL,
+  `notes` text NOT NULL,
+  `rework_job_id` char(36) DEFAULT NULL,
+  `time` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`inspection_id`),
+  KEY `job_id` (`job_id`),
+  KEY `employee_id` (`employee_id`),
+  KEY `time` (`time`),
+  CONSTRAINT `qc_inspection_fk_job_job_id` FOREIGN KEY (`job_id`) REFERENCES `job` (`job_id`),
+  CONSTRAINT `qc_inspection_fk_job_rework_job_id` FOREIGN KEY (`rework_job_id`) REFERENCES `job` (`job_id`),
+  CONSTRAINT `qc_inspection_fk_authentication_employee_id` FOREIGN KEY (`employee_id`) REFERENCES `authentication` (`employee_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `qc_photo` (
+  `photo_id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `inspection_id` bigint(20) NOT NULL,
+  `hash` char(64) NOT NULL,
+  `filename` varchar(255) NOT NULL,
+  `mime_type` varchar(255) NOT NULL,
+  PRIMARY KEY (`photo_id`),
+  KEY `inspection_id` (`inspection_id`),
+  CONSTRAINT `qc_photo_fk_qc_inspection_inspection_id` FOREIGN KEY (`inspection_id`) REFERENCES `qc_inspection` (`inspection_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `quote` (
+  `quote_id` char(36) NOT NULL,
+  `client_id` char(36) NOT NULL,
+  `status` enum('DRAFT','SENT','ACCEPTED','REJECTED','EXPIRED') NOT NULL DEFAULT 'DRAFT',
+  `expiry_date` date NOT NULL,
+  `notes` text NOT NULL,
+  `order_id` char(36) DEFAULT NULL,
+  `employee_id` char(36) NOT NULL,
+  `created_time` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`quote_id`),
+  KEY `client_id` (`client_id`),
+  KEY `status` (`status`),
+  KEY `order_id` (`order_id`),
+  CONSTRAINT `quote_fk_clients_client_id` FOREIGN KEY (`client_id`) REFERENCES `clients` (`client_id`),
+  CONSTRAINT `quote_fk_order_order_id` FOREIGN KEY (`order_id`) REFERENCES `order` (`order_id`),
+  CONSTRAINT `quote_fk_authentication_employee_id` FOREIGN KEY (`employee_id`) REFERENCES `authentication` (`employee_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `quote_item` (
+  `quote_item_id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `quote_id` char(36) NOT NULL,
+  `position` int(11) NOT NULL,
+  `description` varchar(255) NOT NULL DEFAULT '',
+  `asset_id` char(36) DEFAULT NULL,
+  `machine_id` char(36) DEFAULT NULL,
+  `amount` int(11) NOT NULL,
+  `placement` varchar(255) NOT NULL DEFAULT '',
+  `price` bigint(20) NOT NULL,
+  PRIMARY KEY (`quote_item_id`),
+  KEY `quote_id` (`quote_id`,`position`),
+  CONSTRAINT `quote_item_fk_quote_quote_id` FOREIGN KEY (`quote_id`) REFERENCES `quote` (`quote_id`),
+  CONSTRAINT `quote_item_fk_asset_asset_id` FOREIGN KEY (`asset_id`) REFERENCES `asset` (`asset_id`),
+  CONSTRAINT `quote_item_fk_machine_machine_id` FOREIGN KEY (`machine_id`) REFERENCES `machine` (`machine_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `schedule_slot` (
+  `job_id` char(36) NOT NULL,
+  `machine_id` char(36) NOT NULL,
+  `position` int(11) NOT NULL,
+  `batch` int(11) NOT NULL DEFAULT '0',
+  `planned_start` datetime NOT NULL,
+  `planned_end` datetime NOT NULL,
+  PRIMARY KEY (`job_id`),
+  KEY `machine_id` (`machine_id`,`position`),
+  CONSTRAINT `schedule_slot_fk_job_job_id` FOREIGN KEY (`job_id`) REFERENCES `job` (`job_id`),
+  CONSTRAINT `schedule_slot_fk_machine_machine_id` FOREIGN KEY (`machine_id`) REFERENCES `machine` (`machine_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `work_session` (
+  `work_session_id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `job_id` char(36) NOT NULL,
+  `employee_id` char(36) NOT NULL,
+  `machine_id` char(36) NOT NULL,
+  `start_time` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `end_time` datetime DEFAULT NULL,
+  `end_reason` enum('THREAD_BREAK','BOBBIN_CHANGE','NEEDLE_BREAK','MACHINE_PROBLEM','END_OF_SHIFT','OTHER','QC','DONE','CANCELED') DEFAULT NULL,
+  PRIMARY KEY (`work_session_id`),
+  KEY `job_id` (`job_id`),
+  KEY `employee_id` (`employee_id`),
+  CONSTRAINT `work_session_fk_job_job_id` FOREIGN KEY (`job_id`) REFERENCES `job` (`job_id`),
+  CONSTRAINT `work_session_fk_authentication_employee_id` FOREIGN KEY (`employee_id`) REFERENCES `authentication` (`employee_id`),
+  CONSTRAINT `work_session_fk_machine_machine_id` FOREIGN KEY (`machine_id`) REFERENCES `machine` (`machine_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
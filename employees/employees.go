@@ -5,6 +5,7 @@ import (
 
 	"database/sql"
 
+	"github.com/gorilla/sessions"
 	"github.com/hashicorp/errwrap"
 	"github.com/henvic/embroidery/server"
 	"github.com/kisielk/sqlstruct"
@@ -108,3 +109,19 @@ func Update(ctx context.Context, employee Employee) error {
 	_, err = stmt.ExecContext(ctx, employee.Email, employee.Password, employee.AccessLevel, employee.EmployeeID)
 	return err
 }
+
+// IsOwner tells if the employee has owner access
+func (e Employee) IsOwner() bool {
+	return e.AccessLevel == "OWNER"
+}
+
+// Current employee logged in on a session
+func Current(ctx context.Context, s *sessions.Session) (Employee, error) {
+	var employeeID, ok = s.Values["user"].(string)
+
+	if !ok {
+		return Employee{}, sql.ErrNoRows
+	}
+
+	return Get(ctx, employeeID)
+}
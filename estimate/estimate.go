@@ -0,0 +1,79 @@
+package estimate
+
+import (
+	"math"
+
+	"github.com/henvic/embroidery/asset"
+)
+
+// Profile of the speed of an embroidery machine
+type Profile struct {
+	// Heads sew the same design at the same time
+	Heads              int
+	StitchesPerMinute  int
+	ColorChangeSeconds float64
+	TrimSeconds        float64
+	JumpSeconds        float64
+}
+
+// weights of the design features on the complexity, in stitches
+// a color change or trim slows the job down and is a chance for errors,
+// so it counts as much as sewing a few hundred stitches
+const (
+	colorChangeWeight = 500
+	trimWeight        = 100
+	jumpWeight        = 10
+)
+
+// Estimate of the work needed for a job
+type Estimate struct {
+	Complexity   int64
+	PieceSeconds int64
+	TotalSeconds int64
+}
+
+// Complexity of a design, as a score of thousands of weighted stitches
+func Complexity(d asset.Design) int64 {
+	var weighted = d.StitchCount +
+		d.ColorChanges*colorChangeWeight +
+		d.Trims*trimWeight +
+		d.Jumps*jumpWeight
+
+	return int64(math.Ceil(float64(weighted) / 1000))
+}
+
+// PieceSeconds is the time needed to sew a design once
+func (p Profile) PieceSeconds(d asset.Design) int64 {
+	if p.StitchesPerMinute <= 0 {
+		return 0
+	}
+
+	var seconds = float64(d.StitchCount)*60/float64(p.StitchesPerMinute) +
+		float64(d.ColorChanges)*p.ColorChangeSeconds +
+		float64(d.Trims)*p.TrimSeconds +
+		float64(d.Jumps)*p.JumpSeconds
+
+	return int64(math.Ceil(seconds))
+}
+
+// Runs needed to sew amount pieces, given all heads sew at once
+func (p Profile) Runs(amount int) int64 {
+	var heads = p.Heads
+
+	if heads < 1 {
+		heads = 1
+	}
+
+	return int64((amount + heads - 1) / heads)
+}
+
+// Job estimates the work needed to sew amount pieces of a design on a machine
+func Job(d asset.Design, p Profile, amount int) Estimate {
+	var piece = p.PieceSeconds(d)
+
+	return Estimate{
+		Complexity:   Complexity(d),
+		PieceSeconds: piece,
+		TotalSeconds: piece * p.Runs(amount),
+	}
+}
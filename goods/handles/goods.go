@@ -27,6 +27,7 @@ func init() {
 	router().Handle("/goods", handles.AuthenticatedHandler(goodsHandler))
 	router().Handle("/jobs/{job_id}/add-good", handles.AuthenticatedHandler(goodAddHandler))
 	router().Handle("/goods/{good_id}", handles.AuthenticatedHandler(goodEditHandler))
+	router().Handle("/goods/{good_id}/label.pdf", handles.AuthenticatedHandler(goodLabelHandler))
 }
 
 type goodAddForm struct {
@@ -0,0 +1,51 @@
+package goodshandles
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+	"github.com/henvic/embroidery/handles"
+	"github.com/henvic/embroidery/ticket"
+)
+
+func goodLabelHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	if r.Method != http.MethodGet {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	l, err := ticket.LoadLabel(r.Context(), mux.Vars(r)["good_id"])
+
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		handles.ErrorHandler(w, r, "Good not found", http.StatusNotFound)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	var buf bytes.Buffer
+
+	if err := l.Write(&buf); err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"good-%v.pdf\"", l.Good.GoodID))
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+
+	if _, err := buf.WriteTo(w); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing label of good %v: %v\n", l.Good.GoodID, err)
+	}
+}
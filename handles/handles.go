@@ -6,6 +6,7 @@ import (
 	"os"
 
 	"github.com/gorilla/sessions"
+	"github.com/henvic/embroidery/alerts"
 	"github.com/henvic/embroidery/server"
 	"github.com/henvic/embroidery/sitetemplate"
 )
@@ -39,10 +40,25 @@ func init() {
 }
 
 func homeHandler(w http.ResponseWriter, r *http.Request) {
+	var data = map[string]interface{}{}
+
+	// late jobs are only shown to employees
+	if session, err := server.SessionStore.Get(r, server.UserSessionName); err == nil && session.Values["authenticated"] != nil {
+		lateJobs, err := alerts.List(r.Context())
+
+		if err != nil {
+			ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+			return
+		}
+
+		data["LateJobs"] = lateJobs
+	}
+
 	var t = &sitetemplate.Template{
 		Title:          "Dashboard",
 		Filenames:      []string{"gui/home/home.html"},
-		Data:           map[string]interface{}{},
+		Data:           data,
 		Request:        r,
 		ResponseWriter: w,
 	}
@@ -0,0 +1,262 @@
+package invoiceshandles
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+	"github.com/henvic/embroidery/handles"
+	"github.com/henvic/embroidery/invoices"
+	"github.com/henvic/embroidery/pix"
+	"github.com/henvic/embroidery/server"
+	"github.com/henvic/embroidery/sitetemplate"
+	"github.com/henvic/embroidery/ticket"
+)
+
+var router = server.Instance.Mux
+
+func init() {
+	router().Handle("/orders/{order_id}/invoices", handles.AuthenticatedHandler(invoiceIssueHandler))
+	router().Handle("/invoices", handles.AuthenticatedHandler(invoicesHandler))
+	router().Handle("/invoices/{invoice_id}", handles.AuthenticatedHandler(invoiceHandler))
+	router().Handle("/invoices/{invoice_id}/credit", handles.AuthenticatedHandler(invoiceCreditHandler))
+	router().Handle("/invoices/{invoice_id}/invoice.pdf", handles.AuthenticatedHandler(invoicePDFHandler))
+}
+
+func invoicesHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	var kind = r.URL.Query().Get("kind")
+
+	if _, ok := invoices.GetKindFilter()[kind]; !ok {
+		handles.ErrorHandler(w, r, "Invoice kind doesn't exists", http.StatusBadRequest)
+		return
+	}
+
+	var f = invoices.ListFilter{
+		OrderID:  r.URL.Query().Get("order_id"),
+		ClientID: r.URL.Query().Get("client_id"),
+		Kind:     strings.ToUpper(kind),
+	}
+
+	if year := r.URL.Query().Get("year"); year != "" {
+		var err error
+
+		if f.Year, err = strconv.Atoi(year); err != nil {
+			handles.ErrorHandler(w, r, "Invalid year", http.StatusBadRequest)
+			return
+		}
+	}
+
+	is, err := invoices.List(r.Context(), f)
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	var t = sitetemplate.Template{
+		Title:     "Notas fiscais",
+		Section:   "invoices",
+		Filenames: []string{"gui/invoices/list.html"},
+		Data: map[string]interface{}{
+			"Invoices":    is,
+			"Filter":      f,
+			"AllKinds":    invoices.GetKindFilter(),
+			"CurrentKind": kind,
+		},
+		Request:        r,
+		ResponseWriter: w,
+	}
+
+	t.Respond()
+}
+
+func invoiceIssueHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	if r.Method != http.MethodPost {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	employeeID, _ := s.Values["user"].(string)
+
+	invoiceID, err := invoices.Issue(r.Context(), mux.Vars(r)["order_id"], employeeID)
+
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		handles.ErrorHandler(w, r, "Order not found", http.StatusNotFound)
+		return
+	case invoices.ErrOrderCanceled, invoices.ErrNothingToInvoice, invoices.ErrAlreadyInvoiced:
+		handles.ErrorHandler(w, r, err.Error(), http.StatusConflict)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/invoices/%v", url.QueryEscape(invoiceID)), http.StatusSeeOther)
+}
+
+func invoiceHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	if r.Method != http.MethodGet {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	i, err := invoices.Get(r.Context(), mux.Vars(r)["invoice_id"])
+
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		handles.ErrorHandler(w, r, "Invoice not found", http.StatusNotFound)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	var related []invoices.Invoice
+
+	switch {
+	case i.Kind == invoices.KindInvoice:
+		related, err = invoices.List(r.Context(), invoices.ListFilter{
+			CreditOfInvoiceID: i.InvoiceID,
+		})
+	case i.CreditOfInvoiceID != nil:
+		var credited invoices.Invoice
+		credited, err = invoices.Get(r.Context(), *i.CreditOfInvoiceID)
+		related = []invoices.Invoice{credited}
+	}
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	// invoices can be paid with Pix while their order owes something
+	var charge *pix.Charge
+
+	if i.Kind == invoices.KindInvoice && i.Creditable() > 0 && pix.Enabled() {
+		c, err := pix.ChargeFor(r.Context(), i.OrderID)
+
+		switch err {
+		case nil:
+			charge = &c
+		case pix.ErrNothingToCharge:
+		default:
+			handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+			return
+		}
+	}
+
+	var title = "Nota fiscal " + i.Code()
+
+	if i.Kind == invoices.KindCreditNote {
+		title = "Nota de crédito " + i.Code()
+	}
+
+	var t = sitetemplate.Template{
+		Title:     title,
+		Section:   "invoices",
+		Filenames: []string{"gui/invoices/invoice.html"},
+		Data: map[string]interface{}{
+			"Invoice": i,
+			"Related": related,
+			"Pix":     charge,
+		},
+		Request:        r,
+		ResponseWriter: w,
+	}
+
+	t.Respond()
+}
+
+func invoiceCreditHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	if r.Method != http.MethodPost {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	amount, err := strconv.ParseInt(r.FormValue("amount"), 10, 64)
+
+	if err != nil {
+		handles.ErrorHandler(w, r, "Invalid amount", http.StatusBadRequest)
+		return
+	}
+
+	var reason = strings.TrimSpace(r.FormValue("reason"))
+
+	if len([]rune(reason)) > 1000 {
+		handles.ErrorHandler(w, r, "Reason is limited to 1000 characters", http.StatusBadRequest)
+		return
+	}
+
+	employeeID, _ := s.Values["user"].(string)
+
+	creditNoteID, err := invoices.Credit(r.Context(), mux.Vars(r)["invoice_id"], amount, reason, employeeID)
+
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		handles.ErrorHandler(w, r, "Invoice not found", http.StatusNotFound)
+		return
+	case invoices.ErrNoReason, invoices.ErrCreditAmount:
+		handles.ErrorHandler(w, r, err.Error(), http.StatusBadRequest)
+		return
+	case invoices.ErrNotInvoice:
+		handles.ErrorHandler(w, r, err.Error(), http.StatusConflict)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/invoices/%v", url.QueryEscape(creditNoteID)), http.StatusSeeOther)
+}
+
+func invoicePDFHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	if r.Method != http.MethodGet {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	d, err := ticket.LoadInvoice(r.Context(), mux.Vars(r)["invoice_id"])
+
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		handles.ErrorHandler(w, r, "Invoice not found", http.StatusNotFound)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	// render first so errors aren't sent as a broken document
+	var b bytes.Buffer
+
+	if err := d.Write(&b); err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	var filename = strings.NewReplacer("/", "-", " ", "-").Replace(d.Invoice.Code())
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"%v.pdf\"", filename))
+	w.Write(b.Bytes())
+}
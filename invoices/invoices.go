@@ -0,0 +1,546 @@
+// Package invoices issues the invoices of orders and the credit notes that
+// correct them. Invoices are numbered sequentially per year without gaps and
+// keep a snapshot of the client, the billing address and the jobs of the order
+// at issue time: issued invoices are never edited, only credited.
+package invoices
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/henvic/embroidery/server"
+	"github.com/kisielk/sqlstruct"
+	uuid "github.com/satori/go.uuid"
+)
+
+var db = server.Instance.DB
+
+// Kinds of invoice documents
+const (
+	KindInvoice    = "INVOICE"
+	KindCreditNote = "CREDIT_NOTE"
+)
+
+// Invoice or credit note of an order
+// The client and address fields are copies taken when it was issued.
+// CreditOfInvoiceID is the invoice corrected by a credit note.
+// Credited is the sum of the credit notes of an invoice, filled by Get.
+type Invoice struct {
+	InvoiceID         string
+	Kind              string
+	Year              int
+	Number            int
+	OrderID           string
+	ClientID          string
+	CreditOfInvoiceID *string
+	ClientName        string
+	ClientEmail       string
+	AddressName       string
+	AddressLine1      string
+	AddressLine2      string
+	City              string
+	State             string
+	Country           string
+	ZipCode           string
+	Total             int64
+	Reason            string
+	EmployeeID        string
+	IssuedTime        string
+
+	Lines    []Line `sql:"-"`
+	Credited int64  `sql:"-"`
+}
+
+// Line of an invoice
+// JobID is empty on lines that aren't about a single job, such as partial
+// corrections.
+type Line struct {
+	InvoiceID   string
+	Position    int
+	JobID       *string
+	Description string
+	Amount      int
+	Price       int64
+}
+
+// Code of the invoice as printed, i.e., "2026/000123" or "NC 2026/000004"
+func (i Invoice) Code() string {
+	var code = fmt.Sprintf("%d/%06d", i.Year, i.Number)
+
+	if i.Kind == KindCreditNote {
+		return "NC " + code
+	}
+
+	return code
+}
+
+// Creditable is how much of an invoice can still be credited
+func (i Invoice) Creditable() int64 {
+	if i.Kind != KindInvoice {
+		return 0
+	}
+
+	return i.Total - i.Credited
+}
+
+var (
+	// ErrOrderCanceled is used when invoicing a canceled order
+	ErrOrderCanceled = errors.New("Canceled orders can't be invoiced")
+
+	// ErrNothingToInvoice is used when invoicing an order without priced jobs
+	ErrNothingToInvoice = errors.New("The order has nothing to invoice")
+
+	// ErrAlreadyInvoiced is used when invoicing an order with an invoice that
+	// wasn't fully credited
+	ErrAlreadyInvoiced = errors.New("The order has an invoice that wasn't fully credited")
+
+	// ErrNotInvoice is used when crediting a credit note
+	ErrNotInvoice = errors.New("Only invoices can be credited")
+
+	// ErrCreditAmount is used when crediting nothing or more than what remains
+	// on an invoice
+	ErrCreditAmount = errors.New("The credit must be positive and at most what remains on the invoice")
+
+	// ErrNoReason is used when crediting an invoice without a reason
+	ErrNoReason = errors.New("Credit notes need a reason")
+)
+
+const columns = `invoice_id,kind,year,number,order_id,client_id,credit_of_invoice_id,client_name,client_email,
+address_name,address_line1,address_line2,city,state,country,zip_code,total,reason,employee_id,issued_time`
+
+// ListFilter sets the filter settings
+type ListFilter struct {
+	OrderID           string
+	ClientID          string
+	Kind              string
+	Year              int
+	CreditOfInvoiceID string
+}
+
+// List invoices and credit notes, newest first
+// Lines aren't loaded.
+func List(ctx context.Context, f ListFilter) (is []Invoice, err error) {
+	var q = "SELECT " + columns + " FROM invoice"
+	var where []string
+	var args []interface{}
+
+	if f.OrderID != "" {
+		where = append(where, "order_id = ?")
+		args = append(args, f.OrderID)
+	}
+
+	if f.ClientID != "" {
+		where = append(where, "client_id = ?")
+		args = append(args, f.ClientID)
+	}
+
+	if f.Kind != "" {
+		where = append(where, "kind = ?")
+		args = append(args, f.Kind)
+	}
+
+	if f.Year != 0 {
+		where = append(where, "year = ?")
+		args = append(args, f.Year)
+	}
+
+	if f.CreditOfInvoiceID != "" {
+		where = append(where, "credit_of_invoice_id = ?")
+		args = append(args, f.CreditOfInvoiceID)
+	}
+
+	if len(where) != 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
+	}
+
+	rows, err := db().QueryContext(ctx, q+" ORDER BY issued_time DESC, kind, number DESC", args...)
+
+	if err != nil {
+		return nil, errwrap.Wrapf("Error querying invoices: {{err}}", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var i Invoice
+
+		if err := sqlstruct.Scan(&i, rows); err != nil {
+			return nil, errwrap.Wrapf("Error scanning invoice rows: {{err}}", err)
+		}
+
+		is = append(is, i)
+	}
+
+	return is, rows.Err()
+}
+
+// Get invoice or credit note by ID, with its lines
+func Get(ctx context.Context, invoiceID string) (i Invoice, err error) {
+	rows, err := db().QueryContext(ctx, "SELECT "+columns+" FROM invoice WHERE invoice_id = ?", invoiceID)
+
+	if err != nil {
+		return i, errwrap.Wrapf("Error querying invoice: {{err}}", err)
+	}
+
+	defer rows.Close()
+
+	if !rows.Next() {
+		return i, sql.ErrNoRows
+	}
+
+	if err := sqlstruct.Scan(&i, rows); err != nil {
+		return i, errwrap.Wrapf("Error scanning invoice rows: {{err}}", err)
+	}
+
+	rows.Close()
+
+	if i.Lines, err = listLines(ctx, db(), invoiceID); err != nil {
+		return i, err
+	}
+
+	if i.Kind == KindInvoice {
+		i.Credited, err = credited(ctx, db(), invoiceID)
+	}
+
+	return i, err
+}
+
+// querier is either the database or a transaction
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func listLines(ctx context.Context, qr querier, invoiceID string) (lines []Line, err error) {
+	rows, err := qr.QueryContext(ctx, `SELECT invoice_id,position,job_id,description,amount,price
+FROM invoice_line WHERE invoice_id = ? ORDER BY position`, invoiceID)
+
+	if err != nil {
+		return nil, errwrap.Wrapf("Error querying invoice lines: {{err}}", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var l Line
+
+		if err := sqlstruct.Scan(&l, rows); err != nil {
+			return nil, errwrap.Wrapf("Error scanning invoice line rows: {{err}}", err)
+		}
+
+		lines = append(lines, l)
+	}
+
+	return lines, rows.Err()
+}
+
+func credited(ctx context.Context, qr querier, invoiceID string) (total int64, err error) {
+	err = qr.QueryRowContext(ctx,
+		"SELECT IFNULL(SUM(total), 0) FROM invoice WHERE credit_of_invoice_id = ?", invoiceID).Scan(&total)
+
+	if err != nil {
+		return 0, errwrap.Wrapf("Error querying invoice credits: {{err}}", err)
+	}
+
+	return total, nil
+}
+
+// next number of a kind of document for the current year
+// The sequence row stays locked until the transaction ends, so numbers of
+// transactions that roll back are reused and there are no gaps.
+func next(ctx context.Context, tx *sql.Tx, kind string) (year, number int, now string, err error) {
+	err = tx.QueryRowContext(ctx, "SELECT NOW(), YEAR(NOW())").Scan(&now, &year)
+
+	if err != nil {
+		return 0, 0, "", errwrap.Wrapf("Error querying current time: {{err}}", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO invoice_sequence (kind, year, last_number) VALUES (?, ?, 1)
+ON DUPLICATE KEY UPDATE last_number = last_number + 1`, kind, year)
+
+	if err != nil {
+		return 0, 0, "", errwrap.Wrapf("Error updating invoice sequence: {{err}}", err)
+	}
+
+	err = tx.QueryRowContext(ctx, "SELECT last_number FROM invoice_sequence WHERE kind = ? AND year = ?",
+		kind, year).Scan(&number)
+
+	if err != nil {
+		return 0, 0, "", errwrap.Wrapf("Error querying invoice sequence: {{err}}", err)
+	}
+
+	return year, number, now, nil
+}
+
+func insert(ctx context.Context, tx *sql.Tx, i Invoice) error {
+	_, err := tx.ExecContext(ctx, "INSERT INTO invoice ("+columns+`)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		i.InvoiceID,
+		i.Kind,
+		i.Year,
+		i.Number,
+		i.OrderID,
+		i.ClientID,
+		i.CreditOfInvoiceID,
+		i.ClientName,
+		i.ClientEmail,
+		i.AddressName,
+		i.AddressLine1,
+		i.AddressLine2,
+		i.City,
+		i.State,
+		i.Country,
+		i.ZipCode,
+		i.Total,
+		i.Reason,
+		i.EmployeeID,
+		i.IssuedTime,
+	)
+
+	if err != nil {
+		return errwrap.Wrapf("Error inserting invoice: {{err}}", err)
+	}
+
+	for _, l := range i.Lines {
+		_, err := tx.ExecContext(ctx, `INSERT INTO invoice_line (invoice_id, position, job_id, description, amount, price)
+VALUES (?, ?, ?, ?, ?, ?)`, i.InvoiceID, l.Position, l.JobID, l.Description, l.Amount, l.Price)
+
+		if err != nil {
+			return errwrap.Wrapf("Error inserting invoice line: {{err}}", err)
+		}
+	}
+
+	return nil
+}
+
+// Issue an invoice for the jobs of an order that weren't canceled
+// An order is invoiced again only after its previous invoices were fully
+// credited.
+func Issue(ctx context.Context, orderID, employeeID string) (invoiceID string, err error) {
+	tx, err := db().BeginTx(ctx, nil)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer tx.Rollback()
+
+	var i = Invoice{
+		InvoiceID:  uuid.NewV4().String(),
+		Kind:       KindInvoice,
+		OrderID:    orderID,
+		EmployeeID: employeeID,
+	}
+
+	var status string
+
+	// lock the order row so the same order isn't invoiced twice concurrently
+	err = tx.QueryRowContext(ctx, "SELECT client_id, status FROM `order` WHERE order_id = ? FOR UPDATE",
+		orderID).Scan(&i.ClientID, &status)
+
+	if err == sql.ErrNoRows {
+		return "", err
+	}
+
+	if err != nil {
+		return "", errwrap.Wrapf("Error querying order: {{err}}", err)
+	}
+
+	if status == "CANCELED" {
+		return "", ErrOrderCanceled
+	}
+
+	var outstanding int64
+
+	err = tx.QueryRowContext(ctx,
+		"SELECT IFNULL(SUM(IF(kind = 'INVOICE', total, -total)), 0) FROM invoice WHERE order_id = ?",
+		orderID).Scan(&outstanding)
+
+	if err != nil {
+		return "", errwrap.Wrapf("Error querying order invoices: {{err}}", err)
+	}
+
+	if outstanding != 0 {
+		return "", ErrAlreadyInvoiced
+	}
+
+	err = tx.QueryRowContext(ctx, `SELECT TRIM(CONCAT(c.first_name, ' ', c.last_name)), c.email,
+IFNULL(a.name, ''), IFNULL(a.address_line1, ''), IFNULL(a.address_line2, ''), IFNULL(a.city, ''),
+IFNULL(a.state, ''), IFNULL(a.country, ''), IFNULL(CAST(a.zip_code AS CHAR), '')
+FROM `+"`order`"+` o
+JOIN clients c ON c.client_id = o.client_id
+LEFT JOIN address a ON a.address_id = o.client_address_id
+WHERE o.order_id = ?`, orderID).Scan(
+		&i.ClientName,
+		&i.ClientEmail,
+		&i.AddressName,
+		&i.AddressLine1,
+		&i.AddressLine2,
+		&i.City,
+		&i.State,
+		&i.Country,
+		&i.ZipCode,
+	)
+
+	if err != nil {
+		return "", errwrap.Wrapf("Error querying invoice client: {{err}}", err)
+	}
+
+	if i.Lines, err = jobLines(ctx, tx, orderID); err != nil {
+		return "", err
+	}
+
+	for _, l := range i.Lines {
+		i.Total += l.Price
+	}
+
+	if len(i.Lines) == 0 || i.Total <= 0 {
+		return "", ErrNothingToInvoice
+	}
+
+	if i.Year, i.Number, i.IssuedTime, err = next(ctx, tx, KindInvoice); err != nil {
+		return "", err
+	}
+
+	if err := insert(ctx, tx, i); err != nil {
+		return "", err
+	}
+
+	return i.InvoiceID, tx.Commit()
+}
+
+func jobLines(ctx context.Context, tx *sql.Tx, orderID string) (lines []Line, err error) {
+	rows, err := tx.QueryContext(ctx, `SELECT j.job_id, IFNULL(a.original_filepath, ''), j.placement, j.amount, j.price
+FROM job j LEFT JOIN asset a ON a.asset_id = j.asset_id
+WHERE j.order_id = ? AND j.status <> 'CANCELED' ORDER BY j.created_time, j.job_id`, orderID)
+
+	if err != nil {
+		return nil, errwrap.Wrapf("Error querying invoice jobs: {{err}}", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var l = Line{Position: len(lines) + 1}
+		var jobID, design, placement string
+
+		if err := rows.Scan(&jobID, &design, &placement, &l.Amount, &l.Price); err != nil {
+			return nil, errwrap.Wrapf("Error scanning invoice jobs: {{err}}", err)
+		}
+
+		l.JobID = &jobID
+		l.Description = "Embroidery"
+
+		if design != "" {
+			l.Description += " " + design
+		}
+
+		if placement != "" {
+			l.Description += " (" + placement + ")"
+		}
+
+		lines = append(lines, l)
+	}
+
+	return lines, rows.Err()
+}
+
+// Credit an invoice, issuing a credit note for the amount
+// Crediting what remains of an invoice that was never credited reverses all
+// of its lines; otherwise the credit note has a single correction line.
+func Credit(ctx context.Context, invoiceID string, amount int64, reason, employeeID string) (creditNoteID string, err error) {
+	reason = strings.TrimSpace(reason)
+
+	if reason == "" {
+		return "", ErrNoReason
+	}
+
+	tx, err := db().BeginTx(ctx, nil)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, "SELECT "+columns+" FROM invoice WHERE invoice_id = ? FOR UPDATE", invoiceID)
+
+	if err != nil {
+		return "", errwrap.Wrapf("Error querying invoice: {{err}}", err)
+	}
+
+	var i Invoice
+
+	if !rows.Next() {
+		rows.Close()
+		return "", sql.ErrNoRows
+	}
+
+	err = sqlstruct.Scan(&i, rows)
+	rows.Close()
+
+	if err != nil {
+		return "", errwrap.Wrapf("Error scanning invoice rows: {{err}}", err)
+	}
+
+	if i.Kind != KindInvoice {
+		return "", ErrNotInvoice
+	}
+
+	if i.Credited, err = credited(ctx, tx, invoiceID); err != nil {
+		return "", err
+	}
+
+	if amount <= 0 || amount > i.Creditable() {
+		return "", ErrCreditAmount
+	}
+
+	var cn = i
+	cn.InvoiceID = uuid.NewV4().String()
+	cn.Kind = KindCreditNote
+	cn.CreditOfInvoiceID = &invoiceID
+	cn.Total = amount
+	cn.Reason = reason
+	cn.EmployeeID = employeeID
+	cn.Lines = nil
+
+	if i.Credited == 0 && amount == i.Total {
+		if cn.Lines, err = listLines(ctx, tx, invoiceID); err != nil {
+			return "", err
+		}
+	} else {
+		cn.Lines = []Line{
+			{
+				Position:    1,
+				Description: "Correction of invoice " + i.Code(),
+				Amount:      1,
+				Price:       amount,
+			},
+		}
+	}
+
+	if cn.Year, cn.Number, cn.IssuedTime, err = next(ctx, tx, KindCreditNote); err != nil {
+		return "", err
+	}
+
+	if err := insert(ctx, tx, cn); err != nil {
+		return "", err
+	}
+
+	return cn.InvoiceID, tx.Commit()
+}
+
+// GetKindFilter for invoices
+func GetKindFilter() map[string]string {
+	return allKindFilter
+}
+
+var allKindFilter = map[string]string{
+	"":            "all",
+	"invoice":     "invoices",
+	"credit_note": "credit notes",
+}
@@ -3,10 +3,14 @@ package jobshandles
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	schema "github.com/gorilla/Schema"
 	"github.com/gorilla/mux"
@@ -14,29 +18,84 @@ import (
 	"github.com/henvic/embroidery/address"
 	"github.com/henvic/embroidery/asset"
 	"github.com/henvic/embroidery/clients"
+	"github.com/henvic/embroidery/employees"
+	"github.com/henvic/embroidery/estimate"
 	"github.com/henvic/embroidery/handles"
 	"github.com/henvic/embroidery/jobs"
+	"github.com/henvic/embroidery/machines"
 	"github.com/henvic/embroidery/orders"
+	"github.com/henvic/embroidery/personalization"
+	"github.com/henvic/embroidery/pricing"
+	"github.com/henvic/embroidery/qc"
+	"github.com/henvic/embroidery/schedule"
 	"github.com/henvic/embroidery/server"
 	"github.com/henvic/embroidery/sitetemplate"
 )
 
 var router = server.Instance.Mux
+var db = server.Instance.DB
+
+// changeJob runs a change to the jobs of an order and syncs the order status
+// within the same transaction
+func changeJob(ctx context.Context, orderID, employeeID string, change func(tx *sql.Tx) error) error {
+	tx, err := db().BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := change(tx); err != nil {
+		return err
+	}
+
+	if err := orders.SyncTx(ctx, tx, orderID, employeeID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
 
 func init() {
 	router().Handle("/jobs", handles.AuthenticatedHandler(jobsHandler))
 	router().Handle("/orders/{order_id}/add-job", handles.AuthenticatedHandler(jobAddHandler))
 	router().Handle("/jobs/{job_id}", handles.AuthenticatedHandler(jobEditHandler))
+	router().Handle("/jobs/{job_id}/sessions", handles.AuthenticatedHandler(jobSessionHandler))
+	router().Handle("/jobs/{job_id}/lines", handles.AuthenticatedHandler(jobLinesHandler))
+	router().Handle("/jobs/{job_id}/ticket.pdf", handles.AuthenticatedHandler(jobTicketHandler))
+	router().Handle("/jobs/{job_id}/price", handles.AuthenticatedHandler(jobPriceHandler))
+	router().Handle("/jobs/{job_id}/delete", handles.AuthenticatedHandler(jobDeleteHandler))
 }
 
 type jobAddForm struct {
-	AssetID    string `schema:"asset_id"`
-	Type       string `schema:"type"`
-	Amount     int    `schema:"amount"`
-	Price      int64  `schema:"price"`
-	Complexity int64  `schema:"complexity"`
+	AssetID    string  `schema:"asset_id"`
+	MachineID  string  `schema:"machine_id"`
+	Amount     int     `schema:"amount"`
+	Price      *int64  `schema:"price"`
+	Complexity int64   `schema:"complexity"`
+	Placement  string  `schema:"placement"`
+	DueDate    *string `schema:"due_date"`
+	Priority   int     `schema:"priority"`
+
+	LineGarmentType []string `schema:"line_garment_type"`
+	LineSize        []string `schema:"line_size"`
+	LineColor       []string `schema:"line_color"`
+	LineQuantity    []string `schema:"line_quantity"`
 }
 
+// lineRows is the number of garment rows shown on the add-job form
+const lineRows = 8
+
+// maxLinesFileSize is the maximum size of an uploaded CSV file of job lines
+const maxLinesFileSize = 1 << 20
+
+var (
+	errPriceOverride     = errors.New("Only owners can override the suggested price")
+	errUnsupportedFormat = errors.New("The machine can't read the design file format; convert the asset first")
+	errHoopSize          = errors.New("The design doesn't fit in the hoop of the machine")
+)
+
 func jobEditHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
 	vars := mux.Vars(r)
 	jobID, ok := vars["job_id"]
@@ -72,6 +131,92 @@ func jobEditHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session)
 		return
 	}
 
+	a, err := asset.Get(r.Context(), client.ClientID, job.AssetID)
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	events, err := jobs.ListEvents(r.Context(), job.JobID)
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	m, err := machines.Get(r.Context(), job.MachineID)
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	lines, err := jobs.ListLines(r.Context(), job.JobID)
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	names, err := personalization.ListNames(r.Context(), job.JobID)
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	workSessions, err := jobs.ListSessions(r.Context(), job.JobID)
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	var working bool
+
+	for _, ws := range workSessions {
+		if ws.Open() {
+			working = true
+		}
+	}
+
+	var activeSeconds = jobs.ActiveSeconds(workSessions)
+
+	employee, err := employees.Current(r.Context(), s)
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	inspections, err := qc.ListInspections(r.Context(), job.JobID)
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	var ruleSet pricing.RuleSet
+
+	if job.PricingRuleSetID != nil {
+		ruleSet, err = pricing.Get(r.Context(), *job.PricingRuleSetID)
+
+		if err != nil {
+			handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+			return
+		}
+	}
+
 	switch r.Method {
 	case http.MethodGet:
 		var t = sitetemplate.Template{
@@ -79,10 +224,26 @@ func jobEditHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session)
 			Section:   "jobs",
 			Filenames: []string{"gui/jobs/client-job.html"},
 			Data: map[string]interface{}{
-				"Client":    client,
-				"Job":       job,
-				"Addresses": addresses,
-				"AllStatus": jobs.GetStatusFilter(),
+				"Client":           client,
+				"Job":              job,
+				"Asset":            a,
+				"Machine":          m,
+				"RuleSet":          ruleSet,
+				"Addresses":        addresses,
+				"PriceOverridden":  job.SuggestedPrice != nil && *job.SuggestedPrice != job.Price,
+				"NextStatus":       jobs.NextStatus(job.Status),
+				"Events":           events,
+				"Lines":            lines,
+				"Names":            names,
+				"LinesDone":        jobs.LinesDone(lines),
+				"WorkSessions":     workSessions,
+				"Working":          working,
+				"ActiveSeconds":    activeSeconds,
+				"OverEstimate":     job.EstimatedTotalSeconds != nil && activeSeconds > *job.EstimatedTotalSeconds,
+				"PauseReasons":     jobs.PauseReasons,
+				"Inspections":      inspections,
+				"IsOwner":          employee.IsOwner(),
+				"DefectCategories": qc.DefectCategories,
 			},
 			Request:        r,
 			ResponseWriter: w,
@@ -90,7 +251,7 @@ func jobEditHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session)
 
 		t.Respond()
 	case http.MethodPost:
-		jobPostEditHandler(client, job, w, r)
+		jobPostEditHandler(client, job, w, r, s)
 		return
 	default:
 		handles.ErrorHandler(w, r, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
@@ -119,6 +280,11 @@ func jobAddHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session)
 		return
 	}
 
+	if orders.IsFinal(order.Status) {
+		handles.ErrorHandler(w, r, "Can't add jobs to a closed order", http.StatusConflict)
+		return
+	}
+
 	client, err := clients.Get(r.Context(), order.ClientID)
 
 	if err != nil {
@@ -139,9 +305,41 @@ func jobAddHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session)
 
 	switch r.Method {
 	case http.MethodPost:
-		jobPostAddHandler(order, client, as, w, r)
+		jobPostAddHandler(order, client, as, w, r, s)
 		return
 	case http.MethodGet:
+		designs, err := listDesigns(r.Context(), as)
+
+		if err != nil {
+			handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+			return
+		}
+
+		employee, err := employees.Current(r.Context(), s)
+
+		if err != nil {
+			handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+			return
+		}
+
+		ruleSet, err := pricing.Current(r.Context())
+
+		if err != nil && err != sql.ErrNoRows {
+			handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+			return
+		}
+
+		ms, err := machines.List(r.Context(), machines.ListFilter{})
+
+		if err != nil {
+			handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+			return
+		}
+
 		var t = sitetemplate.Template{
 			Title:     fmt.Sprintf("Criando ordem de serviço"),
 			Section:   "orders",
@@ -150,6 +348,11 @@ func jobAddHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session)
 				"Client":        client,
 				"Order":         order,
 				"Assets":        as,
+				"Designs":       designs,
+				"Machines":      ms,
+				"RuleSet":       ruleSet,
+				"IsOwner":       employee.IsOwner(),
+				"LineRows":      make([]jobs.Line, lineRows),
 				"MaybeClientID": r.URL.Query().Get("maybe_client_id"),
 			},
 			Request:        r,
@@ -164,8 +367,28 @@ func jobAddHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session)
 	}
 }
 
-func jobPostAddHandler(order orders.Order, client clients.Client, as []asset.Asset, w http.ResponseWriter, r *http.Request) {
-	if err := r.ParseForm(); err != nil {
+// listDesigns of the assets that are known designs, by asset ID
+func listDesigns(ctx context.Context, as []asset.Asset) (map[string]asset.Design, error) {
+	var designs = map[string]asset.Design{}
+
+	for _, a := range as {
+		d, err := asset.GetDesign(ctx, a.AssetID)
+
+		switch err {
+		case nil:
+			designs[a.AssetID] = d
+		case sql.ErrNoRows:
+		default:
+			return nil, err
+		}
+	}
+
+	return designs, nil
+}
+
+func jobPostAddHandler(order orders.Order, client clients.Client, as []asset.Asset,
+	w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	if err := r.ParseMultipartForm(maxLinesFileSize); err != nil && err != http.ErrNotMultipart {
 		handles.ErrorHandler(w, r, "Invalid form", http.StatusBadRequest)
 		return
 	}
@@ -201,13 +424,97 @@ func jobPostAddHandler(order orders.Order, client clients.Client, as []asset.Ass
 		OrderID:    order.OrderID,
 		AssetID:    caf.AssetID,
 		Status:     "CREATED",
-		Type:       caf.Type,
+		MachineID:  caf.MachineID,
 		Amount:     caf.Amount,
-		Price:      caf.Price,
 		Complexity: caf.Complexity,
+		Placement:  strings.TrimSpace(caf.Placement),
+		Priority:   caf.Priority,
+	}
+
+	if len([]rune(o.Placement)) > 255 {
+		handles.ErrorHandler(w, r, "Placement is too long", http.StatusBadRequest)
+		return
 	}
 
-	added, err := jobs.Insert(context.Background(), o)
+	lines, err := decodeLines(r, caf)
+
+	if err != nil {
+		handles.ErrorHandler(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// the amount is derived from the lines when the job is broken down
+	if len(lines) != 0 {
+		o.Lines = lines
+		o.Amount = jobs.LinesAmount(lines)
+	}
+
+	// jobs are due with their order unless a due date is given
+	o.DueDate = order.DueDate
+
+	if caf.DueDate != nil && *caf.DueDate != "" {
+		if _, err := time.Parse("2006-01-02", *caf.DueDate); err != nil {
+			handles.ErrorHandler(w, r, "Invalid due date", http.StatusBadRequest)
+			return
+		}
+
+		o.DueDate = caf.DueDate
+	}
+
+	if caf.Price != nil {
+		o.Price = *caf.Price
+	}
+
+	m, err := machines.Get(r.Context(), caf.MachineID)
+
+	switch {
+	case err == sql.ErrNoRows || (err == nil && !m.Active):
+		handles.ErrorHandler(w, r, "Machine not found", http.StatusBadRequest)
+		return
+	case err != nil:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	employee, err := employees.Current(r.Context(), s)
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	d, err := asset.GetDesign(r.Context(), o.AssetID)
+
+	switch err {
+	case nil:
+		err = estimateJob(r.Context(), &o, d, m, caf.Price, employee.IsOwner())
+	case sql.ErrNoRows:
+		// the complexity and price of other assets are typed in
+		err = nil
+	}
+
+	switch err {
+	case nil:
+	case errPriceOverride:
+		handles.ErrorHandler(w, r, err.Error(), http.StatusForbidden)
+		return
+	case errUnsupportedFormat, errHoopSize:
+		handles.ErrorHandler(w, r, err.Error(), http.StatusConflict)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	var added string
+
+	err = changeJob(r.Context(), order.OrderID, employee.EmployeeID, func(tx *sql.Tx) (err error) {
+		added, err = jobs.InsertTx(r.Context(), tx, o)
+		return err
+	})
 
 	if err != nil {
 		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -215,10 +522,109 @@ func jobPostAddHandler(order orders.Order, client clients.Client, as []asset.Ass
 		return
 	}
 
+	if err := schedule.Recompute(r.Context()); err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
 	http.Redirect(w, r, fmt.Sprintf("/jobs/%v", url.QueryEscape(added)), http.StatusSeeOther)
 }
 
-func jobPostEditHandler(client clients.Client, job jobs.Job, w http.ResponseWriter, r *http.Request) {
+// decodeLines typed on the grid of the add-job form and imported from a CSV file
+func decodeLines(r *http.Request, caf jobAddForm) (lines []jobs.Line, err error) {
+	for i, q := range caf.LineQuantity {
+		var l = jobs.Line{}
+
+		if i < len(caf.LineGarmentType) {
+			l.GarmentType = strings.TrimSpace(caf.LineGarmentType[i])
+		}
+
+		if i < len(caf.LineSize) {
+			l.Size = strings.TrimSpace(caf.LineSize[i])
+		}
+
+		if i < len(caf.LineColor) {
+			l.Color = strings.TrimSpace(caf.LineColor[i])
+		}
+
+		if strings.TrimSpace(q) == "" && l.GarmentType == "" && l.Size == "" && l.Color == "" {
+			continue
+		}
+
+		l.Quantity, err = strconv.Atoi(strings.TrimSpace(q))
+
+		if err != nil || l.Quantity < 1 {
+			return nil, fmt.Errorf("Invalid quantity %q on line %d", q, i+1)
+		}
+
+		lines = append(lines, l)
+	}
+
+	file, _, err := r.FormFile("lines_csv")
+
+	switch err {
+	case nil:
+	case http.ErrMissingFile, http.ErrNotMultipart:
+		return lines, nil
+	default:
+		return nil, err
+	}
+
+	defer file.Close()
+
+	imported, err := jobs.ParseLines(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return append(lines, imported...), nil
+}
+
+// estimateJob derives the complexity, run time and price of a job from the
+// design of its asset. The suggested price is used unless an owner overrides it.
+func estimateJob(ctx context.Context, job *jobs.Job, d asset.Design, m machines.Machine, price *int64, canOverride bool) error {
+	if !m.Supports(d.Format) {
+		return errUnsupportedFormat
+	}
+
+	if !m.Fits(d) {
+		return errHoopSize
+	}
+
+	var e = estimate.Job(d, m.Profile(), job.Amount)
+	job.Complexity = e.Complexity
+	job.EstimatedPieceSeconds = &e.PieceSeconds
+	job.EstimatedTotalSeconds = &e.TotalSeconds
+
+	rs, err := pricing.Current(ctx)
+
+	if err == sql.ErrNoRows {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	var suggestion = rs.Suggest(d, job.Amount)
+	job.PricingRuleSetID = &rs.RuleSetID
+	job.SuggestedPrice = &suggestion.Price
+	job.Price = suggestion.Price
+
+	if price != nil && *price != suggestion.Price {
+		if !canOverride {
+			return errPriceOverride
+		}
+
+		job.Price = *price
+	}
+
+	return nil
+}
+
+func jobPostEditHandler(client clients.Client, job jobs.Job, w http.ResponseWriter, r *http.Request, s *sessions.Session) {
 	if err := r.ParseForm(); err != nil {
 		handles.ErrorHandler(w, r, "Invalid form", http.StatusBadRequest)
 		return
@@ -227,16 +633,31 @@ func jobPostEditHandler(client clients.Client, job jobs.Job, w http.ResponseWrit
 	var status = r.FormValue("status")
 
 	switch status {
-	case "created", "queue", "in_progress", "canceled", "done":
-		job.Status = status
+	case "created", "queue", "in_progress", "qc", "canceled", "done":
 	default:
 		handles.ErrorHandler(w, r, "Invalid job status", http.StatusBadRequest)
 		return
 	}
 
-	err := jobs.UpdateStatus(r.Context(), job)
+	employeeID, _ := s.Values["user"].(string)
+	err := changeJob(r.Context(), job.OrderID, employeeID, func(tx *sql.Tx) error {
+		return jobs.UpdateStatusTx(r.Context(), tx, job.JobID, status, employeeID)
+	})
 
-	if err != nil {
+	switch err {
+	case nil:
+	case jobs.ErrInvalidTransition:
+		handles.ErrorHandler(w, r,
+			fmt.Sprintf("Job can't change from %v to %v", strings.ToLower(job.Status), status),
+			http.StatusConflict)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	if err := schedule.Recompute(r.Context()); err != nil {
 		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
 		return
@@ -245,6 +666,167 @@ func jobPostEditHandler(client clients.Client, job jobs.Job, w http.ResponseWrit
 	http.Redirect(w, r, fmt.Sprintf("/jobs?order_id=%v", url.QueryEscape(job.OrderID)), http.StatusSeeOther)
 }
 
+func jobSessionHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	if r.Method != http.MethodPost {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	vars := mux.Vars(r)
+	jobID, ok := vars["job_id"]
+
+	if !ok {
+		handles.ErrorHandler(w, r, "Missing job ID parameter", http.StatusBadRequest)
+		return
+	}
+
+	job, err := jobs.Get(r.Context(), jobID)
+
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		handles.ErrorHandler(w, r, "Job not found", http.StatusNotFound)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		handles.ErrorHandler(w, r, "Invalid form", http.StatusBadRequest)
+		return
+	}
+
+	employeeID, _ := s.Values["user"].(string)
+	var change func(tx *sql.Tx) error
+
+	switch r.FormValue("action") {
+	case "start":
+		change = func(tx *sql.Tx) error {
+			return jobs.StartTx(r.Context(), tx, job.JobID, employeeID)
+		}
+	case "pause":
+		change = func(tx *sql.Tx) error {
+			return jobs.PauseTx(r.Context(), tx, job.JobID, r.FormValue("reason"))
+		}
+	default:
+		handles.ErrorHandler(w, r, "Invalid work session action", http.StatusBadRequest)
+		return
+	}
+
+	err = changeJob(r.Context(), job.OrderID, employeeID, change)
+
+	switch err {
+	case nil:
+	case jobs.ErrInvalidReason:
+		handles.ErrorHandler(w, r, err.Error(), http.StatusBadRequest)
+		return
+	case jobs.ErrInvalidTransition:
+		handles.ErrorHandler(w, r,
+			fmt.Sprintf("Job can't be worked on while %v", strings.ToLower(job.Status)),
+			http.StatusConflict)
+		return
+	case jobs.ErrSessionOpen, jobs.ErrNoOpenSession:
+		handles.ErrorHandler(w, r, err.Error(), http.StatusConflict)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	if job.Status == "QUEUE" {
+		if err := schedule.Recompute(r.Context()); err != nil {
+			handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+			return
+		}
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/jobs/%v", url.QueryEscape(job.JobID)), http.StatusSeeOther)
+}
+
+func jobLinesHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	if r.Method != http.MethodPost {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	vars := mux.Vars(r)
+	jobID, ok := vars["job_id"]
+
+	if !ok {
+		handles.ErrorHandler(w, r, "Missing job ID parameter", http.StatusBadRequest)
+		return
+	}
+
+	job, err := jobs.Get(r.Context(), jobID)
+
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		handles.ErrorHandler(w, r, "Job not found", http.StatusNotFound)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	if job.Status != "IN_PROGRESS" {
+		handles.ErrorHandler(w, r, "Only jobs in progress can be sewed", http.StatusConflict)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		handles.ErrorHandler(w, r, "Invalid form", http.StatusBadRequest)
+		return
+	}
+
+	var done = map[int64]int{}
+
+	for key, values := range r.PostForm {
+		if !strings.HasPrefix(key, "done_") || len(values) == 0 {
+			continue
+		}
+
+		lineID, err := strconv.ParseInt(strings.TrimPrefix(key, "done_"), 10, 64)
+
+		if err != nil {
+			handles.ErrorHandler(w, r, "Invalid job line", http.StatusBadRequest)
+			return
+		}
+
+		n, err := strconv.Atoi(strings.TrimSpace(values[0]))
+
+		if err != nil {
+			handles.ErrorHandler(w, r, "Invalid completed count", http.StatusBadRequest)
+			return
+		}
+
+		done[lineID] = n
+	}
+
+	err = jobs.UpdateLinesDone(r.Context(), job.JobID, done)
+
+	switch err {
+	case nil:
+	case jobs.ErrInvalidDone:
+		handles.ErrorHandler(w, r, err.Error(), http.StatusBadRequest)
+		return
+	case sql.ErrNoRows:
+		handles.ErrorHandler(w, r, "Job line not found", http.StatusNotFound)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/jobs/%v", url.QueryEscape(job.JobID)), http.StatusSeeOther)
+}
+
 func jobsHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
 	var clientID = (r.URL.Query().Get("client_id"))
 	var orderID = (r.URL.Query().Get("order_id"))
@@ -306,10 +888,45 @@ func jobsHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
 		}
 	}
 
-	jobsList, err := jobs.List(r.Context(), jobs.ListFilter{
+	var f = jobs.ListFilter{
 		ClientID: clientID,
 		OrderID:  orderID,
 		Status:   currentStatus,
+		Due:      r.URL.Query().Get("due"),
+		Sort:     r.URL.Query().Get("sort"),
+	}
+
+	if _, ok := jobs.GetDueFilter()[f.Due]; !ok {
+		handles.ErrorHandler(w, r, "Invalid due date filter", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := jobs.GetSortOptions()[f.Sort]; !ok {
+		handles.ErrorHandler(w, r, "Invalid sorting", http.StatusBadRequest)
+		return
+	}
+
+	if p := r.URL.Query().Get("priority"); p != "" {
+		priority, err := strconv.Atoi(p)
+
+		if err != nil {
+			handles.ErrorHandler(w, r, "Invalid priority", http.StatusBadRequest)
+			return
+		}
+
+		f.MinPriority = &priority
+	}
+
+	jobsList, err := jobs.List(r.Context(), f)
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	ms, err := machines.List(r.Context(), machines.ListFilter{
+		ShowInactive: true,
 	})
 
 	if err != nil {
@@ -326,11 +943,15 @@ func jobsHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
 		Filenames: []string{"gui/jobs/list-client.html"},
 		Data: map[string]interface{}{
 			"ClientsMap":    clientsMap,
+			"MachinesMap":   machines.GetMachinesMapFromSlice(ms),
 			"Client":        c,
 			"Order":         o,
 			"Jobs":          jobsList,
 			"AllStatus":     jobs.GetStatusFilter(),
 			"CurrentStatus": currentStatus,
+			"AllDue":        jobs.GetDueFilter(),
+			"SortOptions":   jobs.GetSortOptions(),
+			"Filter":        f,
 		},
 		Request:        r,
 		ResponseWriter: w,
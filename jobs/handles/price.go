@@ -0,0 +1,113 @@
+package jobshandles
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+	"github.com/henvic/embroidery/employees"
+	"github.com/henvic/embroidery/handles"
+	"github.com/henvic/embroidery/jobs"
+)
+
+func jobPriceHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	if r.Method != http.MethodPost {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	employee, err := employees.Current(r.Context(), s)
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	if !employee.IsOwner() {
+		handles.ErrorHandler(w, r, errPriceOverride.Error(), http.StatusForbidden)
+		return
+	}
+
+	price, err := strconv.ParseInt(strings.TrimSpace(r.FormValue("price")), 10, 64)
+
+	if err != nil || price < 0 {
+		handles.ErrorHandler(w, r, "Invalid price", http.StatusBadRequest)
+		return
+	}
+
+	job, err := jobs.Get(r.Context(), mux.Vars(r)["job_id"])
+
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		handles.ErrorHandler(w, r, "Job not found", http.StatusNotFound)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	err = changeJob(r.Context(), job.OrderID, employee.EmployeeID, func(tx *sql.Tx) error {
+		return jobs.UpdatePriceTx(r.Context(), tx, job.JobID, price)
+	})
+
+	switch err {
+	case nil:
+	case jobs.ErrPriceLocked:
+		handles.ErrorHandler(w, r, err.Error(), http.StatusConflict)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/jobs/%v", url.QueryEscape(job.JobID)), http.StatusSeeOther)
+}
+
+func jobDeleteHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	if r.Method != http.MethodPost {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	job, err := jobs.Get(r.Context(), mux.Vars(r)["job_id"])
+
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		handles.ErrorHandler(w, r, "Job not found", http.StatusNotFound)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	employeeID, _ := s.Values["user"].(string)
+
+	err = changeJob(r.Context(), job.OrderID, employeeID, func(tx *sql.Tx) error {
+		return jobs.DeleteTx(r.Context(), tx, job.JobID)
+	})
+
+	switch err {
+	case nil:
+	case jobs.ErrNotDeletable, jobs.ErrHasGoods, jobs.ErrInvoiced:
+		handles.ErrorHandler(w, r, err.Error(), http.StatusConflict)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/jobs?order_id=%v", url.QueryEscape(job.OrderID)), http.StatusSeeOther)
+}
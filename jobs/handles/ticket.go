@@ -0,0 +1,53 @@
+package jobshandles
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+	"github.com/henvic/embroidery/handles"
+	"github.com/henvic/embroidery/ticket"
+)
+
+func jobTicketHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	if r.Method != http.MethodGet {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	t, err := ticket.Load(r.Context(), mux.Vars(r)["job_id"])
+
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		handles.ErrorHandler(w, r, "Job not found", http.StatusNotFound)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	// the document is rendered before responding, so errors aren't sent as a
+	// truncated file
+	var buf bytes.Buffer
+
+	if err := t.Write(&buf); err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"job-%v.pdf\"", t.Job.JobID))
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+
+	if _, err := buf.WriteTo(w); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing ticket of job %v: %v\n", t.Job.JobID, err)
+	}
+}
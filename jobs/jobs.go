@@ -21,55 +21,103 @@ type Job struct {
 	ClientID   string  `schema:"client_id"`
 	AssetID    string  `schema:"asset_id"`
 	Status     string  `schema:"status"`
-	Type       string  `schema:"type"`
+	MachineID  string  `schema:"machine_id"`
 	Amount     int     `schema:"amount"`
 	Price      int64   `schema:"price"`
 	StartTime  *string `schema:"start_time"`
 	EndTime    *string `schema:"end_time"`
-	Complexity int64   `schema:"amount"`
+	Complexity int64   `schema:"complexity"`
+
+	// Placement of the design on the garment, i.e., "left chest"
+	Placement string `schema:"placement"`
+
+	// EstimatedPieceSeconds and EstimatedTotalSeconds are derived from the
+	// design of the asset, when it is known
+	EstimatedPieceSeconds *int64 `schema:"estimated_piece_seconds"`
+	EstimatedTotalSeconds *int64 `schema:"estimated_total_seconds"`
+
+	// PricingRuleSetID and SuggestedPrice record how the price was suggested
+	// Price differs from SuggestedPrice when an owner overrides it
+	PricingRuleSetID *string `schema:"pricing_rule_set_id"`
+	SuggestedPrice   *int64  `schema:"suggested_price"`
+
+	// DueDate and Priority are used for scheduling: higher priorities first
+	DueDate     *string `schema:"due_date"`
+	Priority    int     `schema:"priority"`
+	CreatedTime string  `schema:"created_time"`
+
+	// ReworkOfJobID is the job whose rejected pieces this job redoes
+	ReworkOfJobID *string `schema:"rework_of_job_id"`
+
+	// Lines break the amount down by garment, size and color
+	// Lines are stored with the job by Insert, but aren't loaded by Get or List.
+	Lines []Line `schema:"-" sql:"-"`
 }
 
+const columns = `job_id,order_id,client_id,asset_id,status,machine_id,amount,price,start_time,end_time,complexity,placement,
+estimated_piece_seconds,estimated_total_seconds,pricing_rule_set_id,suggested_price,due_date,priority,created_time,rework_of_job_id`
+
 // ListFilter sets the filter settings
+// Due is one of the keys of GetDueFilter and Sort one of GetSortOptions.
+// MinPriority lists only jobs with at least the given priority and
+// ScheduledOn only the jobs on the schedule of the given machine.
 type ListFilter struct {
-	ClientID string
-	OrderID  string
-	Status   string
+	ClientID    string
+	OrderID     string
+	Status      string
+	Due         string
+	MinPriority *int
+	ScheduledOn string
+	Sort        string
 }
 
 // List job
 func List(ctx context.Context, f ListFilter) (job []Job, err error) {
-	var q = "SELECT job_id,order_id,client_id,asset_id,status,type,amount,price,start_time,end_time,complexity FROM `job`"
+	var q = "SELECT " + columns + " FROM `job`"
+	var where []string
 	var i []interface{}
 
-	// horrible 'WHERE'...
-	if f.ClientID != "" || f.OrderID != "" || f.Status != "" {
-		q += " WHERE"
-	}
-
 	if f.ClientID != "" {
-		q += " client_id = ?"
+		where = append(where, "client_id = ?")
 		i = append(i, f.ClientID)
-
-		if f.OrderID != "" || f.Status != "" {
-			q += " AND"
-		}
 	}
 
 	if f.Status != "" {
-		q += " status = ?"
+		where = append(where, "status = ?")
 		i = append(i, f.Status)
 	}
 
-	if f.OrderID != "" && f.Status != "" {
-		q += " AND"
-	}
-
 	if f.OrderID != "" {
-		q += " order_id = ?"
+		where = append(where, "order_id = ?")
 		i = append(i, f.OrderID)
 	}
 
-	q += " ORDER BY start_time DESC"
+	if c, ok := dueClauses[f.Due]; ok && c != "" {
+		where = append(where, c)
+	}
+
+	if f.MinPriority != nil {
+		where = append(where, "priority >= ?")
+		i = append(i, *f.MinPriority)
+	}
+
+	if f.ScheduledOn != "" {
+		where = append(where, "job_id IN (SELECT job_id FROM schedule_slot WHERE machine_id = ?)")
+		i = append(i, f.ScheduledOn)
+	}
+
+	if len(where) != 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
+	}
+
+	switch f.Sort {
+	case "due_date":
+		q += " ORDER BY due_date IS NULL, due_date, priority DESC, start_time DESC"
+	case "priority":
+		q += " ORDER BY priority DESC, due_date IS NULL, due_date, start_time DESC"
+	default:
+		q += " ORDER BY start_time DESC"
+	}
 
 	stmt, err := db().PrepareContext(ctx, q)
 
@@ -85,6 +133,8 @@ func List(ctx context.Context, f ListFilter) (job []Job, err error) {
 		return nil, errwrap.Wrapf("Error querying job: {{err}}", err)
 	}
 
+	defer rows.Close()
+
 	for rows.Next() {
 		var a Job
 		err = sqlstruct.Scan(&a, rows)
@@ -100,20 +150,6 @@ func List(ctx context.Context, f ListFilter) (job []Job, err error) {
 	return job, err
 }
 
-func updateOrderPrice(ctx context.Context, tx *sql.Tx, orderID string, priceDelta int64) error {
-	var q = "UPDATE `order` SET price_total = price_total + ? WHERE order_id = ?"
-	stmt, err := tx.PrepareContext(ctx, q)
-
-	if err != nil {
-		return errwrap.Wrapf("Error preparing order price_total update query: {{err}}", err)
-	}
-
-	defer stmt.Close()
-
-	_, err = stmt.ExecContext(ctx, priceDelta, orderID)
-	return err
-}
-
 // Insert job on database
 func Insert(ctx context.Context, job Job) (uid string, err error) {
 	// we don't want to spend all time here if something goes wrong
@@ -128,17 +164,31 @@ func Insert(ctx context.Context, job Job) (uid string, err error) {
 		return "", err
 	}
 
-	uid, err = insert(ctxTransaction, tx, job)
+	if uid, err = InsertTx(ctxTransaction, tx, job); err != nil {
+		return "", err
+	}
+
+	return uid, tx.Commit()
+}
+
+// InsertTx inserts a job with its lines within a transaction, recomputing the
+// price_total of the order
+func InsertTx(ctx context.Context, tx *sql.Tx, job Job) (uid string, err error) {
+	uid, err = insert(ctx, tx, job)
 
 	if err != nil {
 		return "", err
 	}
 
-	if err := updateOrderPrice(ctxTransaction, tx, job.OrderID, job.Price); err != nil {
+	if err := insertLines(ctx, tx, uid, job.Lines); err != nil {
 		return "", err
 	}
 
-	return uid, tx.Commit()
+	if err := RecomputeOrderPriceTx(ctx, tx, job.OrderID); err != nil {
+		return "", err
+	}
+
+	return uid, nil
 }
 
 func insert(ctx context.Context, tx *sql.Tx, job Job) (uid string, err error) {
@@ -150,12 +200,20 @@ func insert(ctx context.Context, tx *sql.Tx, job Job) (uid string, err error) {
 		client_id,
 		asset_id,
 		status,
-		type,
+		machine_id,
 		amount,
 		price,
-		complexity
+		complexity,
+		placement,
+		estimated_piece_seconds,
+		estimated_total_seconds,
+		pricing_rule_set_id,
+		suggested_price,
+		due_date,
+		priority,
+		rework_of_job_id
 		)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
 	stmt, err := tx.PrepareContext(ctx, query)
 
@@ -172,10 +230,18 @@ func insert(ctx context.Context, tx *sql.Tx, job Job) (uid string, err error) {
 		job.ClientID,
 		job.AssetID,
 		"CREATED",
-		job.Type,
+		job.MachineID,
 		job.Amount,
 		job.Price,
 		job.Complexity,
+		job.Placement,
+		job.EstimatedPieceSeconds,
+		job.EstimatedTotalSeconds,
+		job.PricingRuleSetID,
+		job.SuggestedPrice,
+		job.DueDate,
+		job.Priority,
+		job.ReworkOfJobID,
 	)
 
 	if err != nil {
@@ -185,65 +251,30 @@ func insert(ctx context.Context, tx *sql.Tx, job Job) (uid string, err error) {
 	return uid, err
 }
 
-// UpdateStatus of a job
-func UpdateStatus(ctx context.Context, job Job) error {
-	var oldJob, err = Get(ctx, job.JobID)
-
-	if err != nil {
-		return err
-	}
-
-	var q = "UPDATE `job` SET "
-
-	var i []interface{}
-	job.Status = strings.ToUpper(job.Status)
-
-	if job.Status != oldJob.Status {
-		q += "status = ?, "
-		i = append(i, job.Status)
-
-		if job.Status == "DONE" {
-			q += "end_time = CURRENT_TIMESTAMP, "
-		}
-
-		if job.Status == "IN_PROGRESS" && job.StartTime == nil {
-			q += "start_time = CURRENT_TIMESTAMP, "
-		}
-	}
-
-	q += "asset_id = ? WHERE job_id = ?"
-
-	stmt, err := db().PrepareContext(ctx, q)
-
-	if err != nil {
-		return errwrap.Wrapf("Error preparing employee update query: {{err}}", err)
-	}
-
-	defer stmt.Close()
-
-	i = append(i, job.AssetID, job.JobID)
-	_, err = stmt.ExecContext(ctx, i...)
-
-	return err
-}
-
 // Get job by ID
 func Get(ctx context.Context, jobID string) (Job, error) {
-	stmt, err := db().PrepareContext(ctx,
-		`SELECT job_id,order_id,client_id,asset_id,status,type,amount,price,start_time,end_time,complexity FROM job WHERE job_id = ?`)
+	return get(ctx, db(), jobID)
+}
 
-	if err != nil {
-		return Job{}, errwrap.Wrapf("Error preparing job query: {{err}}", err)
-	}
+// GetTx gets a job by ID within a transaction
+func GetTx(ctx context.Context, tx *sql.Tx, jobID string) (Job, error) {
+	return get(ctx, tx, jobID)
+}
 
-	defer stmt.Close()
+// querier is either the database or a transaction
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
 
-	rows, err := stmt.QueryContext(ctx, jobID)
+func get(ctx context.Context, qr querier, jobID string) (Job, error) {
+	rows, err := qr.QueryContext(ctx, "SELECT "+columns+" FROM `job` WHERE job_id = ?", jobID)
 
 	if err != nil {
 		return Job{}, errwrap.Wrapf("Error querying job: {{err}}", err)
 	}
 
+	defer rows.Close()
+
 	var job Job
 
 	if ok := rows.Next(); !ok {
@@ -262,11 +293,60 @@ func GetStatusFilter() map[string]string {
 	return allStatusFilter
 }
 
+// GetDueFilter for jobs
+func GetDueFilter() map[string]string {
+	return allDueFilter
+}
+
+// GetSortOptions for jobs
+func GetSortOptions() map[string]string {
+	return allSortOptions
+}
+
+var allDueFilter = map[string]string{
+	"":        "any due date",
+	"late":    "late",
+	"overdue": "overdue",
+	"week":    "due in a week",
+	"none":    "no due date",
+}
+
+// dueClauses of the due filter
+// Late jobs are the ones flagged by the late jobs checker: they are planned to
+// finish after their due date, even if it didn't pass yet.
+var dueClauses = map[string]string{
+	"":        "",
+	"late":    "job_id IN (SELECT job_id FROM late_job)",
+	"overdue": "due_date < CURRENT_DATE AND status NOT IN ('DONE', 'CANCELED')",
+	"week":    "due_date BETWEEN CURRENT_DATE AND DATE_ADD(CURRENT_DATE, INTERVAL 7 DAY)",
+	"none":    "due_date IS NULL",
+}
+
+var allSortOptions = map[string]string{
+	"":         "newest",
+	"due_date": "due date",
+	"priority": "priority",
+}
+
 var allStatusFilter = map[string]string{
 	"":            "all",
 	"created":     "created",
 	"queue":       "queue",
 	"in_progress": "in progress",
+	"qc":          "quality control",
 	"canceled":    "canceled",
 	"done":        "done",
 }
+
+// AssignTx assigns a job to a machine, updating its estimated run time
+func AssignTx(ctx context.Context, tx *sql.Tx, jobID, machineID string, pieceSeconds, totalSeconds *int64) error {
+	_, err := tx.ExecContext(ctx,
+		"UPDATE `job` SET machine_id = ?, estimated_piece_seconds = ?, estimated_total_seconds = ? WHERE job_id = ?",
+		machineID, pieceSeconds, totalSeconds, jobID)
+
+	if err != nil {
+		return errwrap.Wrapf("Error assigning job to machine: {{err}}", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,249 @@
+package jobs
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/kisielk/sqlstruct"
+)
+
+// ErrInvalidDone is used when the completed count of a line is out of range
+var ErrInvalidDone = errors.New("Completed count must be between zero and the line quantity")
+
+// Line of a job: how many pieces of a garment, size and color to sew
+type Line struct {
+	JobLineID   int64  `schema:"job_line_id"`
+	JobID       string `schema:"job_id"`
+	Position    int    `schema:"position"`
+	GarmentType string `schema:"garment_type"`
+	Size        string `schema:"size"`
+	Color       string `schema:"color"`
+	Quantity    int    `schema:"quantity"`
+	Done        int    `schema:"done"`
+}
+
+// LinesAmount is the total quantity of pieces of the lines
+func LinesAmount(lines []Line) (amount int) {
+	for _, l := range lines {
+		amount += l.Quantity
+	}
+
+	return amount
+}
+
+// LinesDone is the total of pieces already sewed
+func LinesDone(lines []Line) (done int) {
+	for _, l := range lines {
+		done += l.Done
+	}
+
+	return done
+}
+
+// csv header names, in English and Portuguese
+var lineHeaders = map[string]string{
+	"garment_type": "garment_type",
+	"garment":      "garment_type",
+	"type":         "garment_type",
+	"peça":         "garment_type",
+	"peca":         "garment_type",
+	"tipo":         "garment_type",
+	"size":         "size",
+	"tamanho":      "size",
+	"color":        "color",
+	"cor":          "color",
+	"quantity":     "quantity",
+	"qty":          "quantity",
+	"quantidade":   "quantity",
+	"qtd":          "quantity",
+}
+
+// ParseLines from a CSV file with garment type, size, color and quantity
+// columns, in this order unless a header row names them. Both comma and
+// semicolon separated files are accepted.
+func ParseLines(r io.Reader) (lines []Line, err error) {
+	var br = bufio.NewReader(r)
+	first, _ := br.Peek(4096)
+
+	var cr = csv.NewReader(br)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	var firstLine = strings.SplitN(string(first), "\n", 2)[0]
+
+	if strings.Count(firstLine, ";") > strings.Count(firstLine, ",") {
+		cr.Comma = ';'
+	}
+
+	records, err := cr.ReadAll()
+
+	if err != nil {
+		return nil, errwrap.Wrapf("Error reading CSV file: {{err}}", err)
+	}
+
+	var index = map[string]int{"garment_type": 0, "size": 1, "color": 2, "quantity": 3}
+
+	if len(records) != 0 && isLineHeader(records[0]) {
+		index = map[string]int{}
+
+		for i, h := range records[0] {
+			if c, ok := lineHeaders[headerName(h)]; ok {
+				index[c] = i
+			}
+		}
+
+		if _, ok := index["quantity"]; !ok {
+			return nil, errors.New("CSV file has no quantity column")
+		}
+
+		records = records[1:]
+	}
+
+	var field = func(record []string, column string) string {
+		i, ok := index[column]
+
+		if !ok || i >= len(record) {
+			return ""
+		}
+
+		return strings.TrimSpace(record[i])
+	}
+
+	for n, record := range records {
+		var l = Line{
+			GarmentType: field(record, "garment_type"),
+			Size:        field(record, "size"),
+			Color:       field(record, "color"),
+		}
+
+		var q = field(record, "quantity")
+
+		if q == "" && l.GarmentType == "" && l.Size == "" && l.Color == "" {
+			continue
+		}
+
+		l.Quantity, err = strconv.Atoi(q)
+
+		if err != nil || l.Quantity < 1 {
+			return nil, fmt.Errorf("Invalid quantity %q on CSV row %d", q, n+1)
+		}
+
+		lines = append(lines, l)
+	}
+
+	return lines, nil
+}
+
+func isLineHeader(record []string) bool {
+	for _, h := range record {
+		if _, ok := lineHeaders[headerName(h)]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// headerName normalizes a header, removing the byte order mark spreadsheets add
+func headerName(h string) string {
+	return strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+}
+
+func insertLines(ctx context.Context, tx *sql.Tx, jobID string, lines []Line) error {
+	stmt, err := tx.PrepareContext(ctx,
+		"INSERT INTO job_line (job_id, position, garment_type, size, color, quantity) VALUES (?, ?, ?, ?, ?, ?)")
+
+	if err != nil {
+		return errwrap.Wrapf("Error preparing job line insert query: {{err}}", err)
+	}
+
+	defer stmt.Close()
+
+	for i, l := range lines {
+		if _, err := stmt.ExecContext(ctx, jobID, i, l.GarmentType, l.Size, l.Color, l.Quantity); err != nil {
+			return errwrap.Wrapf("Error inserting job line: {{err}}", err)
+		}
+	}
+
+	return nil
+}
+
+// ListLines of a job, in the order they were typed
+func ListLines(ctx context.Context, jobID string) (lines []Line, err error) {
+	stmt, err := db().PrepareContext(ctx,
+		"SELECT job_line_id,job_id,position,garment_type,size,color,quantity,done FROM job_line WHERE job_id = ? ORDER BY position")
+
+	if err != nil {
+		return nil, errwrap.Wrapf("Error preparing job line query: {{err}}", err)
+	}
+
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, jobID)
+
+	if err != nil {
+		return nil, errwrap.Wrapf("Error querying job lines: {{err}}", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var l Line
+
+		if err := sqlstruct.Scan(&l, rows); err != nil {
+			return nil, errwrap.Wrapf("Error scanning job line rows: {{err}}", err)
+		}
+
+		lines = append(lines, l)
+	}
+
+	return lines, rows.Err()
+}
+
+// UpdateLinesDone sets how many pieces of each line of a job were sewed
+// sql.ErrNoRows is returned if a line isn't from the job
+func UpdateLinesDone(ctx context.Context, jobID string, done map[int64]int) error {
+	tx, err := db().BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	for lineID, n := range done {
+		var quantity int
+
+		err := tx.QueryRowContext(ctx,
+			"SELECT quantity FROM job_line WHERE job_line_id = ? AND job_id = ? FOR UPDATE",
+			lineID, jobID).Scan(&quantity)
+
+		if err == sql.ErrNoRows {
+			return err
+		}
+
+		if err != nil {
+			return errwrap.Wrapf("Error querying job line: {{err}}", err)
+		}
+
+		if n < 0 || n > quantity {
+			return ErrInvalidDone
+		}
+
+		_, err = tx.ExecContext(ctx, "UPDATE job_line SET done = ? WHERE job_line_id = ?", n, lineID)
+
+		if err != nil {
+			return errwrap.Wrapf("Error updating job line: {{err}}", err)
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,175 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/hashicorp/errwrap"
+)
+
+var (
+	// ErrPriceLocked is used when changing the price of a canceled job
+	ErrPriceLocked = errors.New("The price of canceled jobs can't be changed")
+
+	// ErrNotDeletable is used when deleting a job that was already queued
+	// Jobs that went to the queue have a history and must be canceled instead.
+	ErrNotDeletable = errors.New("Only jobs that weren't queued yet can be deleted")
+
+	// ErrHasGoods is used when deleting a job with goods
+	ErrHasGoods = errors.New("Jobs with goods can't be deleted")
+
+	// ErrInvoiced is used when deleting a job that is on an invoice
+	// Invoices keep their lines, so the job must be canceled instead.
+	ErrInvoiced = errors.New("Jobs on invoices can't be deleted")
+)
+
+// Drift between the price_total stored on an order and the sum of its jobs
+type Drift struct {
+	OrderID  string
+	Stored   int64
+	Computed int64
+}
+
+// Difference of the stored price from the computed one
+func (d Drift) Difference() int64 {
+	return d.Stored - d.Computed
+}
+
+// orderPriceQuery sums the prices of the jobs of an order, except the canceled ones
+const orderPriceQuery = "SELECT IFNULL(SUM(price), 0) FROM `job` WHERE order_id = ? AND status <> 'CANCELED'"
+
+// RecomputeOrderPriceTx sets the price_total of an order to the sum of the
+// prices of its jobs that weren't canceled
+// It is called within the transaction of every job change affecting it.
+func RecomputeOrderPriceTx(ctx context.Context, tx *sql.Tx, orderID string) error {
+	var total int64
+
+	if err := tx.QueryRowContext(ctx, orderPriceQuery, orderID).Scan(&total); err != nil {
+		return errwrap.Wrapf("Error computing order price_total: {{err}}", err)
+	}
+
+	_, err := tx.ExecContext(ctx, "UPDATE `order` SET price_total = ? WHERE order_id = ?", total, orderID)
+
+	if err != nil {
+		return errwrap.Wrapf("Error updating order price_total: {{err}}", err)
+	}
+
+	return nil
+}
+
+// UpdatePriceTx updates the price of a job within a transaction, recomputing
+// the price_total of its order
+func UpdatePriceTx(ctx context.Context, tx *sql.Tx, jobID string, price int64) error {
+	orderID, status, err := LockTx(ctx, tx, jobID)
+
+	if err != nil {
+		return err
+	}
+
+	if status == "CANCELED" {
+		return ErrPriceLocked
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE `job` SET price = ? WHERE job_id = ?", price, jobID); err != nil {
+		return errwrap.Wrapf("Error updating job price: {{err}}", err)
+	}
+
+	return RecomputeOrderPriceTx(ctx, tx, orderID)
+}
+
+// DeleteTx deletes a job that wasn't queued yet within a transaction, with its
+// lines, names and schedule, recomputing the price_total of its order
+func DeleteTx(ctx context.Context, tx *sql.Tx, jobID string) error {
+	orderID, status, err := LockTx(ctx, tx, jobID)
+
+	if err != nil {
+		return err
+	}
+
+	if status != "CREATED" {
+		return ErrNotDeletable
+	}
+
+	var goods int
+
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM goods WHERE job_id = ?", jobID).Scan(&goods); err != nil {
+		return errwrap.Wrapf("Error querying job goods: {{err}}", err)
+	}
+
+	if goods != 0 {
+		return ErrHasGoods
+	}
+
+	var invoiced int
+
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM invoice_line WHERE job_id = ?", jobID).Scan(&invoiced); err != nil {
+		return errwrap.Wrapf("Error querying job invoice lines: {{err}}", err)
+	}
+
+	if invoiced != 0 {
+		return ErrInvoiced
+	}
+
+	for _, table := range []string{"job_line", "personalization_name", "personalization", "late_job", "schedule_slot", "job"} {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM `"+table+"` WHERE job_id = ?", jobID); err != nil {
+			return errwrap.Wrapf("Error deleting job: {{err}}", err)
+		}
+	}
+
+	return RecomputeOrderPriceTx(ctx, tx, orderID)
+}
+
+// ListOrderPriceDrift lists the orders whose price_total differs from the sum
+// of the prices of their jobs
+func ListOrderPriceDrift(ctx context.Context) (drifts []Drift, err error) {
+	rows, err := db().QueryContext(ctx, `SELECT o.order_id, o.price_total,
+IFNULL(SUM(CASE WHEN j.status <> 'CANCELED' THEN j.price END), 0) AS computed
+FROM `+"`order`"+` o LEFT JOIN job j ON j.order_id = o.order_id
+GROUP BY o.order_id, o.price_total
+HAVING o.price_total <> computed
+ORDER BY o.order_id`)
+
+	if err != nil {
+		return nil, errwrap.Wrapf("Error querying order price drift: {{err}}", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var d Drift
+
+		if err := rows.Scan(&d.OrderID, &d.Stored, &d.Computed); err != nil {
+			return nil, errwrap.Wrapf("Error scanning order price drift rows: {{err}}", err)
+		}
+
+		drifts = append(drifts, d)
+	}
+
+	return drifts, rows.Err()
+}
+
+// RecomputeOrderPrice of an order on its own transaction
+func RecomputeOrderPrice(ctx context.Context, orderID string) error {
+	tx, err := db().BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	// lock the order so it doesn't change while its jobs are summed
+	err = tx.QueryRowContext(ctx, "SELECT order_id FROM `order` WHERE order_id = ? FOR UPDATE",
+		orderID).Scan(&orderID)
+
+	if err != nil {
+		return errwrap.Wrapf("Error locking order: {{err}}", err)
+	}
+
+	if err := RecomputeOrderPriceTx(ctx, tx, orderID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,193 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/kisielk/sqlstruct"
+)
+
+// ErrSessionOpen is used when a job is started while someone is working on it
+var ErrSessionOpen = errors.New("Job is already being worked on")
+
+// ErrNoOpenSession is used when a job nobody is working on is paused
+var ErrNoOpenSession = errors.New("Job isn't being worked on")
+
+// ErrInvalidReason is used when a job is paused without a known reason
+var ErrInvalidReason = errors.New("Invalid pause reason")
+
+// PauseReasons for stopping work on a job
+var PauseReasons = []string{
+	"THREAD_BREAK",
+	"BOBBIN_CHANGE",
+	"NEEDLE_BREAK",
+	"MACHINE_PROBLEM",
+	"END_OF_SHIFT",
+	"OTHER",
+}
+
+// Session of work on a job by an employee, on a machine
+// Sessions are closed by a pause reason or the final status of the job.
+type Session struct {
+	WorkSessionID int64
+	JobID         string
+	EmployeeID    string
+	EmployeeEmail *string
+	MachineID     string
+	StartTime     string
+	EndTime       *string
+	EndReason     *string
+	Seconds       int64
+}
+
+// Open tells if the session is still running
+func (s Session) Open() bool {
+	return s.EndTime == nil
+}
+
+// ValidPauseReason tells if a reason can be used to pause a job
+func ValidPauseReason(reason string) bool {
+	for _, r := range PauseReasons {
+		if r == strings.ToUpper(reason) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// StartTx starts working on a job within a transaction, opening a session for
+// the employee
+// Queued jobs move to IN_PROGRESS. Paused jobs are resumed.
+func StartTx(ctx context.Context, tx *sql.Tx, jobID, employeeID string) error {
+	var machineID string
+
+	_, status, err := LockTx(ctx, tx, jobID)
+
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRowContext(ctx, "SELECT machine_id FROM `job` WHERE job_id = ?", jobID).Scan(&machineID)
+
+	if err != nil {
+		return errwrap.Wrapf("Error querying job machine: {{err}}", err)
+	}
+
+	switch status {
+	case "QUEUE":
+		if err := UpdateStatusTx(ctx, tx, jobID, "IN_PROGRESS", employeeID); err != nil {
+			return err
+		}
+	case "IN_PROGRESS":
+	default:
+		return ErrInvalidTransition
+	}
+
+	var open int
+
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM work_session WHERE job_id = ? AND end_time IS NULL",
+		jobID).Scan(&open)
+
+	if err != nil {
+		return errwrap.Wrapf("Error querying open work sessions: {{err}}", err)
+	}
+
+	if open != 0 {
+		return ErrSessionOpen
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO work_session (job_id, employee_id, machine_id) VALUES (?, ?, ?)",
+		jobID, employeeID, machineID)
+
+	if err != nil {
+		return errwrap.Wrapf("Error inserting work session: {{err}}", err)
+	}
+
+	return nil
+}
+
+// PauseTx pauses working on a job within a transaction, closing its open
+// session with a reason
+func PauseTx(ctx context.Context, tx *sql.Tx, jobID, reason string) error {
+	if !ValidPauseReason(reason) {
+		return ErrInvalidReason
+	}
+
+	if _, _, err := LockTx(ctx, tx, jobID); err != nil {
+		return err
+	}
+
+	n, err := closeSessionsTx(ctx, tx, jobID, strings.ToUpper(reason))
+
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrNoOpenSession
+	}
+
+	return nil
+}
+
+func closeSessionsTx(ctx context.Context, tx *sql.Tx, jobID, reason string) (int64, error) {
+	res, err := tx.ExecContext(ctx,
+		"UPDATE work_session SET end_time = CURRENT_TIMESTAMP, end_reason = ? WHERE job_id = ? AND end_time IS NULL",
+		reason, jobID)
+
+	if err != nil {
+		return 0, errwrap.Wrapf("Error closing work sessions: {{err}}", err)
+	}
+
+	return res.RowsAffected()
+}
+
+// ListSessions of a job, oldest first
+// Seconds of open sessions are counted up to now.
+func ListSessions(ctx context.Context, jobID string) (sessions []Session, err error) {
+	stmt, err := db().PrepareContext(ctx, `SELECT s.work_session_id,s.job_id,s.employee_id,
+a.email AS employee_email,s.machine_id,s.start_time,s.end_time,s.end_reason,
+TIMESTAMPDIFF(SECOND, s.start_time, IFNULL(s.end_time, CURRENT_TIMESTAMP)) AS seconds
+FROM work_session s LEFT JOIN authentication a ON a.employee_id = s.employee_id
+WHERE s.job_id = ? ORDER BY s.work_session_id`)
+
+	if err != nil {
+		return nil, errwrap.Wrapf("Error preparing work session query: {{err}}", err)
+	}
+
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, jobID)
+
+	if err != nil {
+		return nil, errwrap.Wrapf("Error querying work sessions: {{err}}", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var s Session
+
+		if err := sqlstruct.Scan(&s, rows); err != nil {
+			return nil, errwrap.Wrapf("Error scanning work session rows: {{err}}", err)
+		}
+
+		sessions = append(sessions, s)
+	}
+
+	return sessions, rows.Err()
+}
+
+// ActiveSeconds worked on sessions
+func ActiveSeconds(sessions []Session) (seconds int64) {
+	for _, s := range sessions {
+		seconds += s.Seconds
+	}
+
+	return seconds
+}
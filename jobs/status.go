@@ -0,0 +1,194 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/kisielk/sqlstruct"
+)
+
+// ErrInvalidTransition is used when a job can't move to the requested status
+var ErrInvalidTransition = errors.New("Invalid job status transition")
+
+// transitions of the status of a job
+// Sewed jobs can go through quality control (QC) before they are DONE, and
+// back to IN_PROGRESS if they need more work. Jobs on QC are only DONE when
+// inspected (see FinishQCTx). DONE and CANCELED are final.
+var transitions = map[string][]string{
+	"CREATED":     {"QUEUE", "CANCELED"},
+	"QUEUE":       {"IN_PROGRESS", "CANCELED"},
+	"IN_PROGRESS": {"QC", "DONE", "CANCELED"},
+	"QC":          {"IN_PROGRESS", "CANCELED"},
+}
+
+// Event of a status transition of a job
+type Event struct {
+	JobID         string
+	FromStatus    string
+	ToStatus      string
+	EmployeeID    string
+	EmployeeEmail *string
+	Time          string
+}
+
+// NextStatus lists the statuses a job can move to from a status
+func NextStatus(status string) []string {
+	return transitions[strings.ToUpper(status)]
+}
+
+// CanTransition tells if a job can move from a status to another
+func CanTransition(from, to string) bool {
+	for _, s := range NextStatus(from) {
+		if s == strings.ToUpper(to) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// UpdateStatus of a job, recording the transition as a job event
+// ErrInvalidTransition is returned for transitions not on the graph
+func UpdateStatus(ctx context.Context, jobID, status, employeeID string) error {
+	tx, err := db().BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := UpdateStatusTx(ctx, tx, jobID, status, employeeID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateStatusTx updates the status of a job within a transaction
+func UpdateStatusTx(ctx context.Context, tx *sql.Tx, jobID, status, employeeID string) error {
+	return updateStatusTx(ctx, tx, jobID, strings.ToUpper(status), employeeID, CanTransition)
+}
+
+// FinishQCTx moves a job on quality control to DONE within a transaction
+// It is only used when recording the inspection of the job, so jobs don't
+// leave quality control without their counts.
+func FinishQCTx(ctx context.Context, tx *sql.Tx, jobID, employeeID string) error {
+	return updateStatusTx(ctx, tx, jobID, "DONE", employeeID, func(from, to string) bool {
+		return from == "QC"
+	})
+}
+
+func updateStatusTx(ctx context.Context, tx *sql.Tx, jobID, to, employeeID string, allowed func(from, to string) bool) error {
+	// lock the job row so concurrent transitions are serialized
+	orderID, from, err := LockTx(ctx, tx, jobID)
+
+	if err != nil {
+		return err
+	}
+
+	if !allowed(from, to) {
+		return ErrInvalidTransition
+	}
+
+	var q = "UPDATE `job` SET status = ?"
+
+	switch to {
+	case "IN_PROGRESS":
+		q += ", start_time = IFNULL(start_time, CURRENT_TIMESTAMP)"
+	case "DONE":
+		q += ", end_time = CURRENT_TIMESTAMP"
+	}
+
+	if _, err := tx.ExecContext(ctx, q+" WHERE job_id = ?", to, jobID); err != nil {
+		return errwrap.Wrapf("Error updating job status: {{err}}", err)
+	}
+
+	// jobs leaving the machine aren't being worked on anymore
+	if to == "QC" || to == "DONE" || to == "CANCELED" {
+		if _, err := closeSessionsTx(ctx, tx, jobID, to); err != nil {
+			return err
+		}
+	}
+
+	// canceled jobs aren't charged
+	if to == "CANCELED" {
+		if err := RecomputeOrderPriceTx(ctx, tx, orderID); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO job_event (job_id, from_status, to_status, employee_id) VALUES (?, ?, ?, ?)",
+		jobID, from, to, employeeID)
+
+	if err != nil {
+		return errwrap.Wrapf("Error inserting job event: {{err}}", err)
+	}
+
+	return nil
+}
+
+// LockTx locks the order of a job and then the job, returning their IDs and status
+// Orders are always locked before their jobs (see orders.UpdateStatusTx), so
+// transactions changing both don't deadlock.
+func LockTx(ctx context.Context, tx *sql.Tx, jobID string) (orderID, status string, err error) {
+	// the order of a job never changes, so it's safe to read it before locking
+	err = tx.QueryRowContext(ctx, "SELECT order_id FROM `job` WHERE job_id = ?", jobID).Scan(&orderID)
+
+	if err != nil {
+		return "", "", errwrap.Wrapf("Error querying job order: {{err}}", err)
+	}
+
+	err = tx.QueryRowContext(ctx, "SELECT order_id FROM `order` WHERE order_id = ? FOR UPDATE",
+		orderID).Scan(&orderID)
+
+	if err != nil {
+		return "", "", errwrap.Wrapf("Error locking order: {{err}}", err)
+	}
+
+	err = tx.QueryRowContext(ctx, "SELECT status FROM `job` WHERE job_id = ? FOR UPDATE", jobID).Scan(&status)
+
+	if err != nil {
+		return "", "", errwrap.Wrapf("Error querying job status: {{err}}", err)
+	}
+
+	return orderID, status, nil
+}
+
+// ListEvents of a job, oldest first
+func ListEvents(ctx context.Context, jobID string) (events []Event, err error) {
+	stmt, err := db().PrepareContext(ctx, `SELECT e.job_id,e.from_status,e.to_status,e.employee_id,
+a.email AS employee_email,e.time
+FROM job_event e LEFT JOIN authentication a ON a.employee_id = e.employee_id
+WHERE e.job_id = ? ORDER BY e.job_event_id`)
+
+	if err != nil {
+		return nil, errwrap.Wrapf("Error preparing job event query: {{err}}", err)
+	}
+
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, jobID)
+
+	if err != nil {
+		return nil, errwrap.Wrapf("Error querying job events: {{err}}", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var e Event
+
+		if err := sqlstruct.Scan(&e, rows); err != nil {
+			return nil, errwrap.Wrapf("Error scanning job event rows: {{err}}", err)
+		}
+
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
@@ -0,0 +1,108 @@
+package lettering
+
+import (
+	"strconv"
+	"strings"
+)
+
+// the bundled font is a single stroke block font drawn on a grid with the cap
+// height of 10 units and the y axis growing downwards (0 is the cap line and
+// 10 the baseline). Each glyph is a list of polylines separated by "|",
+// which are sewed as satin columns.
+
+type point struct {
+	x, y float64
+}
+
+type glyph struct {
+	width   float64
+	strokes [][]point
+}
+
+// capHeight of the grid of the font
+const capHeight = 10
+
+// spacing between glyphs, in grid units
+const spacing = 2.5
+
+var glyphSources = map[rune]struct {
+	width   float64
+	strokes string
+}{
+	'A':  {8, "0,10 4,0 8,10 | 1.6,6 6.4,6"},
+	'B':  {7, "0,10 0,0 5,0 6.5,1.2 6.5,3.8 5,5 0,5 | 5,5 7,6.2 7,8.8 5.5,10 0,10"},
+	'C':  {7, "7,1.5 5.5,0 2,0 0,2 0,8 2,10 5.5,10 7,8.5"},
+	'D':  {7, "0,0 0,10 4,10 7,7 7,3 4,0 0,0"},
+	'E':  {6, "6,0 0,0 0,10 6,10 | 0,5 4.5,5"},
+	'F':  {6, "6,0 0,0 0,10 | 0,5 4.5,5"},
+	'G':  {7, "7,1.5 5.5,0 2,0 0,2 0,8 2,10 5.5,10 7,8.5 7,5.5 4,5.5"},
+	'H':  {7, "0,0 0,10 | 7,0 7,10 | 0,5 7,5"},
+	'I':  {2, "1,0 1,10"},
+	'J':  {6, "6,0 6,8 4,10 2,10 0,8"},
+	'K':  {7, "0,0 0,10 | 7,0 0,6 | 2,4.5 7,10"},
+	'L':  {6, "0,0 0,10 6,10"},
+	'M':  {9, "0,10 0,0 4.5,7 9,0 9,10"},
+	'N':  {7, "0,10 0,0 7,10 7,0"},
+	'O':  {8, "2,0 6,0 8,2 8,8 6,10 2,10 0,8 0,2 2,0"},
+	'P':  {7, "0,10 0,0 5,0 7,1.5 7,3.5 5,5 0,5"},
+	'Q':  {8, "2,0 6,0 8,2 8,8 6,10 2,10 0,8 0,2 2,0 | 5,7 8,10.5"},
+	'R':  {7, "0,10 0,0 5,0 7,1.5 7,3.5 5,5 0,5 | 4,5 7,10"},
+	'S':  {7, "7,1.5 5.5,0 1.5,0 0,1.5 0,3.5 1.5,5 5.5,5 7,6.5 7,8.5 5.5,10 1.5,10 0,8.5"},
+	'T':  {8, "0,0 8,0 | 4,0 4,10"},
+	'U':  {7, "0,0 0,8 2,10 5,10 7,8 7,0"},
+	'V':  {8, "0,0 4,10 8,0"},
+	'W':  {10, "0,0 2.5,10 5,3 7.5,10 10,0"},
+	'X':  {7, "0,0 7,10 | 7,0 0,10"},
+	'Y':  {8, "0,0 4,5 8,0 | 4,5 4,10"},
+	'Z':  {7, "0,0 7,0 0,10 7,10"},
+	'0':  {6, "1.5,0 4.5,0 6,1.5 6,8.5 4.5,10 1.5,10 0,8.5 0,1.5 1.5,0"},
+	'1':  {4, "0,2 2.5,0 2.5,10"},
+	'2':  {6, "0,1.5 1.5,0 4.5,0 6,1.5 6,3.5 0,10 6,10"},
+	'3':  {6, "0,1 1.5,0 4.5,0 6,1.5 6,3.5 4.5,5 2,5 | 4.5,5 6,6.5 6,8.5 4.5,10 1.5,10 0,9"},
+	'4':  {7, "5,10 5,0 0,7 7,7"},
+	'5':  {6, "6,0 0.5,0 0,4.5 4.5,4.5 6,6 6,8.5 4.5,10 1.5,10 0,9"},
+	'6':  {6, "5.5,0 2,0 0,2.5 0,8.5 1.5,10 4.5,10 6,8.5 6,6.5 4.5,5 0,5"},
+	'7':  {6, "0,0 6,0 2,10"},
+	'8':  {6, "1.5,5 0,3.5 0,1.5 1.5,0 4.5,0 6,1.5 6,3.5 4.5,5 1.5,5 0,6.5 0,8.5 1.5,10 4.5,10 6,8.5 6,6.5 4.5,5"},
+	'9':  {6, "6,5 1.5,5 0,3.5 0,1.5 1.5,0 4.5,0 6,1.5 6,7.5 4,10 0.5,10"},
+	'-':  {5, "0.5,5.5 4.5,5.5"},
+	'.':  {1, "0.5,9 0.5,10"},
+	'\'': {1, "0.5,0 0.5,2.5"},
+	'&':  {8, "8,10 1.5,3 1.5,1.5 3,0 4.5,0 5.5,1.5 5.5,2.5 0,7 0,8.5 1.5,10 4,10 7,6"},
+	' ':  {4, ""},
+}
+
+var font = map[rune]glyph{}
+
+func init() {
+	for r, src := range glyphSources {
+		font[r] = glyph{
+			width:   src.width,
+			strokes: parseStrokes(src.strokes),
+		}
+	}
+}
+
+func parseStrokes(s string) (strokes [][]point) {
+	for _, polyline := range strings.Split(s, "|") {
+		var stroke []point
+
+		for _, pair := range strings.Fields(polyline) {
+			var xy = strings.Split(pair, ",")
+			x, errX := strconv.ParseFloat(xy[0], 64)
+			y, errY := strconv.ParseFloat(xy[1], 64)
+
+			if errX != nil || errY != nil {
+				panic("lettering: invalid glyph point " + pair)
+			}
+
+			stroke = append(stroke, point{x, y})
+		}
+
+		if len(stroke) != 0 {
+			strokes = append(strokes, stroke)
+		}
+	}
+
+	return strokes
+}
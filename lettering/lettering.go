@@ -0,0 +1,247 @@
+package lettering
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/henvic/embroidery/stitch"
+)
+
+// lettering turns text into a stitch pattern using the bundled font.
+// Strokes are sewed as satin columns over a center run underlay, with tie-in
+// and tie-off stitches so each stroke can be trimmed.
+
+// MinHeight and MaxHeight of the letters, in mm
+const (
+	MinHeight = 5
+	MaxHeight = 100
+)
+
+const (
+	// density is the distance between the satin stitches, in mm
+	density = 0.4
+
+	// runLength is the length of the underlay stitches, in mm
+	runLength = 2.0
+
+	// lockLength is the length of the tie-in and tie-off stitches, in mm
+	lockLength = 0.4
+
+	// trimDistance is the shortest jump trimmed between strokes, in mm
+	trimDistance = 2.0
+)
+
+// DefaultThread used when the options don't set one
+var DefaultThread = stitch.Thread{
+	Color: "#000000",
+	Name:  "Black",
+}
+
+// UnsupportedCharacterError is used when the text has characters missing on
+// the font
+type UnsupportedCharacterError struct {
+	Rune rune
+}
+
+func (u UnsupportedCharacterError) Error() string {
+	return fmt.Sprintf("Character %q isn't available on the lettering font", u.Rune)
+}
+
+// Options of the lettering. Sizes are in mm
+// X and Y are the center of the text, from the center of the hoop.
+type Options struct {
+	Height float64
+	X      float64
+	Y      float64
+	Thread stitch.Thread
+}
+
+var accents = strings.NewReplacer(
+	"Á", "A", "À", "A", "Â", "A", "Ã", "A", "Ä", "A",
+	"É", "E", "È", "E", "Ê", "E", "Ë", "E",
+	"Í", "I", "Ì", "I", "Î", "I", "Ï", "I",
+	"Ó", "O", "Ò", "O", "Ô", "O", "Õ", "O", "Ö", "O",
+	"Ú", "U", "Ù", "U", "Û", "U", "Ü", "U",
+	"Ç", "C", "Ñ", "N",
+)
+
+// Normalize text to the characters of the font: upper case, without accents
+// and with single spaces
+func Normalize(text string) string {
+	return accents.Replace(strings.Join(strings.Fields(strings.ToUpper(text)), " "))
+}
+
+// Check tells if the text can be lettered with the font
+func Check(text string) error {
+	var n = Normalize(text)
+
+	if n == "" {
+		return fmt.Errorf("Missing text")
+	}
+
+	for _, r := range n {
+		if _, ok := font[r]; !ok {
+			return UnsupportedCharacterError{r}
+		}
+	}
+
+	return nil
+}
+
+// Width of the lettering of a text, in mm
+func Width(text string, height float64) float64 {
+	var units float64
+
+	for i, r := range Normalize(text) {
+		if i != 0 {
+			units += spacing
+		}
+
+		units += font[r].width
+	}
+
+	return units * height / capHeight
+}
+
+// Generate a satin stitch pattern for the text
+func Generate(text string, o Options) (*stitch.Pattern, error) {
+	if err := Check(text); err != nil {
+		return nil, err
+	}
+
+	if o.Height < MinHeight || o.Height > MaxHeight {
+		return nil, fmt.Errorf("Letter height must be between %v and %v mm", MinHeight, MaxHeight)
+	}
+
+	var normalized = Normalize(text)
+	var scale = o.Height / capHeight
+	var left = o.X - Width(normalized, o.Height)/2
+	var top = o.Y - o.Height/2
+
+	// satin columns are about a seventh of the letter height
+	var columnWidth = math.Min(math.Max(o.Height/7, 1), 4)
+
+	var b builder
+	var cursor float64
+
+	for _, r := range normalized {
+		var g = font[r]
+
+		for _, s := range g.strokes {
+			var pts = make([]point, len(s))
+
+			for i, p := range s {
+				pts[i] = point{left + (cursor+p.x)*scale, top + p.y*scale}
+			}
+
+			b.satin(pts, columnWidth)
+		}
+
+		cursor += g.width + spacing
+	}
+
+	b.add(b.pos, stitch.End)
+
+	var thread = o.Thread
+
+	if thread.Color == "" {
+		thread = DefaultThread
+	}
+
+	return &stitch.Pattern{
+		Format:   "dst",
+		Label:    normalized,
+		Stitches: b.stitches,
+		Threads:  []stitch.Thread{thread},
+	}, nil
+}
+
+type builder struct {
+	stitches []stitch.Stitch
+	pos      point
+	started  bool
+}
+
+func (b *builder) add(p point, c stitch.Command) {
+	b.stitches = append(b.stitches, stitch.Stitch{
+		X:       int(math.Round(p.x * 10)),
+		Y:       int(math.Round(p.y * 10)),
+		Command: c,
+	})
+
+	b.pos = p
+}
+
+// moveTo the start of a stroke, trimming the thread for long jumps
+func (b *builder) moveTo(p point) {
+	if b.started && distance(b.pos, p) >= trimDistance {
+		b.add(b.pos, stitch.Trim)
+	}
+
+	b.started = true
+	b.add(p, stitch.Jump)
+}
+
+// lock the thread with a short stitch back and forth
+func (b *builder) lock(from, toward point) {
+	var d = distance(from, toward)
+
+	b.add(from, stitch.Normal)
+
+	if d != 0 {
+		var t = math.Min(lockLength/d, 1)
+		b.add(point{from.x + (toward.x-from.x)*t, from.y + (toward.y-from.y)*t}, stitch.Normal)
+	}
+
+	b.add(from, stitch.Normal)
+}
+
+func (b *builder) satin(pts []point, width float64) {
+	if len(pts) < 2 {
+		return
+	}
+
+	b.moveTo(pts[0])
+	b.lock(pts[0], pts[1])
+
+	// center run underlay to the end of the stroke
+	for i := 1; i < len(pts); i++ {
+		var n = math.Max(1, math.Ceil(distance(pts[i-1], pts[i])/runLength))
+
+		for k := 1.0; k <= n; k++ {
+			b.add(lerp(pts[i-1], pts[i], k/n), stitch.Normal)
+		}
+	}
+
+	// satin zigzag back to the start
+	var side = 1.0
+
+	for i := len(pts) - 1; i > 0; i-- {
+		var a, z = pts[i], pts[i-1]
+		var l = distance(a, z)
+
+		if l == 0 {
+			continue
+		}
+
+		var nx, ny = -(z.y - a.y) / l, (z.x - a.x) / l
+		var n = math.Max(1, math.Ceil(l/density))
+
+		for k := 0.0; k <= n; k++ {
+			var c = lerp(a, z, k/n)
+			b.add(point{c.x + nx*side*width/2, c.y + ny*side*width/2}, stitch.Normal)
+			side = -side
+		}
+	}
+
+	b.lock(pts[0], pts[1])
+}
+
+func distance(a, b point) float64 {
+	return math.Hypot(b.x-a.x, b.y-a.y)
+}
+
+func lerp(a, b point, t float64) point {
+	return point{a.x + (b.x-a.x)*t, a.y + (b.y-a.y)*t}
+}
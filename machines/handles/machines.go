@@ -0,0 +1,235 @@
+package machineshandles
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	schema "github.com/gorilla/Schema"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+	"github.com/henvic/embroidery/handles"
+	"github.com/henvic/embroidery/machines"
+	"github.com/henvic/embroidery/schedule"
+	"github.com/henvic/embroidery/server"
+	"github.com/henvic/embroidery/sitetemplate"
+	"github.com/henvic/embroidery/stitch"
+)
+
+var router = server.Instance.Mux
+
+func init() {
+	router().Handle("/machines", handles.AuthenticatedHandler(machinesHandler))
+	router().Handle("/machines/add", handles.AuthenticatedHandler(machineAddHandler))
+	router().Handle("/machines/{machine_id}", handles.AuthenticatedHandler(machineEditHandler))
+}
+
+// formats a machine can be set to read
+var formats = []string{"dst", "pes", "pec", "exp"}
+
+type machineForm struct {
+	Name               string   `schema:"name"`
+	Brand              string   `schema:"brand"`
+	Heads              int      `schema:"heads"`
+	Needles            int      `schema:"needles"`
+	MaxHoopWidth       float64  `schema:"max_hoop_width"`
+	MaxHoopHeight      float64  `schema:"max_hoop_height"`
+	Formats            []string `schema:"formats"`
+	StitchesPerMinute  int      `schema:"stitches_per_minute"`
+	ColorChangeSeconds float64  `schema:"color_change_seconds"`
+	TrimSeconds        float64  `schema:"trim_seconds"`
+	JumpSeconds        float64  `schema:"jump_seconds"`
+	Active             bool     `schema:"active"`
+}
+
+func machinesHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	var showInactive = (r.URL.Query().Get("showInactive") != "")
+
+	ms, err := machines.List(r.Context(), machines.ListFilter{
+		ShowInactive: showInactive,
+	})
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	var t = sitetemplate.Template{
+		Title:     "Machines",
+		Section:   "machines",
+		Filenames: []string{"gui/machines/list.html"},
+		Data: map[string]interface{}{
+			"Machines":     ms,
+			"ShowInactive": showInactive,
+		},
+		Request:        r,
+		ResponseWriter: w,
+	}
+
+	t.Respond()
+}
+
+func machineAddHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	switch r.Method {
+	case http.MethodGet:
+		machineFormHandler(w, r, machines.Machine{
+			Heads:   1,
+			Needles: 1,
+			Formats: "dst",
+			Active:  true,
+		})
+	case http.MethodPost:
+		m, err := decodeMachine(r)
+
+		if err != nil {
+			handles.ErrorHandler(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if _, err := machines.Insert(r.Context(), m); err != nil {
+			handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+			return
+		}
+
+		http.Redirect(w, r, "/machines", http.StatusSeeOther)
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func machineEditHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	vars := mux.Vars(r)
+	machineID, ok := vars["machine_id"]
+
+	if !ok {
+		handles.ErrorHandler(w, r, "Missing machine ID parameter", http.StatusBadRequest)
+		return
+	}
+
+	m, err := machines.Get(r.Context(), machineID)
+
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		handles.ErrorHandler(w, r, "Machine not found", http.StatusNotFound)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		machineFormHandler(w, r, m)
+	case http.MethodPost:
+		updated, err := decodeMachine(r)
+
+		if err != nil {
+			handles.ErrorHandler(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		updated.MachineID = m.MachineID
+
+		if err := machines.Update(r.Context(), updated); err != nil {
+			handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+			return
+		}
+
+		if err := schedule.Recompute(r.Context()); err != nil {
+			handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+			return
+		}
+
+		http.Redirect(w, r, "/machines", http.StatusSeeOther)
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func machineFormHandler(w http.ResponseWriter, r *http.Request, m machines.Machine) {
+	var title = "Add a machine"
+
+	if m.MachineID != "" {
+		title = fmt.Sprintf("Machine %v", m.Name)
+	}
+
+	var t = sitetemplate.Template{
+		Title:     title,
+		Section:   "machines",
+		Filenames: []string{"gui/machines/edit.html"},
+		Data: map[string]interface{}{
+			"Machine": m,
+			"Formats": formats,
+		},
+		Request:        r,
+		ResponseWriter: w,
+	}
+
+	t.Respond()
+}
+
+func decodeMachine(r *http.Request) (machines.Machine, error) {
+	if err := r.ParseForm(); err != nil {
+		return machines.Machine{}, fmt.Errorf("Invalid form")
+	}
+
+	decoder := schema.NewDecoder()
+	mf := machineForm{}
+
+	if err := decoder.Decode(&mf, r.PostForm); err != nil {
+		return machines.Machine{}, fmt.Errorf("Error decoding request body: %v", err)
+	}
+
+	if strings.TrimSpace(mf.Name) == "" {
+		return machines.Machine{}, fmt.Errorf("Missing machine name")
+	}
+
+	if mf.Heads < 1 || mf.Needles < 1 {
+		return machines.Machine{}, fmt.Errorf("A machine needs at least one head and one needle")
+	}
+
+	if mf.StitchesPerMinute < 1 {
+		return machines.Machine{}, fmt.Errorf("Invalid speed")
+	}
+
+	if mf.MaxHoopWidth <= 0 || mf.MaxHoopHeight <= 0 {
+		return machines.Machine{}, fmt.Errorf("Invalid hoop size")
+	}
+
+	if mf.ColorChangeSeconds < 0 || mf.TrimSeconds < 0 || mf.JumpSeconds < 0 {
+		return machines.Machine{}, fmt.Errorf("Invalid speed profile")
+	}
+
+	for _, f := range mf.Formats {
+		if !stitch.Readable(f) {
+			return machines.Machine{}, fmt.Errorf("Unknown file format %q", f)
+		}
+	}
+
+	if len(mf.Formats) == 0 {
+		return machines.Machine{}, fmt.Errorf("A machine must read at least one file format")
+	}
+
+	return machines.Machine{
+		Name:               strings.TrimSpace(mf.Name),
+		Brand:              strings.TrimSpace(mf.Brand),
+		Heads:              mf.Heads,
+		Needles:            mf.Needles,
+		MaxHoopWidth:       mf.MaxHoopWidth,
+		MaxHoopHeight:      mf.MaxHoopHeight,
+		Formats:            strings.Join(mf.Formats, ","),
+		StitchesPerMinute:  mf.StitchesPerMinute,
+		ColorChangeSeconds: mf.ColorChangeSeconds,
+		TrimSeconds:        mf.TrimSeconds,
+		JumpSeconds:        mf.JumpSeconds,
+		Active:             mf.Active,
+	}, nil
+}
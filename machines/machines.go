@@ -0,0 +1,255 @@
+package machines
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/henvic/embroidery/asset"
+	"github.com/henvic/embroidery/estimate"
+	"github.com/henvic/embroidery/server"
+	"github.com/kisielk/sqlstruct"
+	uuid "github.com/satori/go.uuid"
+)
+
+var db = server.Instance.DB
+
+// Machine used for sewing jobs
+// Hoop sizes are in mm
+type Machine struct {
+	MachineID          string  `schema:"machine_id"`
+	Name               string  `schema:"name"`
+	Brand              string  `schema:"brand"`
+	Heads              int     `schema:"heads"`
+	Needles            int     `schema:"needles"`
+	MaxHoopWidth       float64 `schema:"max_hoop_width"`
+	MaxHoopHeight      float64 `schema:"max_hoop_height"`
+	Formats            string  `schema:"-"`
+	StitchesPerMinute  int     `schema:"stitches_per_minute"`
+	ColorChangeSeconds float64 `schema:"color_change_seconds"`
+	TrimSeconds        float64 `schema:"trim_seconds"`
+	JumpSeconds        float64 `schema:"jump_seconds"`
+	Active             bool    `schema:"active"`
+}
+
+// FormatList of the stitch file formats the machine reads
+func (m Machine) FormatList() []string {
+	if m.Formats == "" {
+		return nil
+	}
+
+	return strings.Split(m.Formats, ",")
+}
+
+// Supports tells if the machine reads a stitch file format
+func (m Machine) Supports(format string) bool {
+	for _, f := range m.FormatList() {
+		if f == strings.ToLower(format) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Fits tells if a design fits in the largest hoop of the machine
+// Designs can be rotated to fit.
+func (m Machine) Fits(d asset.Design) bool {
+	var w, h = d.Width(), d.Height()
+
+	return (w <= m.MaxHoopWidth && h <= m.MaxHoopHeight) ||
+		(h <= m.MaxHoopWidth && w <= m.MaxHoopHeight)
+}
+
+// Profile of the speed of the machine
+func (m Machine) Profile() estimate.Profile {
+	return estimate.Profile{
+		Heads:              m.Heads,
+		StitchesPerMinute:  m.StitchesPerMinute,
+		ColorChangeSeconds: m.ColorChangeSeconds,
+		TrimSeconds:        m.TrimSeconds,
+		JumpSeconds:        m.JumpSeconds,
+	}
+}
+
+// ListFilter sets the filter settings
+type ListFilter struct {
+	ShowInactive bool
+}
+
+const columns = `machine_id,name,brand,heads,needles,max_hoop_width,max_hoop_height,formats,
+stitches_per_minute,color_change_seconds,trim_seconds,jump_seconds,active`
+
+// List machines
+func List(ctx context.Context, f ListFilter) (machines []Machine, err error) {
+	var q = "SELECT " + columns + " FROM machine"
+
+	if !f.ShowInactive {
+		q += " WHERE active = 1"
+	}
+
+	q += " ORDER BY name"
+
+	stmt, err := db().PrepareContext(ctx, q)
+
+	if err != nil {
+		return nil, errwrap.Wrapf("Error preparing machine query: {{err}}", err)
+	}
+
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx)
+
+	if err != nil {
+		return nil, errwrap.Wrapf("Error querying machines: {{err}}", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var m Machine
+
+		if err := sqlstruct.Scan(&m, rows); err != nil {
+			return nil, errwrap.Wrapf("Error scanning machine rows: {{err}}", err)
+		}
+
+		machines = append(machines, m)
+	}
+
+	return machines, rows.Err()
+}
+
+// GetMachinesMapFromSlice creates a map of machines by ID
+func GetMachinesMapFromSlice(ms []Machine) map[string]Machine {
+	var m = map[string]Machine{}
+
+	for _, machine := range ms {
+		m[machine.MachineID] = machine
+	}
+
+	return m
+}
+
+// Get machine by ID
+func Get(ctx context.Context, machineID string) (Machine, error) {
+	stmt, err := db().PrepareContext(ctx, "SELECT "+columns+" FROM machine WHERE machine_id = ?")
+
+	if err != nil {
+		return Machine{}, errwrap.Wrapf("Error preparing machine query: {{err}}", err)
+	}
+
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, machineID)
+
+	if err != nil {
+		return Machine{}, errwrap.Wrapf("Error querying machine: {{err}}", err)
+	}
+
+	defer rows.Close()
+
+	var m Machine
+
+	if ok := rows.Next(); !ok {
+		return m, sql.ErrNoRows
+	}
+
+	if err := sqlstruct.Scan(&m, rows); err != nil {
+		return m, errwrap.Wrapf("Error scanning machine rows: {{err}}", err)
+	}
+
+	return m, nil
+}
+
+// Insert machine on database
+func Insert(ctx context.Context, m Machine) (uid string, err error) {
+	uid = uuid.NewV4().String()
+
+	stmt, err := db().PrepareContext(ctx, `INSERT INTO machine (
+		machine_id,
+		name,
+		brand,
+		heads,
+		needles,
+		max_hoop_width,
+		max_hoop_height,
+		formats,
+		stitches_per_minute,
+		color_change_seconds,
+		trim_seconds,
+		jump_seconds,
+		active
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+
+	if err != nil {
+		return "", errwrap.Wrapf("Error preparing machine insert query: {{err}}", err)
+	}
+
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx,
+		uid,
+		m.Name,
+		m.Brand,
+		m.Heads,
+		m.Needles,
+		m.MaxHoopWidth,
+		m.MaxHoopHeight,
+		m.Formats,
+		m.StitchesPerMinute,
+		m.ColorChangeSeconds,
+		m.TrimSeconds,
+		m.JumpSeconds,
+		m.Active,
+	)
+
+	if err != nil {
+		return "", err
+	}
+
+	return uid, nil
+}
+
+// Update machine
+func Update(ctx context.Context, m Machine) error {
+	stmt, err := db().PrepareContext(ctx, `UPDATE machine SET
+		name = ?,
+		brand = ?,
+		heads = ?,
+		needles = ?,
+		max_hoop_width = ?,
+		max_hoop_height = ?,
+		formats = ?,
+		stitches_per_minute = ?,
+		color_change_seconds = ?,
+		trim_seconds = ?,
+		jump_seconds = ?,
+		active = ?
+		WHERE machine_id = ?`)
+
+	if err != nil {
+		return errwrap.Wrapf("Error preparing machine update query: {{err}}", err)
+	}
+
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx,
+		m.Name,
+		m.Brand,
+		m.Heads,
+		m.Needles,
+		m.MaxHoopWidth,
+		m.MaxHoopHeight,
+		m.Formats,
+		m.StitchesPerMinute,
+		m.ColorChangeSeconds,
+		m.TrimSeconds,
+		m.JumpSeconds,
+		m.Active,
+		m.MachineID,
+	)
+
+	return err
+}
@@ -5,17 +5,40 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/henvic/embroidery/alerts"
+	"github.com/henvic/embroidery/boleto"
 	_ "github.com/henvic/embroidery/modules"
+	"github.com/henvic/embroidery/pix"
 	"github.com/henvic/embroidery/server"
 )
 
-var params = server.Params{}
+var (
+	params            = server.Params{}
+	lateCheckInterval time.Duration
+	lateWebhook       string
+)
 
 func main() {
 	flag.Parse()
 
+	if lateCheckInterval < 0 {
+		fmt.Fprintf(os.Stderr, "Invalid interval between checks for late jobs: %v\n", lateCheckInterval)
+		os.Exit(2)
+	}
+
+	if lateWebhook != "" {
+		alerts.Hooks = append(alerts.Hooks, alerts.Webhook{URL: lateWebhook})
+	}
+
+	if lateCheckInterval != 0 {
+		server.Instance.Background(func(ctx context.Context) {
+			alerts.Watch(ctx, lateCheckInterval)
+		})
+	}
+
 	if err := server.Start(context.Background(), params); err != nil {
 		fmt.Fprintf(os.Stderr, "%v", err)
 		os.Exit(1)
@@ -25,4 +48,20 @@ func main() {
 func init() {
 	flag.StringVar(&params.Address, "addr", "127.0.0.1:8080", "Serving address")
 	flag.StringVar(&params.DSN, "dsn", "root@/embroidery", "dsn (MySQL)")
+	flag.StringVar(&params.StorageDir, "storage", "data", "Directory for storing uploaded files")
+	flag.DurationVar(&lateCheckInterval, "late-check-interval", 5*time.Minute, "Interval between checks for late jobs (0 disables them)")
+	flag.StringVar(&lateWebhook, "late-webhook", "", "URL notified of late jobs (JSON POST)")
+	flag.StringVar(&pix.Config.Key, "pix-key", "", "Pix key receiving payments (Pix is disabled when empty)")
+	flag.StringVar(&pix.Config.Location, "pix-location", "", "Location of the charges on the Pix provider, without the scheme, for dynamic codes (static codes are used when empty)")
+	flag.StringVar(&pix.Config.MerchantName, "pix-name", "", "Merchant name shown on Pix payments")
+	flag.StringVar(&pix.Config.MerchantCity, "pix-city", "", "Merchant city shown on Pix payments")
+	flag.StringVar(&boleto.Config.BankCode, "boleto-bank", "", "Bank code of boletos: 001 or 237 (boletos are disabled when empty)")
+	flag.StringVar(&boleto.Config.Agency, "boleto-agency", "", "Bank agency receiving boleto payments")
+	flag.StringVar(&boleto.Config.Account, "boleto-account", "", "Bank account receiving boleto payments")
+	flag.StringVar(&boleto.Config.Wallet, "boleto-wallet", "", "Wallet (carteira) of boletos")
+	flag.StringVar(&boleto.Config.Agreement, "boleto-agreement", "", "Agreement (convênio) with the bank for boletos")
+	flag.StringVar(&boleto.Config.Beneficiary, "boleto-beneficiary", "", "Beneficiary name printed on boletos")
+	flag.StringVar(&boleto.Config.Document, "boleto-document", "", "Beneficiary CNPJ or CPF printed on boletos")
+	flag.IntVar(&boleto.Config.DueDays, "boleto-due-days", 7, "Days until boletos are due, when not given")
+	flag.StringVar(&boleto.Config.Instructions, "boleto-instructions", "", "Instructions printed on boletos")
 }
@@ -28,6 +28,36 @@ import (
 	// jobs routes
 	_ "github.com/henvic/embroidery/jobs/handles"
 
+	// machines routes
+	_ "github.com/henvic/embroidery/machines/handles"
+
+	// schedule routes
+	_ "github.com/henvic/embroidery/schedule/handles"
+
+	// personalization routes
+	_ "github.com/henvic/embroidery/personalization/handles"
+
+	// shop floor scanning routes
+	_ "github.com/henvic/embroidery/scan/handles"
+
+	// quality control routes
+	_ "github.com/henvic/embroidery/qc/handles"
+
+	// quotes routes
+	_ "github.com/henvic/embroidery/quotes/handles"
+
+	// invoices routes
+	_ "github.com/henvic/embroidery/invoices/handles"
+
 	// payment routes
 	_ "github.com/henvic/embroidery/payment/handles"
+
+	// pix routes
+	_ "github.com/henvic/embroidery/pix/handles"
+
+	// boleto routes
+	_ "github.com/henvic/embroidery/boleto/handles"
+
+	// pricing routes
+	_ "github.com/henvic/embroidery/pricing/handles"
 )
@@ -3,18 +3,28 @@ package ordershandles
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	schema "github.com/gorilla/Schema"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
 	"github.com/henvic/embroidery/address"
+	"github.com/henvic/embroidery/asset"
+	"github.com/henvic/embroidery/boleto"
 	"github.com/henvic/embroidery/clients"
 	"github.com/henvic/embroidery/handles"
+	"github.com/henvic/embroidery/jobs"
 	"github.com/henvic/embroidery/orders"
+	"github.com/henvic/embroidery/payment"
+	"github.com/henvic/embroidery/pix"
+	"github.com/henvic/embroidery/schedule"
 	"github.com/henvic/embroidery/server"
 	"github.com/henvic/embroidery/sitetemplate"
 )
@@ -28,8 +38,62 @@ func init() {
 }
 
 type orderEditForm struct {
-	ClientAddressID string `schema:"client_address_id"`
-	Status          string `schema:"status"`
+	ClientAddressID string  `schema:"client_address_id"`
+	Status          string  `schema:"status"`
+	DueDate         *string `schema:"due_date"`
+	Priority        *int    `schema:"priority"`
+}
+
+// parseDueDate of a form, empty for no due date
+func parseDueDate(value string) (*string, error) {
+	value = strings.TrimSpace(value)
+
+	if value == "" {
+		return nil, nil
+	}
+
+	if _, err := time.Parse("2006-01-02", value); err != nil {
+		return nil, errors.New("Invalid due date")
+	}
+
+	return &value, nil
+}
+
+func sameDate(a, b *string) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+// parseListFilter reads the due date, balance, priority and sorting filters
+// of the list of orders
+func parseListFilter(r *http.Request, f *orders.ListFilter) error {
+	var q = r.URL.Query()
+	f.Due = q.Get("due")
+	f.Balance = q.Get("balance")
+	f.Sort = q.Get("sort")
+
+	if _, ok := orders.GetDueFilter()[f.Due]; !ok {
+		return errors.New("Invalid due date filter")
+	}
+
+	if _, ok := orders.GetBalanceFilter()[f.Balance]; !ok {
+		return errors.New("Invalid balance filter")
+	}
+
+	if _, ok := orders.GetSortOptions()[f.Sort]; !ok {
+		return errors.New("Invalid sorting")
+	}
+
+	if p := q.Get("priority"); p != "" {
+		priority, err := strconv.Atoi(p)
+
+		if err != nil {
+			return errors.New("Invalid priority")
+		}
+
+		f.MinPriority = &priority
+	}
+
+	return nil
 }
 
 func orderEditHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
@@ -67,17 +131,84 @@ func orderEditHandler(w http.ResponseWriter, r *http.Request, s *sessions.Sessio
 		return
 	}
 
+	js, err := jobs.List(r.Context(), jobs.ListFilter{
+		OrderID: order.OrderID,
+	})
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	as, err := asset.List(r.Context(), asset.ListFilter{
+		ClientID:     client.ClientID,
+		ShowArchived: true,
+	})
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	var assets = map[string]asset.Asset{}
+
+	for _, a := range as {
+		assets[a.AssetID] = a
+	}
+
+	balance, err := payment.GetBalance(r.Context(), order.OrderID)
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
+		var charge *pix.Charge
+
+		if pix.Enabled() && order.Status != "CANCELED" && balance.Outstanding() > 0 {
+			c, err := pix.ChargeFor(r.Context(), order.OrderID)
+
+			switch err {
+			case nil:
+				charge = &c
+			case pix.ErrNothingToCharge:
+			default:
+				handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+				return
+			}
+		}
+
+		bs, err := boleto.List(r.Context(), boleto.ListFilter{
+			OrderID: order.OrderID,
+		})
+
+		if err != nil {
+			handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+			return
+		}
+
 		var t = sitetemplate.Template{
 			Title:     fmt.Sprintf("Endereço do cliente %v %v", client.FirstName, client.LastName),
 			Section:   "orders",
 			Filenames: []string{"gui/order/client-order.html"},
 			Data: map[string]interface{}{
-				"Client":    client,
-				"Order":     order,
-				"Addresses": addresses,
-				"AllStatus": orders.GetStatusFilter(),
+				"Client":     client,
+				"Order":      order,
+				"Addresses":  addresses,
+				"Jobs":       js,
+				"Assets":     assets,
+				"Balance":    balance,
+				"Pix":        charge,
+				"Boletos":    bs,
+				"BoletoOn":   boleto.Enabled(),
+				"NextStatus": orders.NextStatus(order.Status),
 			},
 			Request:        r,
 			ResponseWriter: w,
@@ -85,7 +216,7 @@ func orderEditHandler(w http.ResponseWriter, r *http.Request, s *sessions.Sessio
 
 		t.Respond()
 	case http.MethodPost:
-		orderPostEditHandler(client, order, w, r)
+		orderPostEditHandler(client, order, w, r, s)
 		return
 	default:
 		handles.ErrorHandler(w, r, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
@@ -167,6 +298,18 @@ func orderPostAddHandler(w http.ResponseWriter, r *http.Request, s *sessions.Ses
 		ClientAddressID: as[0].AddressID,
 	}
 
+	if o.DueDate, err = parseDueDate(r.PostFormValue("due_date")); err != nil {
+		handles.ErrorHandler(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if p := r.PostFormValue("priority"); p != "" {
+		if o.Priority, err = strconv.Atoi(p); err != nil {
+			handles.ErrorHandler(w, r, "Invalid priority", http.StatusBadRequest)
+			return
+		}
+	}
+
 	added, err := orders.Insert(context.Background(), o)
 
 	if err != nil {
@@ -178,7 +321,7 @@ func orderPostAddHandler(w http.ResponseWriter, r *http.Request, s *sessions.Ses
 	http.Redirect(w, r, fmt.Sprintf("/orders/%v", url.QueryEscape(added)), http.StatusSeeOther)
 }
 
-func orderPostEditHandler(client clients.Client, order orders.Order, w http.ResponseWriter, r *http.Request) {
+func orderPostEditHandler(client clients.Client, order orders.Order, w http.ResponseWriter, r *http.Request, s *sessions.Session) {
 	if err := r.ParseForm(); err != nil {
 		handles.ErrorHandler(w, r, "Invalid form", http.StatusBadRequest)
 		return
@@ -192,6 +335,48 @@ func orderPostEditHandler(client clients.Client, order orders.Order, w http.Resp
 		return
 	}
 
+	if caf.ClientAddressID != "" && caf.ClientAddressID != order.ClientAddressID {
+		if err := orders.UpdateAddress(r.Context(), order.OrderID, caf.ClientAddressID); err != nil {
+			handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+			return
+		}
+	}
+
+	if caf.DueDate != nil || caf.Priority != nil {
+		dueDate, err := parseDueDate(r.PostFormValue("due_date"))
+
+		if err != nil {
+			handles.ErrorHandler(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var priority = order.Priority
+
+		if caf.Priority != nil {
+			priority = *caf.Priority
+		}
+
+		if !sameDate(dueDate, order.DueDate) || priority != order.Priority {
+			if err := orders.UpdatePlanning(r.Context(), order.OrderID, dueDate, priority); err != nil {
+				handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+				return
+			}
+
+			if err := schedule.Recompute(r.Context()); err != nil {
+				handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+				return
+			}
+		}
+	}
+
+	if caf.Status == "" || strings.EqualFold(caf.Status, order.Status) {
+		http.Redirect(w, r, fmt.Sprintf("/orders/%v", url.QueryEscape(order.OrderID)), http.StatusSeeOther)
+		return
+	}
+
 	switch caf.Status {
 	case "open", "waiting_for_payment", "stand_by", "queue", "in_progress", "canceled", "done":
 	default:
@@ -199,9 +384,26 @@ func orderPostEditHandler(client clients.Client, order orders.Order, w http.Resp
 		return
 	}
 
-	err := orders.Update(r.Context(), order, caf.Status, caf.ClientAddressID)
+	employeeID, _ := s.Values["user"].(string)
+	err := orders.UpdateStatus(r.Context(), order.OrderID, caf.Status, employeeID)
 
-	if err != nil {
+	switch err {
+	case nil:
+	case orders.ErrInvalidTransition:
+		handles.ErrorHandler(w, r,
+			fmt.Sprintf("Order can't change from %v to %v", strings.ToLower(order.Status), caf.Status),
+			http.StatusConflict)
+		return
+	case orders.ErrNoJobs, orders.ErrUnfinishedJobs:
+		handles.ErrorHandler(w, r, err.Error(), http.StatusConflict)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	if err := schedule.Recompute(r.Context()); err != nil {
 		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
 		return
@@ -243,10 +445,31 @@ func ordersHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session)
 		}
 	}
 
-	order, err := orders.List(r.Context(), orders.ListFilter{
+	var f = orders.ListFilter{
 		ClientID: c.ClientID,
 		Status:   currentStatus,
-	})
+	}
+
+	if err := parseListFilter(r, &f); err != nil {
+		handles.ErrorHandler(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	order, err := orders.List(r.Context(), f)
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	var orderIDs []string
+
+	for _, o := range order {
+		orderIDs = append(orderIDs, o.OrderID)
+	}
+
+	balances, err := payment.GetBalances(r.Context(), orderIDs)
 
 	if err != nil {
 		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -264,8 +487,13 @@ func ordersHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session)
 			"ClientsMap":    clientsMap,
 			"Client":        c,
 			"Orders":        order,
+			"Balances":      balances,
 			"AllStatus":     orders.GetStatusFilter(),
 			"CurrentStatus": currentStatus,
+			"AllDue":        orders.GetDueFilter(),
+			"AllBalance":    orders.GetBalanceFilter(),
+			"SortOptions":   orders.GetSortOptions(),
+			"Filter":        f,
 		},
 		Request:        r,
 		ResponseWriter: w,
@@ -3,6 +3,7 @@ package orders
 import (
 	"context"
 	"database/sql"
+	"strings"
 
 	"github.com/hashicorp/errwrap"
 	"github.com/henvic/embroidery/server"
@@ -21,39 +22,68 @@ type Order struct {
 	CloseTime       *string `schema:"close_time"`
 	Status          string  `schema:"status"`
 	PriceTotal      int64   `schema:"price_total"`
+
+	// DueDate and Priority are inherited by the jobs of the order
+	DueDate  *string `schema:"due_date"`
+	Priority int     `schema:"priority"`
 }
 
+const columns = "order_id,client_id,client_address_id,open_time,close_time,status,price_total,due_date,priority"
+
 // ListFilter sets the filter settings
+// Due is one of the keys of GetDueFilter, Balance one of GetBalanceFilter
+// and Sort one of GetSortOptions.
+// MinPriority lists only orders with at least the given priority.
 type ListFilter struct {
-	ClientID string
-	Status   string
+	ClientID    string
+	Status      string
+	Due         string
+	Balance     string
+	MinPriority *int
+	Sort        string
 }
 
 // List order
 func List(ctx context.Context, f ListFilter) (order []Order, err error) {
-	var q = "SELECT order_id,client_id,client_address_id,open_time,close_time,status,price_total FROM `order`"
+	var q = "SELECT " + columns + " FROM `order`"
+	var where []string
 	var i []interface{}
 
-	// horrible 'WHERE'...
-	if f.ClientID != "" || f.Status != "" {
-		q += " WHERE"
-	}
-
 	if f.Status != "" {
-		q += " status = ?"
+		where = append(where, "status = ?")
 		i = append(i, f.Status)
 	}
 
-	if f.ClientID != "" && f.Status != "" {
-		q += " AND"
-	}
-
 	if f.ClientID != "" {
-		q += " client_id = ?"
+		where = append(where, "client_id = ?")
 		i = append(i, f.ClientID)
 	}
 
-	q += " ORDER BY open_time DESC"
+	if c, ok := dueClauses[f.Due]; ok && c != "" {
+		where = append(where, c)
+	}
+
+	if c, ok := balanceClauses[f.Balance]; ok && c != "" {
+		where = append(where, c)
+	}
+
+	if f.MinPriority != nil {
+		where = append(where, "priority >= ?")
+		i = append(i, *f.MinPriority)
+	}
+
+	if len(where) != 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
+	}
+
+	switch f.Sort {
+	case "due_date":
+		q += " ORDER BY due_date IS NULL, due_date, priority DESC, open_time DESC"
+	case "priority":
+		q += " ORDER BY priority DESC, due_date IS NULL, due_date, open_time DESC"
+	default:
+		q += " ORDER BY open_time DESC"
+	}
 
 	stmt, err := db().PrepareContext(ctx, q)
 
@@ -84,8 +114,22 @@ func List(ctx context.Context, f ListFilter) (order []Order, err error) {
 	return order, err
 }
 
+// preparer is either the database or a transaction
+type preparer interface {
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
 // Insert order on database
 func Insert(ctx context.Context, order Order) (uid string, err error) {
+	return insert(ctx, db(), order)
+}
+
+// InsertTx inserts an order within a transaction
+func InsertTx(ctx context.Context, tx *sql.Tx, order Order) (uid string, err error) {
+	return insert(ctx, tx, order)
+}
+
+func insert(ctx context.Context, p preparer, order Order) (uid string, err error) {
 	var query = `INSERT INTO ` + "`order`" + ` (
 		order_id,
 		client_id,
@@ -93,11 +137,13 @@ func Insert(ctx context.Context, order Order) (uid string, err error) {
 		open_time,
 		close_time,
 		status,
-		price_total
+		price_total,
+		due_date,
+		priority
 		)
-		VALUES (?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, 0)`
+		VALUES (?, ?, ?, CURRENT_TIMESTAMP, NULL, ?, 0, ?, ?)`
 
-	stmt, err := db().PrepareContext(ctx, query)
+	stmt, err := p.PrepareContext(ctx, query)
 
 	if err != nil {
 		return "", err
@@ -112,6 +158,8 @@ func Insert(ctx context.Context, order Order) (uid string, err error) {
 		order.ClientID,
 		order.ClientAddressID,
 		"OPEN",
+		order.DueDate,
+		order.Priority,
 	)
 
 	if err != nil {
@@ -121,42 +169,24 @@ func Insert(ctx context.Context, order Order) (uid string, err error) {
 	return id, err
 }
 
-// Update an order
-func Update(ctx context.Context, order Order, newStatus, newAddressID string) error {
-	var q = "UPDATE `order` SET "
-
-	var i []interface{}
-
-	if order.Status != newStatus {
-		q += "status = ?, "
-		i = append(i, newStatus)
-
-		if newStatus == "done" {
-			q += "close_time = CURRENT_TIMESTAMP, "
-		}
-	}
-
-	q += "client_address_id = ? WHERE order_id = ?"
-
-	stmt, err := db().PrepareContext(ctx, q)
+// UpdateAddress of an order
+func UpdateAddress(ctx context.Context, orderID, addressID string) error {
+	stmt, err := db().PrepareContext(ctx, "UPDATE `order` SET client_address_id = ? WHERE order_id = ?")
 
 	if err != nil {
-		return errwrap.Wrapf("Error preparing employee update query: {{err}}", err)
+		return errwrap.Wrapf("Error preparing order update query: {{err}}", err)
 	}
 
 	defer stmt.Close()
 
-	i = append(i, newAddressID, order.OrderID)
-	_, err = stmt.ExecContext(ctx, i...)
-
+	_, err = stmt.ExecContext(ctx, addressID, orderID)
 	return err
 }
 
 // Get order by ID
 func Get(ctx context.Context, orderID string) (Order, error) {
 	stmt, err := db().PrepareContext(ctx,
-		`SELECT order_id,client_id,client_address_id,open_time,close_time,status,price_total
-FROM `+"`order`"+` WHERE order_id = ?`)
+		"SELECT "+columns+" FROM `order` WHERE order_id = ?")
 
 	if err != nil {
 		return Order{}, errwrap.Wrapf("Error preparing order query: {{err}}", err)
@@ -183,6 +213,87 @@ FROM `+"`order`"+` WHERE order_id = ?`)
 	return order, nil
 }
 
+// UpdatePlanning changes the due date and priority of an order and of its
+// unfinished jobs
+func UpdatePlanning(ctx context.Context, orderID string, dueDate *string, priority int) error {
+	tx, err := db().BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "UPDATE `order` SET due_date = ?, priority = ? WHERE order_id = ?",
+		dueDate, priority, orderID)
+
+	if err != nil {
+		return errwrap.Wrapf("Error updating order planning: {{err}}", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE job SET due_date = ?, priority = ?
+WHERE order_id = ? AND status IN ('CREATED', 'QUEUE', 'IN_PROGRESS', 'QC')`,
+		dueDate, priority, orderID)
+
+	if err != nil {
+		return errwrap.Wrapf("Error updating job planning: {{err}}", err)
+	}
+
+	return tx.Commit()
+}
+
+// GetDueFilter for orders
+func GetDueFilter() map[string]string {
+	return allDueFilter
+}
+
+// GetSortOptions for orders
+func GetSortOptions() map[string]string {
+	return allSortOptions
+}
+
+var allDueFilter = map[string]string{
+	"":        "any due date",
+	"overdue": "overdue",
+	"week":    "due in a week",
+	"none":    "no due date",
+}
+
+var dueClauses = map[string]string{
+	"":        "",
+	"overdue": "due_date < CURRENT_DATE AND status NOT IN ('DONE', 'CANCELED')",
+	"week":    "due_date BETWEEN CURRENT_DATE AND DATE_ADD(CURRENT_DATE, INTERVAL 7 DAY)",
+	"none":    "due_date IS NULL",
+}
+
+// GetBalanceFilter for orders
+func GetBalanceFilter() map[string]string {
+	return allBalanceFilter
+}
+
+var allBalanceFilter = map[string]string{
+	"":            "any balance",
+	"outstanding": "outstanding",
+	"settled":     "settled",
+	"overpaid":    "overpaid",
+}
+
+// received of an order: refunds are given back and adjustments count as paid
+const received = "(SELECT IFNULL(SUM(IF(p.kind = 'REFUND', -p.price_total, p.price_total)), 0) FROM payment p WHERE p.order_id = `order`.order_id)"
+
+var balanceClauses = map[string]string{
+	"":            "",
+	"outstanding": "price_total > " + received,
+	"settled":     "price_total = " + received,
+	"overpaid":    "price_total < " + received,
+}
+
+var allSortOptions = map[string]string{
+	"":         "newest",
+	"due_date": "due date",
+	"priority": "priority",
+}
+
 // GetStatusFilter for orders
 func GetStatusFilter() map[string]string {
 	return allStatusFilter
@@ -0,0 +1,253 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/henvic/embroidery/jobs"
+)
+
+// ErrInvalidTransition is used when an order can't move to the requested status
+var ErrInvalidTransition = errors.New("Invalid order status transition")
+
+// ErrNoJobs is used when an order without jobs is queued or finished
+var ErrNoJobs = errors.New("Order has no jobs")
+
+// ErrUnfinishedJobs is used when an order with unfinished jobs is finished
+var ErrUnfinishedJobs = errors.New("Order has unfinished jobs")
+
+// transitions of the status of an order
+// DONE and CANCELED are final
+var transitions = map[string][]string{
+	"OPEN":                {"WAITING_FOR_PAYMENT", "STAND_BY", "QUEUE", "CANCELED"},
+	"WAITING_FOR_PAYMENT": {"OPEN", "STAND_BY", "QUEUE", "CANCELED"},
+	"STAND_BY":            {"OPEN", "WAITING_FOR_PAYMENT", "QUEUE", "CANCELED"},
+	"QUEUE":               {"IN_PROGRESS", "STAND_BY", "CANCELED", "DONE"},
+	"IN_PROGRESS":         {"DONE", "STAND_BY", "CANCELED"},
+}
+
+// NextStatus lists the statuses an order can move to from a status
+func NextStatus(status string) []string {
+	return transitions[strings.ToUpper(status)]
+}
+
+// CanTransition tells if an order can move from a status to another
+func CanTransition(from, to string) bool {
+	for _, s := range NextStatus(from) {
+		if s == strings.ToUpper(to) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsFinal tells if an order status is final (no more changes are allowed)
+func IsFinal(status string) bool {
+	switch strings.ToUpper(status) {
+	case "DONE", "CANCELED":
+		return true
+	default:
+		return false
+	}
+}
+
+// jobsSummary of an order, ignoring canceled jobs
+type jobsSummary struct {
+	jobs    []jobs.Job
+	active  int
+	started int
+	done    int
+}
+
+func summarizeJobs(ctx context.Context, tx *sql.Tx, orderID string) (s jobsSummary, err error) {
+	rows, err := tx.QueryContext(ctx, "SELECT job_id,status FROM `job` WHERE order_id = ? FOR UPDATE", orderID)
+
+	if err != nil {
+		return s, errwrap.Wrapf("Error querying order jobs: {{err}}", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var j jobs.Job
+
+		if err := rows.Scan(&j.JobID, &j.Status); err != nil {
+			return s, errwrap.Wrapf("Error scanning order jobs: {{err}}", err)
+		}
+
+		s.jobs = append(s.jobs, j)
+
+		switch j.Status {
+		case "CANCELED":
+			continue
+		case "DONE":
+			s.done++
+			s.started++
+		case "IN_PROGRESS", "QC":
+			s.started++
+		}
+
+		s.active++
+	}
+
+	return s, rows.Err()
+}
+
+// UpdateStatus of an order
+// Canceling an order cancels its unfinished jobs.
+func UpdateStatus(ctx context.Context, orderID, status, employeeID string) error {
+	tx, err := db().BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := UpdateStatusTx(ctx, tx, orderID, status, employeeID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateStatusTx updates the status of an order within a transaction
+func UpdateStatusTx(ctx context.Context, tx *sql.Tx, orderID, status, employeeID string) error {
+	var from string
+
+	// lock the order row so concurrent transitions are serialized
+	err := tx.QueryRowContext(ctx, "SELECT status FROM `order` WHERE order_id = ? FOR UPDATE", orderID).Scan(&from)
+
+	if err != nil {
+		return errwrap.Wrapf("Error querying order status: {{err}}", err)
+	}
+
+	s, err := summarizeJobs(ctx, tx, orderID)
+
+	if err != nil {
+		return err
+	}
+
+	return transition(ctx, tx, orderID, from, strings.ToUpper(status), employeeID, s)
+}
+
+func transition(ctx context.Context, tx *sql.Tx, orderID, from, to, employeeID string, s jobsSummary) error {
+	if !CanTransition(from, to) {
+		return ErrInvalidTransition
+	}
+
+	switch to {
+	case "QUEUE", "IN_PROGRESS":
+		if s.active == 0 {
+			return ErrNoJobs
+		}
+	case "DONE":
+		if s.active == 0 {
+			return ErrNoJobs
+		}
+
+		if s.done != s.active {
+			return ErrUnfinishedJobs
+		}
+	case "CANCELED":
+		if err := cancelJobs(ctx, tx, s.jobs, employeeID); err != nil {
+			return err
+		}
+	}
+
+	var q = "UPDATE `order` SET status = ?"
+
+	if IsFinal(to) {
+		q += ", close_time = CURRENT_TIMESTAMP"
+	}
+
+	if _, err := tx.ExecContext(ctx, q+" WHERE order_id = ?", to, orderID); err != nil {
+		return errwrap.Wrapf("Error updating order status: {{err}}", err)
+	}
+
+	return nil
+}
+
+func cancelJobs(ctx context.Context, tx *sql.Tx, js []jobs.Job, employeeID string) error {
+	for _, j := range js {
+		if j.Status == "DONE" || j.Status == "CANCELED" {
+			continue
+		}
+
+		if err := jobs.UpdateStatusTx(ctx, tx, j.JobID, "CANCELED", employeeID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SyncTx syncs the status of an order with its payments and jobs, within the
+// transaction that changed them:
+// orders with payments covering the price total move to QUEUE,
+// orders with jobs being sewed move to IN_PROGRESS,
+// and orders whose jobs are all finished move to DONE.
+// Orders priced at zero are never queued automatically.
+func SyncTx(ctx context.Context, tx *sql.Tx, orderID, employeeID string) error {
+	var status string
+	var priceTotal, paid int64
+
+	err := tx.QueryRowContext(ctx, "SELECT status, price_total FROM `order` WHERE order_id = ? FOR UPDATE",
+		orderID).Scan(&status, &priceTotal)
+
+	if err != nil {
+		return errwrap.Wrapf("Error querying order status: {{err}}", err)
+	}
+
+	if IsFinal(status) {
+		return nil
+	}
+
+	// refunds are given back and adjustments count as paid (see payment.Balance)
+	err = tx.QueryRowContext(ctx, "SELECT IFNULL(SUM(IF(kind = 'REFUND', -price_total, price_total)), 0) FROM payment WHERE order_id = ?",
+		orderID).Scan(&paid)
+
+	if err != nil {
+		return errwrap.Wrapf("Error querying order payments: {{err}}", err)
+	}
+
+	s, err := summarizeJobs(ctx, tx, orderID)
+
+	if err != nil {
+		return err
+	}
+
+	var next = func(to string, cond bool) error {
+		if !cond || !CanTransition(status, to) {
+			return nil
+		}
+
+		if err := transition(ctx, tx, orderID, status, to, employeeID, s); err != nil {
+			return err
+		}
+
+		status = to
+		return nil
+	}
+
+	var steps = []struct {
+		status string
+		cond   bool
+	}{
+		{"QUEUE", status != "STAND_BY" && priceTotal > 0 && paid >= priceTotal && s.active > 0},
+		{"IN_PROGRESS", s.started > 0},
+		{"DONE", s.active > 0 && s.done == s.active},
+	}
+
+	for _, step := range steps {
+		if err := next(step.status, step.cond); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
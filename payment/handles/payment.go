@@ -1,12 +1,12 @@
 package paymenthandles
 
 import (
-	"context"
 	"database/sql"
 	"fmt"
 	"net/http"
 	"net/url"
 	"os"
+	"strings"
 
 	schema "github.com/gorilla/Schema"
 	"github.com/gorilla/mux"
@@ -27,8 +27,11 @@ func init() {
 }
 
 type paymentAddForm struct {
-	PriceTotal int64  `schema:"price_Total"`
-	Provider   string `schema:"provider"`
+	Kind             string `schema:"kind"`
+	PriceTotal       int64  `schema:"price_Total"`
+	Provider         string `schema:"provider"`
+	Note             string `schema:"note"`
+	AllowOverpayment bool   `schema:"allow_overpayment"`
 }
 
 func paymentAddHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
@@ -63,9 +66,33 @@ func paymentAddHandler(w http.ResponseWriter, r *http.Request, s *sessions.Sessi
 
 	switch r.Method {
 	case http.MethodPost:
-		paymentPostAddHandler(order, client, w, r)
+		paymentPostAddHandler(order, client, w, r, s)
 		return
 	case http.MethodGet:
+		balance, err := payment.GetBalance(r.Context(), order.OrderID)
+
+		if err != nil {
+			handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+			return
+		}
+
+		var kind = r.URL.Query().Get("kind")
+
+		if _, ok := payment.GetKindsFilter()[kind]; !ok || kind == "" {
+			kind = "payment"
+		}
+
+		// pre-fill with what is left to pay, or what was overpaid for refunds
+		var amount int64
+
+		switch {
+		case kind == "payment" && balance.Outstanding() > 0:
+			amount = balance.Outstanding()
+		case kind == "refund":
+			amount = balance.Overpaid()
+		}
+
 		var t = sitetemplate.Template{
 			Title:     fmt.Sprintf("Registro de pagamento"),
 			Section:   "orders",
@@ -73,6 +100,10 @@ func paymentAddHandler(w http.ResponseWriter, r *http.Request, s *sessions.Sessi
 			Data: map[string]interface{}{
 				"Client":       client,
 				"Order":        order,
+				"Balance":      balance,
+				"Kind":         kind,
+				"Amount":       amount,
+				"AllKinds":     payment.GetKindsFilter(),
 				"AllProviders": payment.GetProvidersFilter(),
 			},
 			Request:        r,
@@ -87,7 +118,7 @@ func paymentAddHandler(w http.ResponseWriter, r *http.Request, s *sessions.Sessi
 	}
 }
 
-func paymentPostAddHandler(order orders.Order, client clients.Client, w http.ResponseWriter, r *http.Request) {
+func paymentPostAddHandler(order orders.Order, client clients.Client, w http.ResponseWriter, r *http.Request, s *sessions.Session) {
 	if err := r.ParseForm(); err != nil {
 		handles.ErrorHandler(w, r, "Invalid form", http.StatusBadRequest)
 		return
@@ -101,26 +132,51 @@ func paymentPostAddHandler(order orders.Order, client clients.Client, w http.Res
 		return
 	}
 
-	if caf.PriceTotal == 0 {
-		handles.ErrorHandler(w, r, "Don't be so cheap!", http.StatusBadRequest)
+	if caf.Kind == "" {
+		caf.Kind = "payment"
+	}
+
+	if _, ok := payment.GetKindsFilter()[caf.Kind]; !ok {
+		handles.ErrorHandler(w, r, "Payment kind not recognized", http.StatusBadRequest)
 		return
 	}
 
-	if _, ok := payment.GetProvidersFilter()[caf.Provider]; !ok || caf.Provider == "" {
-		handles.ErrorHandler(w, r, "Payment provider not recognized", http.StatusBadRequest)
+	if caf.Kind != "adjustment" {
+		if _, ok := payment.GetProvidersFilter()[caf.Provider]; !ok || caf.Provider == "" {
+			handles.ErrorHandler(w, r, "Payment provider not recognized", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if len([]rune(caf.Note)) > 255 {
+		handles.ErrorHandler(w, r, "Note is limited to 255 characters", http.StatusBadRequest)
 		return
 	}
 
 	o := payment.Payment{
 		ClientID:   client.ClientID,
 		OrderID:    order.OrderID,
+		Kind:       strings.ToUpper(caf.Kind),
 		PriceTotal: caf.PriceTotal,
-		Provider:   caf.Provider,
+		Provider:   strings.ToUpper(caf.Provider),
+		Note:       strings.TrimSpace(caf.Note),
 	}
 
-	_, err := payment.Insert(context.Background(), o)
+	employeeID, _ := s.Values["user"].(string)
+	_, err := payment.Record(r.Context(), o, caf.AllowOverpayment, employeeID)
 
-	if err != nil {
+	switch err {
+	case nil:
+	case payment.ErrInvalidAmount:
+		handles.ErrorHandler(w, r, "Don't be so cheap!", http.StatusBadRequest)
+		return
+	case payment.ErrNoProvider:
+		handles.ErrorHandler(w, r, err.Error(), http.StatusBadRequest)
+		return
+	case payment.ErrOverpayment, payment.ErrRefundTooLarge:
+		handles.ErrorHandler(w, r, err.Error(), http.StatusConflict)
+		return
+	default:
 		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
 		return
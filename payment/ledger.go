@@ -0,0 +1,231 @@
+package payment
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/henvic/embroidery/orders"
+)
+
+// Kinds of entries of the ledger of an order
+// Payments and refunds are money received from or given back to the client.
+// Adjustments change what the client owes without moving money: positive
+// ones are discounts or write-offs and negative ones are extra charges.
+const (
+	KindPayment    = "PAYMENT"
+	KindRefund     = "REFUND"
+	KindAdjustment = "ADJUSTMENT"
+)
+
+var (
+	// ErrInvalidAmount is used for payments and refunds that aren't positive
+	// and for adjustments of zero
+	ErrInvalidAmount = errors.New("Invalid amount")
+
+	// ErrOverpayment is used when a payment is more than the outstanding
+	// balance of the order and overpaying wasn't allowed
+	ErrOverpayment = errors.New("The payment is more than the outstanding balance of the order")
+
+	// ErrRefundTooLarge is used when refunding more than what was received
+	ErrRefundTooLarge = errors.New("The refund is more than what was received for the order")
+
+	// ErrNoProvider is used for payments and refunds without a provider
+	ErrNoProvider = errors.New("Payments and refunds need a provider")
+)
+
+// Balance of an order, from its price total and its ledger
+type Balance struct {
+	OrderID    string
+	PriceTotal int64
+	Paid       int64
+	Refunded   int64
+	Adjusted   int64
+}
+
+// Received is the money kept from the client
+func (b Balance) Received() int64 {
+	return b.Paid - b.Refunded
+}
+
+// Outstanding is what the client still owes, negative when overpaid
+func (b Balance) Outstanding() int64 {
+	return b.PriceTotal - b.Received() - b.Adjusted
+}
+
+// Overpaid is how much the client paid over the price total
+func (b Balance) Overpaid() int64 {
+	if o := b.Outstanding(); o < 0 {
+		return -o
+	}
+
+	return 0
+}
+
+const balanceQuery = `SELECT o.order_id, o.price_total,
+IFNULL(SUM(IF(p.kind = 'PAYMENT', p.price_total, 0)), 0),
+IFNULL(SUM(IF(p.kind = 'REFUND', p.price_total, 0)), 0),
+IFNULL(SUM(IF(p.kind = 'ADJUSTMENT', p.price_total, 0)), 0)
+FROM ` + "`order`" + ` o LEFT JOIN payment p ON p.order_id = o.order_id`
+
+// querier is either the database or a transaction
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func balances(ctx context.Context, qr querier, orderIDs []string) (m map[string]Balance, err error) {
+	m = map[string]Balance{}
+
+	if len(orderIDs) == 0 {
+		return m, nil
+	}
+
+	var args []interface{}
+
+	for _, id := range orderIDs {
+		args = append(args, id)
+	}
+
+	var in = strings.TrimSuffix(strings.Repeat("?,", len(orderIDs)), ",")
+
+	rows, err := qr.QueryContext(ctx, balanceQuery+" WHERE o.order_id IN ("+in+") GROUP BY o.order_id", args...)
+
+	if err != nil {
+		return nil, errwrap.Wrapf("Error querying order balance: {{err}}", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var b Balance
+
+		if err := rows.Scan(&b.OrderID, &b.PriceTotal, &b.Paid, &b.Refunded, &b.Adjusted); err != nil {
+			return nil, errwrap.Wrapf("Error scanning order balance: {{err}}", err)
+		}
+
+		m[b.OrderID] = b
+	}
+
+	return m, rows.Err()
+}
+
+// GetBalance of an order
+func GetBalance(ctx context.Context, orderID string) (Balance, error) {
+	return getBalance(ctx, db(), orderID)
+}
+
+// GetBalanceTx gets the balance of an order within a transaction
+// The order should be locked, so the balance doesn't change until it commits.
+func GetBalanceTx(ctx context.Context, tx *sql.Tx, orderID string) (Balance, error) {
+	return getBalance(ctx, tx, orderID)
+}
+
+func getBalance(ctx context.Context, qr querier, orderID string) (Balance, error) {
+	m, err := balances(ctx, qr, []string{orderID})
+
+	if err != nil {
+		return Balance{}, err
+	}
+
+	b, ok := m[orderID]
+
+	if !ok {
+		return b, sql.ErrNoRows
+	}
+
+	return b, nil
+}
+
+// GetBalances of orders, by order ID
+func GetBalances(ctx context.Context, orderIDs []string) (map[string]Balance, error) {
+	return balances(ctx, db(), orderIDs)
+}
+
+// Record an entry on the ledger of an order, checking it against its balance
+// Payments over the outstanding balance are only recorded if overpaying is
+// allowed, i.e., when the client pays in advance for changes on the order.
+// The status of the order is synced with its payments on the same transaction.
+func Record(ctx context.Context, p Payment, allowOverpayment bool, employeeID string) (uid string, err error) {
+	tx, err := db().BeginTx(ctx, nil)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer tx.Rollback()
+
+	if uid, err = RecordTx(ctx, tx, p, allowOverpayment); err != nil {
+		return "", err
+	}
+
+	if err := orders.SyncTx(ctx, tx, p.OrderID, employeeID); err != nil {
+		return "", err
+	}
+
+	return uid, tx.Commit()
+}
+
+// RecordTx records an entry on the ledger of an order within a transaction
+func RecordTx(ctx context.Context, tx *sql.Tx, p Payment, allowOverpayment bool) (uid string, err error) {
+	switch p.Kind {
+	case KindPayment, KindRefund:
+		if p.PriceTotal <= 0 {
+			return "", ErrInvalidAmount
+		}
+
+		if p.Provider == "" || p.Provider == "NONE" {
+			return "", ErrNoProvider
+		}
+	case KindAdjustment:
+		if p.PriceTotal == 0 {
+			return "", ErrInvalidAmount
+		}
+
+		p.Provider = "NONE"
+	default:
+		return "", errors.New("Unknown payment kind")
+	}
+
+	// lock the order row so concurrent entries are checked one after the other
+	var locked string
+	err = tx.QueryRowContext(ctx, "SELECT order_id FROM `order` WHERE order_id = ? FOR UPDATE", p.OrderID).Scan(&locked)
+
+	if err == sql.ErrNoRows {
+		return "", err
+	}
+
+	if err != nil {
+		return "", errwrap.Wrapf("Error locking order: {{err}}", err)
+	}
+
+	m, err := balances(ctx, tx, []string{p.OrderID})
+
+	if err != nil {
+		return "", err
+	}
+
+	var b = m[p.OrderID]
+
+	switch {
+	case p.Kind == KindPayment && !allowOverpayment && p.PriceTotal > b.Outstanding():
+		return "", ErrOverpayment
+	case p.Kind == KindRefund && p.PriceTotal > b.Received():
+		return "", ErrRefundTooLarge
+	}
+
+	return insert(ctx, tx, p)
+}
+
+// GetKindsFilter for ledger entries
+func GetKindsFilter() map[string]string {
+	return kindsFilter
+}
+
+var kindsFilter = map[string]string{
+	"":           "all",
+	"payment":    "payment",
+	"refund":     "refund",
+	"adjustment": "adjustment",
+}
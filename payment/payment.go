@@ -13,15 +13,21 @@ import (
 var db = server.Instance.DB
 
 // Payment of order
+// Kind tells if it is a payment, a refund or an adjustment of the order
+// ledger. Adjustments have no provider and a PriceTotal that may be negative.
 type Payment struct {
 	PaymentID  string `schema:"payment_id"`
 	ClientID   string `schema:"client_id"`
 	OrderID    string `schema:"order_id"`
+	Kind       string `schema:"kind"`
 	PriceTotal int64  `schema:"price_total"`
 	Provider   string `schema:"provider"`
+	Note       string `schema:"note"`
 	Date       string `schema:"date"`
 }
 
+const columns = "payment_id,client_id,order_id,kind,price_total,provider,note,date"
+
 // ListFilter sets the filter settings
 type ListFilter struct {
 	ClientID string
@@ -31,7 +37,7 @@ type ListFilter struct {
 
 // List payment
 func List(ctx context.Context, f ListFilter) (payment []Payment, err error) {
-	var q = "SELECT payment_id,client_id,order_id,price_total,provider,date FROM `payment`"
+	var q = "SELECT " + columns + " FROM `payment`"
 	var i []interface{}
 
 	// horrible 'WHERE'...
@@ -93,19 +99,31 @@ func List(ctx context.Context, f ListFilter) (payment []Payment, err error) {
 	return payment, err
 }
 
+// preparer is either the database or a transaction
+type preparer interface {
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
 // Insert payment on database
+// Use Record to check it against the balance of the order.
 func Insert(ctx context.Context, payment Payment) (uid string, err error) {
+	return insert(ctx, db(), payment)
+}
+
+func insert(ctx context.Context, p preparer, payment Payment) (uid string, err error) {
 	var query = `INSERT INTO payment (
 		payment_id,
 		client_id,
 		order_id,
+		kind,
 		price_total,
 		provider,
+		note,
 		date
 		)
-		VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`
+		VALUES (?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`
 
-	stmt, err := db().PrepareContext(ctx, query)
+	stmt, err := p.PrepareContext(ctx, query)
 
 	if err != nil {
 		return "", err
@@ -113,14 +131,20 @@ func Insert(ctx context.Context, payment Payment) (uid string, err error) {
 
 	defer stmt.Close()
 
+	if payment.Kind == "" {
+		payment.Kind = KindPayment
+	}
+
 	id := uuid.NewV4().String()
 	_, err = stmt.ExecContext(
 		ctx,
 		id,
 		payment.ClientID,
 		payment.OrderID,
+		payment.Kind,
 		payment.PriceTotal,
 		payment.Provider,
+		payment.Note,
 	)
 
 	if err != nil {
@@ -133,7 +157,7 @@ func Insert(ctx context.Context, payment Payment) (uid string, err error) {
 // Get payment by ID
 func Get(ctx context.Context, paymentID string) (Payment, error) {
 	stmt, err := db().PrepareContext(ctx,
-		`SELECT payment_id,client_id,order_id,price_total,provider,date FROM payment WHERE payment_id = ?`)
+		"SELECT "+columns+" FROM payment WHERE payment_id = ?")
 
 	if err != nil {
 		return Payment{}, errwrap.Wrapf("Error preparing payment query: {{err}}", err)
@@ -167,8 +191,10 @@ func GetProvidersFilter() map[string]string {
 
 var providersFilter = map[string]string{
 	"":               "all",
+	"boleto":         "boleto",
 	"cash_flow":      "cash flow",
 	"credit_card":    "credit card",
 	"debit_card":     "debit card",
 	"money_transfer": "money transfer",
+	"pix":            "pix",
 }
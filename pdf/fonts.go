@@ -0,0 +1,112 @@
+package pdf
+
+// Font is one of the standard Type 1 fonts, which PDF readers must provide
+type Font int
+
+// Fonts available on documents
+const (
+	Helvetica Font = iota
+	HelveticaBold
+)
+
+var fontNames = [...]string{
+	Helvetica:     "Helvetica",
+	HelveticaBold: "Helvetica-Bold",
+}
+
+// widths of the printable ASCII characters (from the space, 32, to the
+// tilde, 126) in thousandths of the font size, from the Adobe font metrics
+var widths = [...][95]int{
+	Helvetica: {
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	},
+	HelveticaBold: {
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	},
+}
+
+// baseLetters of the accented Latin-1 letters, which have the same width
+const (
+	latin1Accented = "ÀÁÂÃÄÅÇÈÉÊËÌÍÎÏÑÒÓÔÕÖÙÚÛÜÝàáâãäåçèéêëìíîïñòóôõöùúûüýÿ"
+	latin1Base     = "AAAAAACEEEEIIIINOOOOOUUUUYaaaaaaceeeeiiiinooooouuuuyy"
+)
+
+// winAnsi code points of the characters outside of Latin-1
+var winAnsi = map[rune]byte{
+	'€': 0x80,
+	'…': 0x85,
+	'‘': 0x91,
+	'’': 0x92,
+	'“': 0x93,
+	'”': 0x94,
+	'•': 0x95,
+	'–': 0x96,
+	'—': 0x97,
+}
+
+// encode text on the WinAnsiEncoding used by the fonts
+// Characters that can't be encoded are replaced by a question mark.
+func encode(text string) []byte {
+	var b []byte
+
+	for _, r := range text {
+		switch c, ok := winAnsi[r]; {
+		case ok:
+			b = append(b, c)
+		case r >= 0x20 && r <= 0x7e, r >= 0xa0 && r <= 0xff:
+			b = append(b, byte(r))
+		default:
+			b = append(b, '?')
+		}
+	}
+
+	return b
+}
+
+func charWidth(f Font, r rune) int {
+	if i := indexRune(latin1Accented, r); i != -1 {
+		r = rune(latin1Base[i])
+	}
+
+	if r >= 0x20 && r <= 0x7e {
+		return widths[f][r-0x20]
+	}
+
+	// other symbols are about the width of a digit
+	return 556
+}
+
+func indexRune(s string, r rune) int {
+	var i int
+
+	for _, c := range s {
+		if c == r {
+			return i
+		}
+
+		i++
+	}
+
+	return -1
+}
+
+// TextWidth of a text with the given font and size, in points
+func TextWidth(text string, f Font, size float64) float64 {
+	var w int
+
+	for _, r := range text {
+		w += charWidth(f, r)
+	}
+
+	return float64(w) * size / 1000
+}
@@ -0,0 +1,233 @@
+// Package pdf writes simple PDF documents with text, lines, rectangles and
+// raster images, using only the standard fonts.
+// Positions are in points (1/72 inch) from the top left corner of the page.
+package pdf
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"strconv"
+)
+
+// A4 page size, in points
+const (
+	A4Width  = 595
+	A4Height = 842
+)
+
+// Document with pages of the same size
+type Document struct {
+	Width  float64
+	Height float64
+
+	pages  []*Page
+	images [][]byte
+}
+
+// New document with A4 pages
+func New() *Document {
+	return &Document{
+		Width:  A4Width,
+		Height: A4Height,
+	}
+}
+
+// Page of a document
+type Page struct {
+	doc     *Document
+	content bytes.Buffer
+}
+
+// AddPage to the end of the document
+func (d *Document) AddPage() *Page {
+	var p = &Page{doc: d}
+	d.pages = append(d.pages, p)
+	return p
+}
+
+// Color in RGB
+type Color struct {
+	R, G, B uint8
+}
+
+// Colors used often
+var (
+	Black = Color{0, 0, 0}
+	Gray  = Color{128, 128, 128}
+	White = Color{255, 255, 255}
+)
+
+func (c Color) String() string {
+	return fmt.Sprintf("%v %v %v", num(float64(c.R)/255), num(float64(c.G)/255), num(float64(c.B)/255))
+}
+
+// num formats a number rounded to thousandths, without trailing zeros
+func num(f float64) string {
+	return strconv.FormatFloat(math.Round(f*1000)/1000, 'f', -1, 64)
+}
+
+// y coordinate flipped to the bottom up coordinates of the PDF
+func (p *Page) y(y float64) float64 {
+	return p.doc.Height - y
+}
+
+// Text with its baseline at x, y
+func (p *Page) Text(x, y float64, f Font, size float64, c Color, text string) {
+	fmt.Fprintf(&p.content, "BT %v rg /F%d %v Tf %v %v Td ", c, f+1, num(size), num(x), num(p.y(y)))
+	p.content.WriteByte('(')
+
+	for _, b := range encode(text) {
+		switch b {
+		case '(', ')', '\\':
+			p.content.WriteByte('\\')
+		}
+
+		p.content.WriteByte(b)
+	}
+
+	p.content.WriteString(") Tj ET\n")
+}
+
+// Line from x0, y0 to x1, y1
+func (p *Page) Line(x0, y0, x1, y1, width float64, c Color) {
+	fmt.Fprintf(&p.content, "%v RG %v w %v %v m %v %v l S\n",
+		c, num(width), num(x0), num(p.y(y0)), num(x1), num(p.y(y1)))
+}
+
+// Rect filled with a color, with its top left corner at x, y
+func (p *Page) Rect(x, y, w, h float64, c Color) {
+	fmt.Fprintf(&p.content, "%v rg %v %v %v %v re f\n", c, num(x), num(p.y(y+h)), num(w), num(h))
+}
+
+// StrokeRect draws the outline of a rectangle
+func (p *Page) StrokeRect(x, y, w, h, width float64, c Color) {
+	fmt.Fprintf(&p.content, "%v RG %v w %v %v %v %v re S\n", c, num(width), num(x), num(p.y(y+h)), num(w), num(h))
+}
+
+// Image drawn on the rectangle with its top left corner at x, y
+// Transparency is ignored.
+func (p *Page) Image(img image.Image, x, y, w, h float64) error {
+	data, err := imageObject(img)
+
+	if err != nil {
+		return err
+	}
+
+	p.doc.images = append(p.doc.images, data)
+	fmt.Fprintf(&p.content, "q %v 0 0 %v %v %v cm /Im%d Do Q\n",
+		num(w), num(h), num(x), num(p.y(y+h)), len(p.doc.images))
+	return nil
+}
+
+// imageObject encodes an image as a compressed RGB image XObject
+func imageObject(img image.Image) ([]byte, error) {
+	var b = img.Bounds()
+	var pixels bytes.Buffer
+	var zw = zlib.NewWriter(&pixels)
+	var row = make([]byte, 0, b.Dx()*3)
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row = row[:0]
+
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			row = append(row, byte(r>>8), byte(g>>8), byte(bl>>8))
+		}
+
+		if _, err := zw.Write(row); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	var obj bytes.Buffer
+	fmt.Fprintf(&obj, "<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB "+
+		"/BitsPerComponent 8 /Filter /FlateDecode /Length %d >>\nstream\n", b.Dx(), b.Dy(), pixels.Len())
+	obj.Write(pixels.Bytes())
+	obj.WriteString("\nendstream")
+	return obj.Bytes(), nil
+}
+
+// Write the document
+func (d *Document) Write(w io.Writer) error {
+	var bw = bufio.NewWriter(w)
+	var offsets []int
+	var written int
+
+	var object = func(body []byte) {
+		offsets = append(offsets, written)
+		n, _ := fmt.Fprintf(bw, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+		written += n
+	}
+
+	n, _ := bw.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	written += n
+
+	// objects 1 and 2 are the catalog and the page tree, followed by the fonts,
+	// the images and finally each page with its content
+	var firstFont = 3
+	var firstImage = firstFont + len(fontNames)
+	var firstPage = firstImage + len(d.images)
+
+	var kids bytes.Buffer
+
+	for i := range d.pages {
+		fmt.Fprintf(&kids, "%d 0 R ", firstPage+i*2)
+	}
+
+	object([]byte("<< /Type /Catalog /Pages 2 0 R >>"))
+	object([]byte(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d /MediaBox [0 0 %v %v] >>",
+		bytes.TrimSpace(kids.Bytes()), len(d.pages), num(d.Width), num(d.Height))))
+
+	for _, name := range fontNames {
+		object([]byte(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%v /Encoding /WinAnsiEncoding >>", name)))
+	}
+
+	for _, img := range d.images {
+		object(img)
+	}
+
+	var resources bytes.Buffer
+	resources.WriteString("<< /Font <<")
+
+	for i := range fontNames {
+		fmt.Fprintf(&resources, " /F%d %d 0 R", i+1, firstFont+i)
+	}
+
+	resources.WriteString(" >>")
+
+	if len(d.images) != 0 {
+		resources.WriteString(" /XObject <<")
+
+		for i := range d.images {
+			fmt.Fprintf(&resources, " /Im%d %d 0 R", i+1, firstImage+i)
+		}
+
+		resources.WriteString(" >>")
+	}
+
+	resources.WriteString(" >>")
+
+	for i, p := range d.pages {
+		object([]byte(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /Resources %s /Contents %d 0 R >>",
+			resources.Bytes(), firstPage+i*2+1)))
+		object([]byte(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", p.content.Len(), p.content.Bytes())))
+	}
+
+	fmt.Fprintf(bw, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+
+	for _, o := range offsets {
+		fmt.Fprintf(bw, "%010d 00000 n \n", o)
+	}
+
+	fmt.Fprintf(bw, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, written)
+	return bw.Flush()
+}
@@ -0,0 +1,273 @@
+package personalizationhandles
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+	"github.com/henvic/embroidery/handles"
+	"github.com/henvic/embroidery/jobs"
+	"github.com/henvic/embroidery/lettering"
+	"github.com/henvic/embroidery/personalization"
+	"github.com/henvic/embroidery/preview"
+	"github.com/henvic/embroidery/server"
+	"github.com/henvic/embroidery/sitetemplate"
+	"github.com/henvic/embroidery/stitch"
+)
+
+var router = server.Instance.Mux
+
+func init() {
+	router().Handle("/jobs/{job_id}/personalization", handles.AuthenticatedHandler(personalizationHandler))
+	router().Handle("/jobs/{job_id}/personalization/{position:[0-9]+}.{format:dst|pes|exp}",
+		handles.AuthenticatedHandler(nameStitchFileHandler))
+	router().Handle("/jobs/{job_id}/personalization/{position:[0-9]+}/preview.svg",
+		handles.AuthenticatedHandler(namePreviewHandler))
+}
+
+// maxNamesFileSize is the maximum size of an uploaded list of names
+const maxNamesFileSize = 4 << 20
+
+func getJob(w http.ResponseWriter, r *http.Request) (jobs.Job, bool) {
+	vars := mux.Vars(r)
+	jobID, ok := vars["job_id"]
+
+	if !ok {
+		handles.ErrorHandler(w, r, "Missing job ID parameter", http.StatusBadRequest)
+		return jobs.Job{}, false
+	}
+
+	job, err := jobs.Get(r.Context(), jobID)
+
+	switch err {
+	case nil:
+		return job, true
+	case sql.ErrNoRows:
+		handles.ErrorHandler(w, r, "Job not found", http.StatusNotFound)
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+	}
+
+	return jobs.Job{}, false
+}
+
+func personalizationHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	job, ok := getJob(w, r)
+
+	if !ok {
+		return
+	}
+
+	l, err := personalization.Get(r.Context(), job.JobID)
+
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		l = personalization.List{
+			JobID:  job.JobID,
+			Height: personalization.DefaultHeight,
+		}
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		var text []string
+
+		for _, n := range l.Names {
+			if n.Piece != "" {
+				text = append(text, n.Name+"; "+n.Piece)
+			} else {
+				text = append(text, n.Name)
+			}
+		}
+
+		var t = sitetemplate.Template{
+			Title:     fmt.Sprintf("Personalization of job %v", job.JobID),
+			Section:   "jobs",
+			Filenames: []string{"gui/personalization/edit.html"},
+			Data: map[string]interface{}{
+				"Job":       job,
+				"List":      l,
+				"Text":      strings.Join(text, "\n"),
+				"MinHeight": lettering.MinHeight,
+				"MaxHeight": lettering.MaxHeight,
+			},
+			Request:        r,
+			ResponseWriter: w,
+		}
+
+		t.Respond()
+	case http.MethodPost:
+		personalizationPostHandler(job, l, w, r)
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func personalizationPostHandler(job jobs.Job, l personalization.List, w http.ResponseWriter, r *http.Request) {
+	if job.Status == "DONE" || job.Status == "CANCELED" {
+		handles.ErrorHandler(w, r, "Can't change the names of a finished job", http.StatusConflict)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxNamesFileSize)
+
+	if err := r.ParseMultipartForm(maxNamesFileSize); err != nil && err != http.ErrNotMultipart {
+		handles.ErrorHandler(w, r, "Invalid form", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	var fields = map[string]*float64{
+		"height":   &l.Height,
+		"offset_x": &l.OffsetX,
+		"offset_y": &l.OffsetY,
+	}
+
+	for name, v := range fields {
+		if *v, err = strconv.ParseFloat(strings.TrimSpace(r.FormValue(name)), 64); err != nil {
+			handles.ErrorHandler(w, r, fmt.Sprintf("Invalid %v", strings.Replace(name, "_", " ", -1)), http.StatusBadRequest)
+			return
+		}
+	}
+
+	l.Names = personalization.ParseText(r.FormValue("names"))
+
+	// an uploaded file replaces the typed names
+	file, header, err := r.FormFile("names_file")
+
+	switch err {
+	case nil:
+		defer file.Close()
+
+		if l.Names, err = personalization.Parse(header.Filename, file); err != nil {
+			handles.ErrorHandler(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case http.ErrMissingFile, http.ErrNotMultipart:
+	default:
+		handles.ErrorHandler(w, r, "Invalid names file", http.StatusBadRequest)
+		return
+	}
+
+	lines, err := jobs.ListLines(r.Context(), job.JobID)
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	personalization.AssignPieces(l.Names, lines)
+
+	if err := l.Validate(job.Amount); err != nil {
+		handles.ErrorHandler(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := personalization.Save(r.Context(), l); err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/jobs/%v", url.QueryEscape(job.JobID)), http.StatusSeeOther)
+}
+
+// getNamePattern generates the lettering of the name of the piece on the URL
+func getNamePattern(w http.ResponseWriter, r *http.Request) (personalization.Name, *stitch.Pattern, bool) {
+	job, ok := getJob(w, r)
+
+	if !ok {
+		return personalization.Name{}, nil, false
+	}
+
+	l, err := personalization.Get(r.Context(), job.JobID)
+
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		handles.ErrorHandler(w, r, "Job has no personalization", http.StatusNotFound)
+		return personalization.Name{}, nil, false
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return personalization.Name{}, nil, false
+	}
+
+	position, _ := strconv.Atoi(mux.Vars(r)["position"])
+	n, ok := l.NameAt(position)
+
+	if !ok {
+		handles.ErrorHandler(w, r, "Piece not found", http.StatusNotFound)
+		return personalization.Name{}, nil, false
+	}
+
+	p, err := l.Pattern(n)
+
+	if err != nil {
+		handles.ErrorHandler(w, r, err.Error(), http.StatusConflict)
+		return personalization.Name{}, nil, false
+	}
+
+	return n, p, true
+}
+
+func nameStitchFileHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	n, p, ok := getNamePattern(w, r)
+
+	if !ok {
+		return
+	}
+
+	var format = mux.Vars(r)["format"]
+
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf("attachment; filename=\"%03d-%v.%v\"", n.Position, slug(n.Name), format))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if err := stitch.Write(w, p, format); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing lettering of piece %v: %v\n", n.Position, err)
+	}
+}
+
+func namePreviewHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	n, p, ok := getNamePattern(w, r)
+
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if err := preview.SVG(w, p); err != nil {
+		fmt.Fprintf(os.Stderr, "Error rendering lettering of piece %v: %v\n", n.Position, err)
+	}
+}
+
+// slug of a name, safe to use on a filename
+func slug(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r == ' ':
+			return '_'
+		default:
+			return -1
+		}
+	}, lettering.Normalize(name))
+}
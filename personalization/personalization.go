@@ -0,0 +1,334 @@
+package personalization
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/henvic/embroidery/jobs"
+	"github.com/henvic/embroidery/lettering"
+	"github.com/henvic/embroidery/server"
+	"github.com/henvic/embroidery/stitch"
+	"github.com/kisielk/sqlstruct"
+)
+
+var db = server.Instance.DB
+
+// DefaultHeight of the letters, in mm
+const DefaultHeight = 10
+
+// List of names to embroider on the pieces of a job
+// The lettering is placed with its center at the offset from the center of
+// the hoop. Sizes are in mm.
+type List struct {
+	JobID   string
+	Height  float64
+	OffsetX float64
+	OffsetY float64
+	Names   []Name `sql:"-"`
+}
+
+// Name embroidered on a piece of a job
+// Position is the number of the piece, starting from 1.
+// Piece describes it, i.e., the garment, size and color.
+type Name struct {
+	JobID    string
+	Position int
+	Name     string
+	Piece    string
+}
+
+// Options of the lettering of the names of the list
+func (l List) Options() lettering.Options {
+	return lettering.Options{
+		Height: l.Height,
+		X:      l.OffsetX,
+		Y:      l.OffsetY,
+	}
+}
+
+// Pattern of a name of the list
+func (l List) Pattern(n Name) (*stitch.Pattern, error) {
+	return lettering.Generate(n.Name, l.Options())
+}
+
+// NameAt position (piece number)
+func (l List) NameAt(position int) (Name, bool) {
+	for _, n := range l.Names {
+		if n.Position == position {
+			return n, true
+		}
+	}
+
+	return Name{}, false
+}
+
+// Validate the list for a job with the given amount of pieces
+func (l List) Validate(amount int) error {
+	if l.Height < lettering.MinHeight || l.Height > lettering.MaxHeight {
+		return fmt.Errorf("Letter height must be between %v and %v mm", lettering.MinHeight, lettering.MaxHeight)
+	}
+
+	if len(l.Names) > amount {
+		return fmt.Errorf("There are %d names for %d pieces", len(l.Names), amount)
+	}
+
+	for _, n := range l.Names {
+		if err := lettering.Check(n.Name); err != nil {
+			return fmt.Errorf("Name %q of piece %d: %v", n.Name, n.Position, err)
+		}
+	}
+
+	return nil
+}
+
+// AssignPieces describes the pieces without a description using the lines of
+// the job, in order
+func AssignPieces(names []Name, lines []jobs.Line) {
+	var pieces []string
+
+	for _, l := range lines {
+		var desc = strings.TrimSpace(strings.Join([]string{l.GarmentType, l.Size, l.Color}, " "))
+
+		for i := 0; i < l.Quantity; i++ {
+			pieces = append(pieces, desc)
+		}
+	}
+
+	for i := range names {
+		if names[i].Piece == "" && i < len(pieces) {
+			names[i].Piece = pieces[i]
+		}
+	}
+}
+
+// header names, in English and Portuguese
+var headers = map[string]string{
+	"name":    "name",
+	"nome":    "name",
+	"piece":   "piece",
+	"peça":    "piece",
+	"peca":    "piece",
+	"size":    "piece",
+	"tamanho": "piece",
+}
+
+// ParseText of names typed one per line, optionally followed by the piece
+// description after a semicolon
+func ParseText(text string) (names []Name) {
+	for _, line := range strings.Split(text, "\n") {
+		var parts = strings.SplitN(line, ";", 2)
+		var n = Name{Name: strings.TrimSpace(parts[0])}
+
+		if len(parts) == 2 {
+			n.Piece = strings.TrimSpace(parts[1])
+		}
+
+		if n.Name != "" {
+			names = append(names, n)
+		}
+	}
+
+	return number(names)
+}
+
+// Parse names from a CSV or XLSX file, by its extension
+// The name is on the first column and the piece description on the second,
+// unless a header row names them.
+func Parse(filename string, r io.Reader) (names []Name, err error) {
+	// spreadsheets are zip files, which need random access
+	data, err := ioutil.ReadAll(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var records [][]string
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".xlsx":
+		records, err = readXLSX(bytes.NewReader(data), int64(len(data)))
+	case ".csv", ".txt":
+		records, err = readCSV(data)
+	default:
+		return nil, fmt.Errorf("Names must be on a CSV or XLSX file")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return parseRecords(records), nil
+}
+
+func readCSV(data []byte) ([][]string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	var cr = csv.NewReader(bytes.NewReader(data))
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	var firstLine = string(bytes.SplitN(data, []byte("\n"), 2)[0])
+
+	if strings.Count(firstLine, ";") > strings.Count(firstLine, ",") {
+		cr.Comma = ';'
+	}
+
+	records, err := cr.ReadAll()
+
+	if err != nil {
+		return nil, errwrap.Wrapf("Error reading CSV file: {{err}}", err)
+	}
+
+	return records, nil
+}
+
+func parseRecords(records [][]string) (names []Name) {
+	var index = map[string]int{"name": 0, "piece": 1}
+
+	if len(records) != 0 {
+		var found = map[string]int{}
+
+		for i, h := range records[0] {
+			if c, ok := headers[strings.ToLower(strings.TrimSpace(h))]; ok {
+				found[c] = i
+			}
+		}
+
+		if _, ok := found["name"]; ok {
+			index = found
+			records = records[1:]
+		}
+	}
+
+	var field = func(record []string, column string) string {
+		i, ok := index[column]
+
+		if !ok || i >= len(record) {
+			return ""
+		}
+
+		return strings.TrimSpace(record[i])
+	}
+
+	for _, record := range records {
+		var n = Name{
+			Name:  field(record, "name"),
+			Piece: field(record, "piece"),
+		}
+
+		if n.Name != "" {
+			names = append(names, n)
+		}
+	}
+
+	return number(names)
+}
+
+func number(names []Name) []Name {
+	for i := range names {
+		names[i].Position = i + 1
+	}
+
+	return names
+}
+
+// Get the personalization list of a job
+// sql.ErrNoRows is returned if the job has no list
+func Get(ctx context.Context, jobID string) (List, error) {
+	var l List
+
+	err := db().QueryRowContext(ctx,
+		"SELECT job_id, height, offset_x, offset_y FROM personalization WHERE job_id = ?",
+		jobID).Scan(&l.JobID, &l.Height, &l.OffsetX, &l.OffsetY)
+
+	if err == sql.ErrNoRows {
+		return l, err
+	}
+
+	if err != nil {
+		return l, errwrap.Wrapf("Error querying personalization: {{err}}", err)
+	}
+
+	l.Names, err = ListNames(ctx, jobID)
+	return l, err
+}
+
+// ListNames of the personalization list of a job, by piece
+func ListNames(ctx context.Context, jobID string) (names []Name, err error) {
+	stmt, err := db().PrepareContext(ctx,
+		"SELECT job_id,position,name,piece FROM personalization_name WHERE job_id = ? ORDER BY position")
+
+	if err != nil {
+		return nil, errwrap.Wrapf("Error preparing personalization name query: {{err}}", err)
+	}
+
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, jobID)
+
+	if err != nil {
+		return nil, errwrap.Wrapf("Error querying personalization names: {{err}}", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var n Name
+
+		if err := sqlstruct.Scan(&n, rows); err != nil {
+			return nil, errwrap.Wrapf("Error scanning personalization name rows: {{err}}", err)
+		}
+
+		names = append(names, n)
+	}
+
+	return names, rows.Err()
+}
+
+// Save the personalization list of a job, replacing the previous one
+func Save(ctx context.Context, l List) error {
+	tx, err := db().BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO personalization (job_id, height, offset_x, offset_y) VALUES (?, ?, ?, ?)
+ON DUPLICATE KEY UPDATE height = VALUES(height), offset_x = VALUES(offset_x), offset_y = VALUES(offset_y)`,
+		l.JobID, l.Height, l.OffsetX, l.OffsetY)
+
+	if err != nil {
+		return errwrap.Wrapf("Error saving personalization: {{err}}", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM personalization_name WHERE job_id = ?", l.JobID); err != nil {
+		return errwrap.Wrapf("Error deleting personalization names: {{err}}", err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx,
+		"INSERT INTO personalization_name (job_id, position, name, piece) VALUES (?, ?, ?, ?)")
+
+	if err != nil {
+		return errwrap.Wrapf("Error preparing personalization name insert query: {{err}}", err)
+	}
+
+	defer stmt.Close()
+
+	for _, n := range l.Names {
+		if _, err := stmt.ExecContext(ctx, l.JobID, n.Position, n.Name, n.Piece); err != nil {
+			return errwrap.Wrapf("Error inserting personalization name: {{err}}", err)
+		}
+	}
+
+	return tx.Commit()
+}
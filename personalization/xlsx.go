@@ -0,0 +1,175 @@
+package personalization
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// only what's needed to read the cells of the first worksheet of a workbook
+// is decoded: shared strings, inline strings and plain values.
+
+// ErrInvalidXLSX is used when a spreadsheet can't be read
+var ErrInvalidXLSX = errors.New("Invalid or unsupported XLSX file")
+
+const maxXLSXColumns = 64
+
+type xlsxSharedStrings struct {
+	Items []struct {
+		Text string `xml:"t"`
+		Runs []struct {
+			Text string `xml:"t"`
+		} `xml:"r"`
+	} `xml:"si"`
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		Cells []struct {
+			Ref    string `xml:"r,attr"`
+			Type   string `xml:"t,attr"`
+			Value  string `xml:"v"`
+			Inline struct {
+				Text string `xml:"t"`
+			} `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// readXLSX returns the rows of the first worksheet of a workbook
+func readXLSX(r io.ReaderAt, size int64) (records [][]string, err error) {
+	zr, err := zip.NewReader(r, size)
+
+	if err != nil {
+		return nil, ErrInvalidXLSX
+	}
+
+	var files = map[string]*zip.File{}
+	var sheets []string
+
+	for _, f := range zr.File {
+		files[f.Name] = f
+
+		if strings.HasPrefix(f.Name, "xl/worksheets/") && strings.HasSuffix(f.Name, ".xml") {
+			sheets = append(sheets, f.Name)
+		}
+	}
+
+	if len(sheets) == 0 {
+		return nil, ErrInvalidXLSX
+	}
+
+	var shared []string
+
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		var ss xlsxSharedStrings
+
+		if err := decodeXLSXPart(f, &ss); err != nil {
+			return nil, err
+		}
+
+		for _, si := range ss.Items {
+			var s = si.Text
+
+			for _, r := range si.Runs {
+				s += r.Text
+			}
+
+			shared = append(shared, s)
+		}
+	}
+
+	var sheet = "xl/worksheets/sheet1.xml"
+
+	if _, ok := files[sheet]; !ok {
+		sort.Strings(sheets)
+		sheet = sheets[0]
+	}
+
+	var ws xlsxWorksheet
+
+	if err := decodeXLSXPart(files[sheet], &ws); err != nil {
+		return nil, err
+	}
+
+	for _, row := range ws.Rows {
+		var record []string
+
+		for i, c := range row.Cells {
+			var col = i
+
+			if c.Ref != "" && xlsxColumn(c.Ref) >= 0 {
+				col = xlsxColumn(c.Ref)
+			}
+
+			// names lists only use the first columns
+			if col >= maxXLSXColumns {
+				continue
+			}
+
+			for len(record) <= col {
+				record = append(record, "")
+			}
+
+			switch c.Type {
+			case "s":
+				n, err := strconv.Atoi(c.Value)
+
+				if err != nil || n < 0 || n >= len(shared) {
+					return nil, ErrInvalidXLSX
+				}
+
+				record[col] = shared[n]
+			case "inlineStr":
+				record[col] = c.Inline.Text
+			default:
+				record[col] = c.Value
+			}
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+func decodeXLSXPart(f *zip.File, v interface{}) error {
+	rc, err := f.Open()
+
+	if err != nil {
+		return ErrInvalidXLSX
+	}
+
+	defer rc.Close()
+
+	// parts are small, but don't trust the size on the zip header
+	data, err := ioutil.ReadAll(io.LimitReader(rc, 32<<20))
+
+	if err != nil {
+		return ErrInvalidXLSX
+	}
+
+	if err := xml.Unmarshal(data, v); err != nil {
+		return ErrInvalidXLSX
+	}
+
+	return nil
+}
+
+// xlsxColumn index of a cell reference such as "B12"
+func xlsxColumn(ref string) (col int) {
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+
+		col = col*26 + int(r-'A') + 1
+	}
+
+	return col - 1
+}
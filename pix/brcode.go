@@ -0,0 +1,239 @@
+// Package pix generates the BR Codes of Pix, the Brazilian instant payments,
+// and keeps the charges of orders until the payments are confirmed.
+//
+// BR Codes follow the EMV QR Code Specification for Payment Systems
+// (Merchant-Presented Mode) with the Pix extensions of the Banco Central do
+// Brasil: a list of ID, length and value fields ending with a CRC16 checksum.
+package pix
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Payload of a BR Code
+// Static codes carry the Pix key and can be paid many times; dynamic codes
+// carry the Location (URL without the scheme) of a charge created on the
+// payment service provider and are paid once, with the transaction ID of
+// the charge kept there. Amount is in cents; zero lets the payer type the
+// amount.
+type Payload struct {
+	Key          string
+	Location     string
+	Description  string
+	MerchantName string
+	MerchantCity string
+	TxID         string
+	Amount       int64
+}
+
+var (
+	// ErrNoKey is used for payloads without a Pix key or location
+	ErrNoKey = errors.New("BR Code needs a Pix key or a location")
+
+	// ErrInvalidTxID is used for transaction IDs that aren't alphanumeric or
+	// are longer than 25 characters
+	ErrInvalidTxID = errors.New("Pix transaction ID must have up to 25 letters and digits")
+
+	// ErrFieldTooLong is used when a field doesn't fit on a BR Code
+	ErrFieldTooLong = errors.New("BR Code field too long")
+)
+
+// IDs of the BR Code fields
+const (
+	idPayloadFormat     = "00"
+	idInitiationMethod  = "01"
+	idMerchantAccount   = "26"
+	idCategoryCode      = "52"
+	idCurrency          = "53"
+	idAmount            = "54"
+	idCountry           = "58"
+	idMerchantName      = "59"
+	idMerchantCity      = "60"
+	idAdditionalData    = "62"
+	idCRC               = "63"
+	idGUI               = "00"
+	idKey               = "01"
+	idDescription       = "02"
+	idLocation          = "25"
+	idTxID              = "05"
+	gui                 = "br.gov.bcb.pix"
+	currencyBRL         = "986"
+	dynamicInitiation   = "12"
+	noTxID              = "***"
+	maxMerchantNameSize = 25
+	maxMerchantCitySize = 15
+	maxTxIDSize         = 25
+)
+
+// field of the payload, with its ID and the length of the value
+func field(id, value string) (string, error) {
+	var size = utf8.RuneCountInString(value)
+
+	if size > 99 {
+		return "", ErrFieldTooLong
+	}
+
+	return fmt.Sprintf("%v%02d%v", id, size, value), nil
+}
+
+// Encode the payload as the text of the BR Code, also known as "Pix Copia e
+// Cola"
+func (p Payload) Encode() (string, error) {
+	if p.Key == "" && p.Location == "" {
+		return "", ErrNoKey
+	}
+
+	var txID = p.TxID
+
+	if txID == "" || p.Location != "" {
+		txID = noTxID
+	}
+
+	if txID != noTxID && !validTxID(txID) {
+		return "", ErrInvalidTxID
+	}
+
+	var account = []string{idGUI, gui}
+	var kv = []string{idPayloadFormat, "01"}
+
+	// the point of initiation is left out of static codes, so they can be
+	// paid more than once
+	if p.Location != "" {
+		kv = append(kv, idInitiationMethod, dynamicInitiation)
+		account = append(account, idLocation, p.Location)
+	} else {
+		account = append(account, idKey, p.Key)
+
+		if p.Description != "" {
+			account = append(account, idDescription, normalize(p.Description))
+		}
+	}
+
+	merchantAccount, err := fields(account...)
+
+	if err != nil {
+		return "", err
+	}
+
+	additionalData, err := fields(idTxID, txID)
+
+	if err != nil {
+		return "", err
+	}
+
+	kv = append(kv,
+		idMerchantAccount, merchantAccount,
+		idCategoryCode, "0000",
+		idCurrency, currencyBRL,
+	)
+
+	if p.Amount > 0 {
+		kv = append(kv, idAmount, fmt.Sprintf("%d.%02d", p.Amount/100, p.Amount%100))
+	}
+
+	kv = append(kv,
+		idCountry, "BR",
+		idMerchantName, truncate(normalize(p.MerchantName), maxMerchantNameSize),
+		idMerchantCity, truncate(normalize(p.MerchantCity), maxMerchantCitySize),
+		idAdditionalData, additionalData,
+	)
+
+	payload, err := fields(kv...)
+
+	if err != nil {
+		return "", err
+	}
+
+	// the checksum covers its own ID and length
+	payload += idCRC + "04"
+	return payload + fmt.Sprintf("%04X", CRC16([]byte(payload))), nil
+}
+
+// fields encoded from pairs of IDs and values
+func fields(kv ...string) (string, error) {
+	var s string
+
+	for i := 0; i+1 < len(kv); i += 2 {
+		f, err := field(kv[i], kv[i+1])
+
+		if err != nil {
+			return "", err
+		}
+
+		s += f
+	}
+
+	return s, nil
+}
+
+// CRC16 of the payload: CRC-16/CCITT-FALSE (polynomial 0x1021, initial value
+// 0xFFFF, no reflection, no final XOR)
+func CRC16(data []byte) uint16 {
+	var crc uint16 = 0xFFFF
+
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
+
+func validTxID(txID string) bool {
+	if len(txID) == 0 || len(txID) > maxTxIDSize {
+		return false
+	}
+
+	for _, r := range txID {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// accents replaced on the merchant name and city, as some banking apps only
+// read ASCII on these fields
+var accents = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ã", "a", "ä", "a",
+	"é", "e", "ê", "e", "è", "e", "ë", "e",
+	"í", "i", "î", "i", "ì", "i", "ï", "i",
+	"ó", "o", "ô", "o", "õ", "o", "ò", "o", "ö", "o",
+	"ú", "u", "û", "u", "ù", "u", "ü", "u",
+	"ç", "c", "ñ", "n",
+	"Á", "A", "À", "A", "Â", "A", "Ã", "A", "Ä", "A",
+	"É", "E", "Ê", "E", "È", "E", "Ë", "E",
+	"Í", "I", "Î", "I", "Ì", "I", "Ï", "I",
+	"Ó", "O", "Ô", "O", "Õ", "O", "Ò", "O", "Ö", "O",
+	"Ú", "U", "Û", "U", "Ù", "U", "Ü", "U",
+	"Ç", "C", "Ñ", "N",
+)
+
+func normalize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7E {
+			return -1
+		}
+
+		return r
+	}, accents.Replace(strings.TrimSpace(s)))
+}
+
+func truncate(s string, size int) string {
+	if len(s) > size {
+		return strings.TrimSpace(s[:size])
+	}
+
+	return s
+}
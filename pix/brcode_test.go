@@ -0,0 +1,119 @@
+package pix
+
+import "testing"
+
+var encodeCases = []struct {
+	name    string
+	payload Payload
+	want    string
+	err     error
+}{
+	{
+		// example of a static BR Code from the Pix manual of the Banco Central do Brasil
+		"static reference",
+		Payload{
+			Key:          "123e4567-e12b-12d1-a456-426655440000",
+			MerchantName: "Fulano de Tal",
+			MerchantCity: "BRASILIA",
+		},
+		"00020126580014br.gov.bcb.pix0136123e4567-e12b-12d1-a456-426655440000" +
+			"5204000053039865802BR5913Fulano de Tal6008BRASILIA62070503***63041D3D",
+		nil,
+	},
+	{
+		"amount, transaction ID and accents",
+		Payload{
+			Key:          "pix@example.com",
+			MerchantName: "Bordados São João",
+			MerchantCity: "São Paulo",
+			TxID:         "ABC123",
+			Amount:       12345,
+		},
+		"00020126370014br.gov.bcb.pix0115pix@example.com" +
+			"5204000053039865406123.45" +
+			"5802BR5917Bordados Sao Joao6009Sao Paulo62100506ABC1236304305D",
+		nil,
+	},
+	{
+		// example of a dynamic BR Code from the Pix manual of the Banco Central do Brasil
+		"dynamic reference",
+		Payload{
+			Location:     "pix.example.com/8b3da2f39a4140d1a91abd93113bd441",
+			MerchantName: "Fulano de Tal",
+			MerchantCity: "BRASILIA",
+		},
+		"00020101021226700014br.gov.bcb.pix2548pix.example.com/8b3da2f39a4140d1a91abd93113bd441" +
+			"5204000053039865802BR5913Fulano de Tal6008BRASILIA62070503***630464E4",
+		nil,
+	},
+	{
+		// the transaction ID of dynamic codes is kept on the charge at the location
+		"dynamic with amount and transaction ID",
+		Payload{
+			Key:          "pix@example.com",
+			Location:     "pix.example.com/qr/v2/ABC123",
+			MerchantName: "Bordados São João",
+			MerchantCity: "São Paulo",
+			TxID:         "ABC123",
+			Amount:       12345,
+		},
+		"00020101021226500014br.gov.bcb.pix2528pix.example.com/qr/v2/ABC123" +
+			"5204000053039865406123.45" +
+			"5802BR5917Bordados Sao Joao6009Sao Paulo62070503***630458EC",
+		nil,
+	},
+	{
+		"no key",
+		Payload{
+			MerchantName: "Fulano de Tal",
+			MerchantCity: "BRASILIA",
+		},
+		"",
+		ErrNoKey,
+	},
+	{
+		"invalid transaction ID",
+		Payload{
+			Key:  "pix@example.com",
+			TxID: "ABC-123",
+		},
+		"",
+		ErrInvalidTxID,
+	},
+	{
+		"transaction ID too long",
+		Payload{
+			Key:  "pix@example.com",
+			TxID: "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+		},
+		"",
+		ErrInvalidTxID,
+	},
+}
+
+func TestEncode(t *testing.T) {
+	for _, c := range encodeCases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := c.payload.Encode()
+
+			if err != c.err {
+				t.Fatalf("Expected error to be %v, got %v instead", c.err, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if got != c.want {
+				t.Errorf("Expected BR Code to be %v, got %v instead", c.want, got)
+			}
+		})
+	}
+}
+
+func TestCRC16(t *testing.T) {
+	// check value of CRC-16/CCITT-FALSE
+	if crc := CRC16([]byte("123456789")); crc != 0x29B1 {
+		t.Errorf("Expected CRC16 to be 29B1, got %04X instead", crc)
+	}
+}
@@ -0,0 +1,289 @@
+package pix
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/henvic/embroidery/orders"
+	"github.com/henvic/embroidery/payment"
+	"github.com/henvic/embroidery/server"
+	"github.com/kisielk/sqlstruct"
+	uuid "github.com/satori/go.uuid"
+)
+
+var db = server.Instance.DB
+
+// Settings of the Pix account receiving the payments
+// Pix is disabled while the key is empty. Charges are paid with static codes
+// unless Location is set: then dynamic codes are used, with the location of
+// the charges on the payment service provider (URL without the scheme)
+// followed by their transaction IDs.
+type Settings struct {
+	Key          string
+	Location     string
+	MerchantName string
+	MerchantCity string
+}
+
+// Config of Pix, set on startup
+var Config Settings
+
+// Enabled tells if Pix is configured
+func Enabled() bool {
+	return Config.Key != ""
+}
+
+// Charge of an order, paid with the BR Code on Payload
+// The charge is confirmed when the payment is seen on the account, recording
+// a payment on the order.
+type Charge struct {
+	TxID          string
+	OrderID       string
+	Amount        int64
+	Payload       string
+	Status        string
+	PaymentID     *string
+	CreatedTime   string
+	ConfirmedTime *string
+}
+
+var (
+	// ErrNotConfigured is used when Pix is used without a key
+	ErrNotConfigured = errors.New("Pix isn't configured")
+
+	// ErrNothingToCharge is used when charging an order that owes nothing
+	ErrNothingToCharge = errors.New("The order has no outstanding balance")
+
+	// ErrNotPending is used when confirming a charge that was already
+	// confirmed or canceled
+	ErrNotPending = errors.New("The Pix charge isn't pending")
+)
+
+const columns = "txid,order_id,amount,payload,status,payment_id,created_time,confirmed_time"
+
+// Get charge by transaction ID
+func Get(ctx context.Context, txID string) (c Charge, err error) {
+	rows, err := db().QueryContext(ctx, "SELECT "+columns+" FROM pix_charge WHERE txid = ?", txID)
+
+	if err != nil {
+		return c, errwrap.Wrapf("Error querying pix charge: {{err}}", err)
+	}
+
+	defer rows.Close()
+
+	if !rows.Next() {
+		return c, sql.ErrNoRows
+	}
+
+	if err := sqlstruct.Scan(&c, rows); err != nil {
+		return c, errwrap.Wrapf("Error scanning pix charge rows: {{err}}", err)
+	}
+
+	return c, nil
+}
+
+// newTxID for a charge: letters and digits only, as required on BR Codes
+func newTxID() string {
+	return strings.ToUpper(strings.Replace(uuid.NewV4().String(), "-", "", -1))[:maxTxIDSize]
+}
+
+// ChargeFor the outstanding balance of an order
+// The pending charge of the order is kept while the balance doesn't change;
+// otherwise it is canceled and a new one is created for the current balance.
+func ChargeFor(ctx context.Context, orderID string) (c Charge, err error) {
+	if !Enabled() {
+		return c, ErrNotConfigured
+	}
+
+	tx, err := db().BeginTx(ctx, nil)
+
+	if err != nil {
+		return c, err
+	}
+
+	defer tx.Rollback()
+
+	// lock the order row so concurrent requests don't create two charges
+	var status string
+	err = tx.QueryRowContext(ctx, "SELECT status FROM `order` WHERE order_id = ? FOR UPDATE", orderID).Scan(&status)
+
+	if err == sql.ErrNoRows {
+		return c, err
+	}
+
+	if err != nil {
+		return c, errwrap.Wrapf("Error locking order: {{err}}", err)
+	}
+
+	b, err := payment.GetBalanceTx(ctx, tx, orderID)
+
+	if err != nil {
+		return c, err
+	}
+
+	var amount = b.Outstanding()
+
+	// canceled orders aren't charged, even if something is owed
+	if status == "CANCELED" {
+		amount = 0
+	}
+
+	rows, err := tx.QueryContext(ctx,
+		"SELECT "+columns+" FROM pix_charge WHERE order_id = ? AND status = 'PENDING' ORDER BY created_time DESC", orderID)
+
+	if err != nil {
+		return c, errwrap.Wrapf("Error querying pix charges: {{err}}", err)
+	}
+
+	var found bool
+
+	if rows.Next() {
+		err = sqlstruct.Scan(&c, rows)
+		found = true
+	}
+
+	rows.Close()
+
+	if err != nil {
+		return c, errwrap.Wrapf("Error scanning pix charge rows: {{err}}", err)
+	}
+
+	if found && c.Amount == amount {
+		return c, nil
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE pix_charge SET status = 'CANCELED' WHERE order_id = ? AND status = 'PENDING'", orderID)
+
+	if err != nil {
+		return c, errwrap.Wrapf("Error canceling pix charges: {{err}}", err)
+	}
+
+	if amount <= 0 {
+		if err := tx.Commit(); err != nil {
+			return c, err
+		}
+
+		return Charge{}, ErrNothingToCharge
+	}
+
+	c = Charge{
+		TxID:    newTxID(),
+		OrderID: orderID,
+		Amount:  amount,
+		Status:  "PENDING",
+	}
+
+	var p = Payload{
+		Key:          Config.Key,
+		MerchantName: Config.MerchantName,
+		MerchantCity: Config.MerchantCity,
+		TxID:         c.TxID,
+		Amount:       amount,
+	}
+
+	if Config.Location != "" {
+		p.Location = strings.TrimSuffix(Config.Location, "/") + "/" + c.TxID
+	}
+
+	c.Payload, err = p.Encode()
+
+	if err != nil {
+		return c, err
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO pix_charge (txid, order_id, amount, payload, status) VALUES (?, ?, ?, ?, 'PENDING')",
+		c.TxID, c.OrderID, c.Amount, c.Payload)
+
+	if err != nil {
+		return c, errwrap.Wrapf("Error inserting pix charge: {{err}}", err)
+	}
+
+	return c, tx.Commit()
+}
+
+// Confirm a pending charge was paid, recording the payment on the order
+// The payment is recorded even if it overpays the order, since the money was
+// already received. The status of the order is synced with it on the same
+// transaction.
+func Confirm(ctx context.Context, txID, employeeID string) (c Charge, err error) {
+	tx, err := db().BeginTx(ctx, nil)
+
+	if err != nil {
+		return c, err
+	}
+
+	defer tx.Rollback()
+
+	// the order is locked before the charge, as when charging it, so
+	// confirming and charging the same order don't deadlock
+	var orderID, clientID string
+	err = tx.QueryRowContext(ctx, "SELECT order_id FROM pix_charge WHERE txid = ?", txID).Scan(&orderID)
+
+	if err == sql.ErrNoRows {
+		return c, err
+	}
+
+	if err != nil {
+		return c, errwrap.Wrapf("Error querying pix charge: {{err}}", err)
+	}
+
+	err = tx.QueryRowContext(ctx, "SELECT client_id FROM `order` WHERE order_id = ? FOR UPDATE", orderID).Scan(&clientID)
+
+	if err != nil {
+		return c, errwrap.Wrapf("Error locking order: {{err}}", err)
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT "+columns+" FROM pix_charge WHERE txid = ? FOR UPDATE", txID)
+
+	if err != nil {
+		return c, errwrap.Wrapf("Error querying pix charge: {{err}}", err)
+	}
+
+	if !rows.Next() {
+		rows.Close()
+		return c, sql.ErrNoRows
+	}
+
+	err = sqlstruct.Scan(&c, rows)
+	rows.Close()
+
+	if err != nil {
+		return c, errwrap.Wrapf("Error scanning pix charge rows: {{err}}", err)
+	}
+
+	if c.Status != "PENDING" {
+		return c, ErrNotPending
+	}
+
+	paymentID, err := payment.RecordTx(ctx, tx, payment.Payment{
+		ClientID:   clientID,
+		OrderID:    c.OrderID,
+		Kind:       payment.KindPayment,
+		PriceTotal: c.Amount,
+		Provider:   "PIX",
+		Note:       "Pix " + c.TxID,
+	}, true)
+
+	if err != nil {
+		return c, err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE pix_charge SET status = 'CONFIRMED', payment_id = ?, confirmed_time = CURRENT_TIMESTAMP WHERE txid = ?",
+		paymentID, txID)
+
+	if err != nil {
+		return c, errwrap.Wrapf("Error confirming pix charge: {{err}}", err)
+	}
+
+	if err := orders.SyncTx(ctx, tx, c.OrderID, employeeID); err != nil {
+		return c, err
+	}
+
+	c.Status = "CONFIRMED"
+	c.PaymentID = &paymentID
+	return c, tx.Commit()
+}
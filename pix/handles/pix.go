@@ -0,0 +1,95 @@
+package pixhandles
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"image/png"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+	"github.com/henvic/embroidery/handles"
+	"github.com/henvic/embroidery/pix"
+	"github.com/henvic/embroidery/qr"
+	"github.com/henvic/embroidery/server"
+)
+
+var router = server.Instance.Mux
+
+func init() {
+	router().Handle("/pix/{txid}/qr.png", handles.AuthenticatedHandler(pixQRHandler))
+	router().Handle("/pix/{txid}/confirm", handles.AuthenticatedHandler(pixConfirmHandler))
+}
+
+// qrScale is the size of the modules of the QR code, in pixels
+const qrScale = 6
+
+func pixQRHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	if r.Method != http.MethodGet {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	c, err := pix.Get(r.Context(), mux.Vars(r)["txid"])
+
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		handles.ErrorHandler(w, r, "Pix charge not found", http.StatusNotFound)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	code, err := qr.Encode(c.Payload, qr.M)
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	var b bytes.Buffer
+
+	if err := png.Encode(&b, code.Image(qrScale)); err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	// the payload of a charge never changes
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Write(b.Bytes())
+}
+
+func pixConfirmHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	if r.Method != http.MethodPost {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	employeeID, _ := s.Values["user"].(string)
+	c, err := pix.Confirm(r.Context(), mux.Vars(r)["txid"], employeeID)
+
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		handles.ErrorHandler(w, r, "Pix charge not found", http.StatusNotFound)
+		return
+	case pix.ErrNotPending:
+		handles.ErrorHandler(w, r, err.Error(), http.StatusConflict)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/orders/%v", url.QueryEscape(c.OrderID)), http.StatusSeeOther)
+}
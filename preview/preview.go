@@ -0,0 +1,205 @@
+package preview
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/henvic/embroidery/stitch"
+)
+
+// margin around the design, in 0.1 mm units
+const margin = 20
+
+// threadWidth is the width of a stitch line in 0.1 mm units
+const threadWidth = 4
+
+// defaultColors are used for designs without thread information (i.e., DST)
+var defaultColors = []string{
+	"#1a0a94", "#ec0000", "#00934c", "#ffbd42", "#000000",
+	"#cc48ab", "#0f75ff", "#69260d", "#6cd900", "#808080",
+}
+
+// segment of continuous sewing with the same thread
+type segment struct {
+	color  string
+	points []image.Point
+}
+
+func segments(p *stitch.Pattern) (ss []segment) {
+	var block int
+	var current *segment
+
+	var colorOf = func(block int) string {
+		if block < len(p.Threads) && p.Threads[block].Color != "" {
+			return p.Threads[block].Color
+		}
+
+		return defaultColors[block%len(defaultColors)]
+	}
+
+	var last image.Point
+
+	for _, s := range p.Stitches {
+		var pt = image.Pt(s.X, s.Y)
+
+		switch s.Command {
+		case stitch.Normal:
+			if current == nil {
+				ss = append(ss, segment{color: colorOf(block), points: []image.Point{last}})
+				current = &ss[len(ss)-1]
+			}
+
+			current.points = append(current.points, pt)
+		case stitch.ColorChange:
+			block++
+			current = nil
+		default:
+			current = nil
+		}
+
+		last = pt
+	}
+
+	return ss
+}
+
+func bounds(p *stitch.Pattern) image.Rectangle {
+	var s = p.Stats()
+
+	return image.Rect(
+		int(math.Floor(s.MinX*10))-margin,
+		int(math.Floor(s.MinY*10))-margin,
+		int(math.Ceil(s.MaxX*10))+margin,
+		int(math.Ceil(s.MaxY*10))+margin,
+	)
+}
+
+// SVG renders a pattern as a SVG image, using 0.1 mm user units
+func SVG(w io.Writer, p *stitch.Pattern) error {
+	var b = bounds(p)
+	var bw = bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="%d %d %d %d" width="%.1fmm" height="%.1fmm">`,
+		b.Min.X, b.Min.Y, b.Dx(), b.Dy(), float64(b.Dx())/10, float64(b.Dy())/10)
+	fmt.Fprintf(bw, `<g fill="none" stroke-width="%d" stroke-linecap="round" stroke-linejoin="round">`, threadWidth)
+
+	for _, s := range segments(p) {
+		fmt.Fprintf(bw, `<path stroke="%s" d="M%d %d`, s.color, s.points[0].X, s.points[0].Y)
+
+		for _, pt := range s.points[1:] {
+			fmt.Fprintf(bw, " L%d %d", pt.X, pt.Y)
+		}
+
+		fmt.Fprint(bw, `"/>`)
+	}
+
+	fmt.Fprint(bw, "</g></svg>\n")
+	return bw.Flush()
+}
+
+// Image rasterizes a pattern on a white square image with the given size
+func Image(p *stitch.Pattern, size int) *image.RGBA {
+	var img = image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	var b = bounds(p)
+	var scale = float64(size) / math.Max(float64(b.Dx()), float64(b.Dy()))
+
+	// center the design on the image
+	var offX = (float64(size) - float64(b.Dx())*scale) / 2
+	var offY = (float64(size) - float64(b.Dy())*scale) / 2
+
+	var project = func(pt image.Point) (float64, float64) {
+		return float64(pt.X-b.Min.X)*scale + offX, float64(pt.Y-b.Min.Y)*scale + offY
+	}
+
+	for _, s := range segments(p) {
+		var c = parseColor(s.color)
+		var x0, y0 = project(s.points[0])
+
+		for _, pt := range s.points[1:] {
+			var x1, y1 = project(pt)
+			line(img, x0, y0, x1, y1, c)
+			x0, y0 = x1, y1
+		}
+	}
+
+	return img
+}
+
+// PNG renders a pattern as a PNG thumbnail with the given size
+func PNG(w io.Writer, p *stitch.Pattern, size int) error {
+	return png.Encode(w, Image(p, size))
+}
+
+// line draws an antialiased line (Xiaolin Wu's algorithm)
+func line(img *image.RGBA, x0, y0, x1, y1 float64, c color.RGBA) {
+	var steep = math.Abs(y1-y0) > math.Abs(x1-x0)
+
+	if steep {
+		x0, y0, x1, y1 = y0, x0, y1, x1
+	}
+
+	if x0 > x1 {
+		x0, x1, y0, y1 = x1, x0, y1, y0
+	}
+
+	var plot = func(x, y int, alpha float64) {
+		if steep {
+			x, y = y, x
+		}
+
+		blend(img, x, y, c, alpha)
+	}
+
+	var dx, dy = x1 - x0, y1 - y0
+	var gradient = 1.0
+
+	if dx != 0 {
+		gradient = dy / dx
+	}
+
+	var y = y0 + gradient*(math.Round(x0)-x0)
+
+	for x := int(math.Round(x0)); x <= int(math.Round(x1)); x++ {
+		var fy = math.Floor(y)
+		var frac = y - fy
+		plot(x, int(fy), 1-frac)
+		plot(x, int(fy)+1, frac)
+		y += gradient
+	}
+}
+
+func blend(img *image.RGBA, x, y int, c color.RGBA, alpha float64) {
+	if !(image.Point{x, y}.In(img.Rect)) || alpha <= 0 {
+		return
+	}
+
+	var bg = img.RGBAAt(x, y)
+	var mix = func(a, b uint8) uint8 {
+		return uint8(float64(a)*(1-alpha) + float64(b)*alpha)
+	}
+
+	img.SetRGBA(x, y, color.RGBA{mix(bg.R, c.R), mix(bg.G, c.G), mix(bg.B, c.B), 0xFF})
+}
+
+func parseColor(s string) color.RGBA {
+	if len(s) != 7 || s[0] != '#' {
+		return color.RGBA{0, 0, 0, 0xFF}
+	}
+
+	var v, err = strconv.ParseUint(s[1:], 16, 32)
+
+	if err != nil {
+		return color.RGBA{0, 0, 0, 0xFF}
+	}
+
+	return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 0xFF}
+}
@@ -0,0 +1,274 @@
+package pricinghandles
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	schema "github.com/gorilla/Schema"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+	"github.com/henvic/embroidery/employees"
+	"github.com/henvic/embroidery/handles"
+	"github.com/henvic/embroidery/pricing"
+	"github.com/henvic/embroidery/server"
+	"github.com/henvic/embroidery/sitetemplate"
+)
+
+var router = server.Instance.Mux
+
+func init() {
+	router().Handle("/pricing", handles.AuthenticatedHandler(pricingHandler))
+	router().Handle("/pricing/add", handles.AuthenticatedHandler(ruleSetAddHandler))
+	router().Handle("/pricing/{rule_set_id}", handles.AuthenticatedHandler(ruleSetEditHandler))
+}
+
+// tierRows is the number of quantity break rows shown on the form
+const tierRows = 5
+
+type ruleSetForm struct {
+	Name                string `schema:"name"`
+	PerThousandStitches int64  `schema:"per_thousand_stitches"`
+	SetupFee            int64  `schema:"setup_fee"`
+	PerColorSurcharge   int64  `schema:"per_color_surcharge"`
+	MinimumCharge       int64  `schema:"minimum_charge"`
+	Active              bool   `schema:"active"`
+
+	TierMinAmount       []string `schema:"tier_min_amount"`
+	TierDiscountPercent []string `schema:"tier_discount_percent"`
+}
+
+func pricingHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	employee, err := employees.Current(r.Context(), s)
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	rss, err := pricing.List(r.Context())
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	current, err := pricing.Current(r.Context())
+
+	if err != nil && err != sql.ErrNoRows {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	var t = sitetemplate.Template{
+		Title:     "Pricing",
+		Section:   "pricing",
+		Filenames: []string{"gui/pricing/list.html"},
+		Data: map[string]interface{}{
+			"RuleSets": rss,
+			"Current":  current,
+			"IsOwner":  employee.IsOwner(),
+		},
+		Request:        r,
+		ResponseWriter: w,
+	}
+
+	t.Respond()
+}
+
+func ruleSetAddHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	if !requireOwner(w, r, s) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		var t = sitetemplate.Template{
+			Title:     "Add a pricing rule set",
+			Section:   "pricing",
+			Filenames: []string{"gui/pricing/edit.html"},
+			Data: map[string]interface{}{
+				"RuleSet":  pricing.RuleSet{Active: true},
+				"TierRows": make([]pricing.Tier, tierRows),
+			},
+			Request:        r,
+			ResponseWriter: w,
+		}
+
+		t.Respond()
+	case http.MethodPost:
+		rs, err := decodeRuleSet(r)
+
+		if err != nil {
+			handles.ErrorHandler(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if _, err := pricing.Insert(r.Context(), rs); err != nil {
+			handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+			return
+		}
+
+		http.Redirect(w, r, "/pricing", http.StatusSeeOther)
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func ruleSetEditHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	if !requireOwner(w, r, s) {
+		return
+	}
+
+	vars := mux.Vars(r)
+	ruleSetID, ok := vars["rule_set_id"]
+
+	if !ok {
+		handles.ErrorHandler(w, r, "Missing rule set ID parameter", http.StatusBadRequest)
+		return
+	}
+
+	rs, err := pricing.Get(r.Context(), ruleSetID)
+
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		handles.ErrorHandler(w, r, "Rule set not found", http.StatusNotFound)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		var rows = make([]pricing.Tier, tierRows)
+		copy(rows, rs.Tiers)
+
+		if len(rs.Tiers) > tierRows {
+			rows = append(rs.Tiers, pricing.Tier{})
+		}
+
+		var t = sitetemplate.Template{
+			Title:     fmt.Sprintf("Pricing rule set %v", rs.Name),
+			Section:   "pricing",
+			Filenames: []string{"gui/pricing/edit.html"},
+			Data: map[string]interface{}{
+				"RuleSet":  rs,
+				"TierRows": rows,
+			},
+			Request:        r,
+			ResponseWriter: w,
+		}
+
+		t.Respond()
+	case http.MethodPost:
+		updated, err := decodeRuleSet(r)
+
+		if err != nil {
+			handles.ErrorHandler(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		updated.RuleSetID = rs.RuleSetID
+
+		if err := pricing.Update(r.Context(), updated); err != nil {
+			handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+			return
+		}
+
+		http.Redirect(w, r, "/pricing", http.StatusSeeOther)
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+// requireOwner writes a forbidden response if the employee isn't an owner
+func requireOwner(w http.ResponseWriter, r *http.Request, s *sessions.Session) bool {
+	employee, err := employees.Current(r.Context(), s)
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return false
+	}
+
+	if !employee.IsOwner() {
+		handles.ErrorHandler(w, r, "Only owners can change pricing rules", http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+func decodeRuleSet(r *http.Request) (pricing.RuleSet, error) {
+	if err := r.ParseForm(); err != nil {
+		return pricing.RuleSet{}, fmt.Errorf("Invalid form")
+	}
+
+	decoder := schema.NewDecoder()
+	decoder.IgnoreUnknownKeys(true)
+	rsf := ruleSetForm{}
+
+	if err := decoder.Decode(&rsf, r.PostForm); err != nil {
+		return pricing.RuleSet{}, fmt.Errorf("Error decoding request body: %v", err)
+	}
+
+	if strings.TrimSpace(rsf.Name) == "" {
+		return pricing.RuleSet{}, fmt.Errorf("Missing rule set name")
+	}
+
+	if rsf.PerThousandStitches < 0 || rsf.SetupFee < 0 || rsf.PerColorSurcharge < 0 || rsf.MinimumCharge < 0 {
+		return pricing.RuleSet{}, fmt.Errorf("Prices can't be negative")
+	}
+
+	var rs = pricing.RuleSet{
+		Name:                strings.TrimSpace(rsf.Name),
+		PerThousandStitches: rsf.PerThousandStitches,
+		SetupFee:            rsf.SetupFee,
+		PerColorSurcharge:   rsf.PerColorSurcharge,
+		MinimumCharge:       rsf.MinimumCharge,
+		Active:              rsf.Active,
+	}
+
+	var seen = map[int]bool{}
+
+	for i, v := range rsf.TierMinAmount {
+		if strings.TrimSpace(v) == "" || i >= len(rsf.TierDiscountPercent) {
+			continue
+		}
+
+		min, err := strconv.Atoi(strings.TrimSpace(v))
+
+		if err != nil || min < 1 {
+			return pricing.RuleSet{}, fmt.Errorf("Invalid tier quantity %q", v)
+		}
+
+		discount, err := strconv.Atoi(strings.TrimSpace(rsf.TierDiscountPercent[i]))
+
+		if err != nil || discount < 0 || discount > 100 {
+			return pricing.RuleSet{}, fmt.Errorf("Invalid tier discount %q", rsf.TierDiscountPercent[i])
+		}
+
+		if seen[min] {
+			return pricing.RuleSet{}, fmt.Errorf("Duplicated tier quantity %v", min)
+		}
+
+		seen[min] = true
+		rs.Tiers = append(rs.Tiers, pricing.Tier{
+			MinAmount:       min,
+			DiscountPercent: discount,
+		})
+	}
+
+	return rs, nil
+}
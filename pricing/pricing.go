@@ -0,0 +1,312 @@
+package pricing
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"sort"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/henvic/embroidery/asset"
+	"github.com/henvic/embroidery/server"
+	"github.com/kisielk/sqlstruct"
+	uuid "github.com/satori/go.uuid"
+)
+
+var db = server.Instance.DB
+
+// RuleSet for pricing jobs
+// All values are in cents
+type RuleSet struct {
+	RuleSetID           string `schema:"rule_set_id"`
+	Name                string `schema:"name"`
+	PerThousandStitches int64  `schema:"per_thousand_stitches"`
+	SetupFee            int64  `schema:"setup_fee"`
+	PerColorSurcharge   int64  `schema:"per_color_surcharge"`
+	MinimumCharge       int64  `schema:"minimum_charge"`
+	Active              bool   `schema:"active"`
+	CreatedTime         string `schema:"created_time"`
+	Tiers               []Tier `schema:"-"`
+}
+
+// Tier is a quantity break: jobs with at least MinAmount pieces get a
+// discount on the price of each piece
+type Tier struct {
+	RuleSetID       string
+	MinAmount       int
+	DiscountPercent int
+}
+
+// Suggestion of a price for a job
+type Suggestion struct {
+	RuleSetID       string
+	PiecePrice      int64
+	DiscountPercent int
+	Price           int64
+}
+
+// Suggest a price for sewing amount pieces of a design
+// The setup fee is charged once per job and each color after the first one
+// is charged as a surcharge on every piece.
+func (rs RuleSet) Suggest(d asset.Design, amount int) Suggestion {
+	var piece = int64(math.Ceil(float64(d.StitchCount)*float64(rs.PerThousandStitches)/1000)) +
+		int64(d.ColorChanges)*rs.PerColorSurcharge
+
+	var discount = rs.Discount(amount)
+	var price = rs.SetupFee + piece*int64(amount)*int64(100-discount)/100
+
+	if price < rs.MinimumCharge {
+		price = rs.MinimumCharge
+	}
+
+	return Suggestion{
+		RuleSetID:       rs.RuleSetID,
+		PiecePrice:      piece,
+		DiscountPercent: discount,
+		Price:           price,
+	}
+}
+
+// Discount percent for a quantity of pieces
+func (rs RuleSet) Discount(amount int) (discount int) {
+	var best = -1
+
+	for _, t := range rs.Tiers {
+		if amount >= t.MinAmount && t.MinAmount > best {
+			best, discount = t.MinAmount, t.DiscountPercent
+		}
+	}
+
+	return discount
+}
+
+// List rule sets, newest first
+func List(ctx context.Context) (rss []RuleSet, err error) {
+	stmt, err := db().PrepareContext(ctx,
+		`SELECT rule_set_id,name,per_thousand_stitches,setup_fee,per_color_surcharge,minimum_charge,active,created_time
+FROM pricing_rule_set ORDER BY created_time DESC`)
+
+	if err != nil {
+		return nil, errwrap.Wrapf("Error preparing pricing rule set query: {{err}}", err)
+	}
+
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx)
+
+	if err != nil {
+		return nil, errwrap.Wrapf("Error querying pricing rule sets: {{err}}", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var rs RuleSet
+
+		if err := sqlstruct.Scan(&rs, rows); err != nil {
+			return nil, errwrap.Wrapf("Error scanning pricing rule set rows: {{err}}", err)
+		}
+
+		rss = append(rss, rs)
+	}
+
+	return rss, rows.Err()
+}
+
+// Get rule set by ID
+func Get(ctx context.Context, ruleSetID string) (RuleSet, error) {
+	return get(ctx, `SELECT rule_set_id,name,per_thousand_stitches,setup_fee,per_color_surcharge,minimum_charge,active,created_time
+FROM pricing_rule_set WHERE rule_set_id = ?`, ruleSetID)
+}
+
+// Current rule set used for suggesting prices: the newest active one
+// sql.ErrNoRows is returned if there is no active rule set
+func Current(ctx context.Context) (RuleSet, error) {
+	return get(ctx, `SELECT rule_set_id,name,per_thousand_stitches,setup_fee,per_color_surcharge,minimum_charge,active,created_time
+FROM pricing_rule_set WHERE active = 1 ORDER BY created_time DESC LIMIT 1`)
+}
+
+func get(ctx context.Context, query string, args ...interface{}) (RuleSet, error) {
+	stmt, err := db().PrepareContext(ctx, query)
+
+	if err != nil {
+		return RuleSet{}, errwrap.Wrapf("Error preparing pricing rule set query: {{err}}", err)
+	}
+
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, args...)
+
+	if err != nil {
+		return RuleSet{}, errwrap.Wrapf("Error querying pricing rule set: {{err}}", err)
+	}
+
+	defer rows.Close()
+
+	var rs RuleSet
+
+	if ok := rows.Next(); !ok {
+		return rs, sql.ErrNoRows
+	}
+
+	if err := sqlstruct.Scan(&rs, rows); err != nil {
+		return rs, errwrap.Wrapf("Error scanning pricing rule set rows: {{err}}", err)
+	}
+
+	rs.Tiers, err = listTiers(ctx, rs.RuleSetID)
+	return rs, err
+}
+
+func listTiers(ctx context.Context, ruleSetID string) (tiers []Tier, err error) {
+	stmt, err := db().PrepareContext(ctx,
+		"SELECT rule_set_id,min_amount,discount_percent FROM pricing_tier WHERE rule_set_id = ? ORDER BY min_amount")
+
+	if err != nil {
+		return nil, errwrap.Wrapf("Error preparing pricing tier query: {{err}}", err)
+	}
+
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, ruleSetID)
+
+	if err != nil {
+		return nil, errwrap.Wrapf("Error querying pricing tiers: {{err}}", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var t Tier
+
+		if err := sqlstruct.Scan(&t, rows); err != nil {
+			return nil, errwrap.Wrapf("Error scanning pricing tier rows: {{err}}", err)
+		}
+
+		tiers = append(tiers, t)
+	}
+
+	return tiers, rows.Err()
+}
+
+// Insert rule set on database
+func Insert(ctx context.Context, rs RuleSet) (uid string, err error) {
+	uid = uuid.NewV4().String()
+
+	tx, err := db().BeginTx(ctx, nil)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO pricing_rule_set (
+		rule_set_id,
+		name,
+		per_thousand_stitches,
+		setup_fee,
+		per_color_surcharge,
+		minimum_charge,
+		active
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`)
+
+	if err != nil {
+		return "", errwrap.Wrapf("Error preparing pricing rule set insert query: {{err}}", err)
+	}
+
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx,
+		uid,
+		rs.Name,
+		rs.PerThousandStitches,
+		rs.SetupFee,
+		rs.PerColorSurcharge,
+		rs.MinimumCharge,
+		rs.Active,
+	)
+
+	if err != nil {
+		return "", errwrap.Wrapf("Error inserting pricing rule set: {{err}}", err)
+	}
+
+	if err := saveTiers(ctx, tx, uid, rs.Tiers); err != nil {
+		return "", err
+	}
+
+	return uid, tx.Commit()
+}
+
+// Update rule set, replacing its tiers
+func Update(ctx context.Context, rs RuleSet) error {
+	tx, err := db().BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `UPDATE pricing_rule_set SET
+		name = ?,
+		per_thousand_stitches = ?,
+		setup_fee = ?,
+		per_color_surcharge = ?,
+		minimum_charge = ?,
+		active = ?
+		WHERE rule_set_id = ?`)
+
+	if err != nil {
+		return errwrap.Wrapf("Error preparing pricing rule set update query: {{err}}", err)
+	}
+
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx,
+		rs.Name,
+		rs.PerThousandStitches,
+		rs.SetupFee,
+		rs.PerColorSurcharge,
+		rs.MinimumCharge,
+		rs.Active,
+		rs.RuleSetID,
+	)
+
+	if err != nil {
+		return errwrap.Wrapf("Error updating pricing rule set: {{err}}", err)
+	}
+
+	if err := saveTiers(ctx, tx, rs.RuleSetID, rs.Tiers); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func saveTiers(ctx context.Context, tx *sql.Tx, ruleSetID string, tiers []Tier) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM pricing_tier WHERE rule_set_id = ?", ruleSetID); err != nil {
+		return errwrap.Wrapf("Error deleting pricing tiers: {{err}}", err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx,
+		"INSERT INTO pricing_tier (rule_set_id, min_amount, discount_percent) VALUES (?, ?, ?)")
+
+	if err != nil {
+		return errwrap.Wrapf("Error preparing pricing tier insert query: {{err}}", err)
+	}
+
+	defer stmt.Close()
+
+	sort.Slice(tiers, func(i, j int) bool {
+		return tiers[i].MinAmount < tiers[j].MinAmount
+	})
+
+	for _, t := range tiers {
+		if _, err := stmt.ExecContext(ctx, ruleSetID, t.MinAmount, t.DiscountPercent); err != nil {
+			return errwrap.Wrapf("Error inserting pricing tier: {{err}}", err)
+		}
+	}
+
+	return nil
+}
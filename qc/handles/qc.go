@@ -0,0 +1,259 @@
+package qchandles
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+	"github.com/henvic/embroidery/handles"
+	"github.com/henvic/embroidery/jobs"
+	"github.com/henvic/embroidery/qc"
+	"github.com/henvic/embroidery/schedule"
+	"github.com/henvic/embroidery/server"
+	"github.com/henvic/embroidery/sitetemplate"
+	"github.com/henvic/embroidery/storage"
+)
+
+var router = server.Instance.Mux
+
+func init() {
+	router().Handle("/jobs/{job_id}/inspections", handles.AuthenticatedHandler(inspectionAddHandler))
+	router().Handle("/inspections/photos/{photo_id:[0-9]+}", handles.AuthenticatedHandler(photoHandler))
+	router().Handle("/reports/quality", handles.AuthenticatedHandler(qualityReportHandler))
+}
+
+// maxInspectionSize is the maximum size of an inspection form, with its photos
+const maxInspectionSize = 32 << 20
+
+// photoTypes that can be attached to inspections, detected from the content
+var photoTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+func inspectionAddHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	if r.Method != http.MethodPost {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	job, err := jobs.Get(r.Context(), mux.Vars(r)["job_id"])
+
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		handles.ErrorHandler(w, r, "Job not found", http.StatusNotFound)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxInspectionSize)
+
+	if err := r.ParseMultipartForm(maxInspectionSize); err != nil && err != http.ErrNotMultipart {
+		handles.ErrorHandler(w, r, "Invalid form: photos are too big", http.StatusBadRequest)
+		return
+	}
+
+	employeeID, _ := s.Values["user"].(string)
+
+	var i = qc.Inspection{
+		JobID:      job.JobID,
+		EmployeeID: employeeID,
+		Notes:      strings.TrimSpace(r.FormValue("notes")),
+	}
+
+	var counts = map[string]*int{
+		"accepted": &i.Accepted,
+		"rejected": &i.Rejected,
+	}
+
+	for name, v := range counts {
+		if *v, err = strconv.Atoi(strings.TrimSpace(r.FormValue(name))); err != nil {
+			handles.ErrorHandler(w, r, fmt.Sprintf("Invalid number of %v pieces", name), http.StatusBadRequest)
+			return
+		}
+	}
+
+	for _, c := range qc.DefectCategories {
+		var value = strings.TrimSpace(r.FormValue("defect_" + strings.ToLower(c)))
+
+		if value == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(value)
+
+		if err != nil {
+			handles.ErrorHandler(w, r, "Invalid number of pieces with a defect", http.StatusBadRequest)
+			return
+		}
+
+		i.Defects = append(i.Defects, qc.Defect{Category: c, Quantity: n})
+	}
+
+	if err := i.Validate(); err != nil {
+		handles.ErrorHandler(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.MultipartForm != nil {
+		for _, fh := range r.MultipartForm.File["photos"] {
+			p, err := storePhoto(fh)
+
+			if err != nil {
+				handles.ErrorHandler(w, r, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			i.Photos = append(i.Photos, p)
+		}
+	}
+
+	_, err = qc.Record(r.Context(), i)
+
+	switch err {
+	case nil:
+	case qc.ErrNotInQC, qc.ErrPieceCount:
+		handles.ErrorHandler(w, r, err.Error(), http.StatusConflict)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	if err := schedule.Recompute(r.Context()); err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/jobs/%v", url.QueryEscape(job.JobID)), http.StatusSeeOther)
+}
+
+// storePhoto of an inspection, accepting only images
+func storePhoto(fh *multipart.FileHeader) (qc.Photo, error) {
+	f, err := fh.Open()
+
+	if err != nil {
+		return qc.Photo{}, fmt.Errorf("Invalid photo %v", fh.Filename)
+	}
+
+	defer f.Close()
+
+	var head = make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	var mimeType = http.DetectContentType(head[:n])
+
+	if !photoTypes[mimeType] {
+		return qc.Photo{}, fmt.Errorf("Photo %v isn't a JPEG, PNG, GIF or WebP image", fh.Filename)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return qc.Photo{}, err
+	}
+
+	stored, err := storage.Store(f, fh.Filename)
+
+	if err != nil {
+		return qc.Photo{}, err
+	}
+
+	return qc.Photo{
+		Hash:     stored.Hash,
+		Filename: filepath.Base(fh.Filename),
+		MimeType: mimeType,
+	}, nil
+}
+
+func photoHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	photoID, _ := strconv.ParseInt(mux.Vars(r)["photo_id"], 10, 64)
+	p, err := qc.GetPhoto(r.Context(), photoID)
+
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		handles.ErrorHandler(w, r, "Photo not found", http.StatusNotFound)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	f, err := storage.Open(p.Hash)
+
+	if err != nil {
+		handles.ErrorHandler(w, r, "File not found on storage", http.StatusNotFound)
+		fmt.Fprintf(os.Stderr, "Inspection photo %v file not found: %v\n", p.PhotoID, err)
+		return
+	}
+
+	defer f.Close()
+
+	// only images checked on upload are served inline
+	w.Header().Set("Content-Type", p.MimeType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, p.Filename, time.Time{}, f)
+}
+
+func qualityReportHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	var f = qc.ReportFilter{
+		From: r.URL.Query().Get("from"),
+		To:   r.URL.Query().Get("to"),
+	}
+
+	for _, d := range []string{f.From, f.To} {
+		if _, err := time.Parse("2006-01-02", d); d != "" && err != nil {
+			handles.ErrorHandler(w, r, "Invalid date", http.StatusBadRequest)
+			return
+		}
+	}
+
+	byMachine, err := qc.RatesByMachine(r.Context(), f)
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	byEmployee, err := qc.RatesByEmployee(r.Context(), f)
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	var t = sitetemplate.Template{
+		Title:     "Quality report",
+		Section:   "quality",
+		Filenames: []string{"gui/qc/report.html"},
+		Data: map[string]interface{}{
+			"Filter":     f,
+			"ByMachine":  byMachine,
+			"ByEmployee": byEmployee,
+			"Categories": qc.DefectCategories,
+		},
+		Request:        r,
+		ResponseWriter: w,
+	}
+
+	t.Respond()
+}
@@ -0,0 +1,346 @@
+// Package qc records the quality control inspections of sewed jobs and the
+// rework of the rejected pieces.
+package qc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/henvic/embroidery/jobs"
+	"github.com/henvic/embroidery/orders"
+	"github.com/henvic/embroidery/server"
+	"github.com/kisielk/sqlstruct"
+)
+
+var db = server.Instance.DB
+
+// DefectCategories of the rejected pieces
+var DefectCategories = []string{
+	"THREAD_BREAK",
+	"MISREGISTRATION",
+	"PUCKERING",
+	"WRONG_COLOR",
+	"GARMENT_DAMAGE",
+}
+
+var (
+	// ErrNotInQC is used when inspecting a job that isn't on quality control
+	ErrNotInQC = errors.New("Only jobs on quality control can be inspected")
+
+	// ErrPieceCount is used when the accepted and rejected pieces don't add
+	// up to the amount of the job
+	ErrPieceCount = errors.New("Accepted and rejected pieces must add up to the amount of the job")
+)
+
+// Inspection of the pieces of a job
+// Rejected pieces are redone by the rework job.
+type Inspection struct {
+	InspectionID  int64
+	JobID         string
+	EmployeeID    string
+	EmployeeEmail *string
+	Accepted      int
+	Rejected      int
+	Notes         string
+	ReworkJobID   *string
+	Time          string
+
+	Defects []Defect `sql:"-"`
+	Photos  []Photo  `sql:"-"`
+}
+
+// Defect found on the rejected pieces of an inspection
+type Defect struct {
+	InspectionID int64
+	Category     string
+	Quantity     int
+}
+
+// Photo of an inspection, kept on the storage
+type Photo struct {
+	PhotoID      int64
+	InspectionID int64
+	Hash         string
+	Filename     string
+	MimeType     string
+}
+
+// ValidCategory tells if a defect category exists
+func ValidCategory(category string) bool {
+	for _, c := range DefectCategories {
+		if c == category {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Validate the counts of an inspection
+// Each defect is found on at most all of the rejected pieces, and pieces can
+// have more than one defect.
+func (i Inspection) Validate() error {
+	if i.Accepted < 0 || i.Rejected < 0 {
+		return fmt.Errorf("Piece counts can't be negative")
+	}
+
+	var defects int
+
+	for _, d := range i.Defects {
+		if !ValidCategory(d.Category) {
+			return fmt.Errorf("Unknown defect category %v", d.Category)
+		}
+
+		if d.Quantity < 0 || d.Quantity > i.Rejected {
+			return fmt.Errorf("Pieces with %v must be between 0 and the rejected pieces",
+				strings.Replace(strings.ToLower(d.Category), "_", " ", -1))
+		}
+
+		defects += d.Quantity
+	}
+
+	if i.Rejected > 0 && defects == 0 {
+		return fmt.Errorf("Rejected pieces need at least one defect")
+	}
+
+	return nil
+}
+
+// Record an inspection, finishing the job
+// A rework job for the rejected pieces is queued on the same order and
+// machine. It isn't charged, as the pieces were paid for by the inspected job.
+// The status of the order is synced with its jobs on the same transaction.
+func Record(ctx context.Context, i Inspection) (int64, error) {
+	if err := i.Validate(); err != nil {
+		return 0, err
+	}
+
+	tx, err := db().BeginTx(ctx, nil)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	var amount int
+
+	// lock the job row so it's inspected only once
+	orderID, status, err := jobs.LockTx(ctx, tx, i.JobID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.QueryRowContext(ctx, "SELECT amount FROM `job` WHERE job_id = ?", i.JobID).Scan(&amount); err != nil {
+		return 0, errwrap.Wrapf("Error querying job amount: {{err}}", err)
+	}
+
+	if status != "QC" {
+		return 0, ErrNotInQC
+	}
+
+	if i.Accepted+i.Rejected != amount {
+		return 0, ErrPieceCount
+	}
+
+	res, err := tx.ExecContext(ctx,
+		"INSERT INTO qc_inspection (job_id, employee_id, accepted, rejected, notes) VALUES (?, ?, ?, ?, ?)",
+		i.JobID, i.EmployeeID, i.Accepted, i.Rejected, i.Notes)
+
+	if err != nil {
+		return 0, errwrap.Wrapf("Error inserting inspection: {{err}}", err)
+	}
+
+	id, err := res.LastInsertId()
+
+	if err != nil {
+		return 0, err
+	}
+
+	for _, d := range i.Defects {
+		if d.Quantity == 0 {
+			continue
+		}
+
+		_, err := tx.ExecContext(ctx, "INSERT INTO qc_defect (inspection_id, category, quantity) VALUES (?, ?, ?)",
+			id, d.Category, d.Quantity)
+
+		if err != nil {
+			return 0, errwrap.Wrapf("Error inserting defect: {{err}}", err)
+		}
+	}
+
+	for _, p := range i.Photos {
+		_, err := tx.ExecContext(ctx, "INSERT INTO qc_photo (inspection_id, hash, filename, mime_type) VALUES (?, ?, ?, ?)",
+			id, p.Hash, p.Filename, p.MimeType)
+
+		if err != nil {
+			return 0, errwrap.Wrapf("Error inserting inspection photo: {{err}}", err)
+		}
+	}
+
+	if err := jobs.FinishQCTx(ctx, tx, i.JobID, i.EmployeeID); err != nil {
+		return 0, err
+	}
+
+	if i.Rejected != 0 {
+		if err := rework(ctx, tx, id, i); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := orders.SyncTx(ctx, tx, orderID, i.EmployeeID); err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// rework queues a job for the rejected pieces of an inspection
+func rework(ctx context.Context, tx *sql.Tx, inspectionID int64, i Inspection) error {
+	// the job is read through the transaction holding its lock
+	job, err := jobs.GetTx(ctx, tx, i.JobID)
+
+	if err != nil {
+		return err
+	}
+
+	var r = jobs.Job{
+		OrderID:               job.OrderID,
+		ClientID:              job.ClientID,
+		AssetID:               job.AssetID,
+		MachineID:             job.MachineID,
+		Amount:                i.Rejected,
+		Complexity:            job.Complexity,
+		Placement:             job.Placement,
+		EstimatedPieceSeconds: job.EstimatedPieceSeconds,
+		DueDate:               job.DueDate,
+		Priority:              job.Priority,
+		ReworkOfJobID:         &job.JobID,
+	}
+
+	reworkID, err := jobs.InsertTx(ctx, tx, r)
+
+	if err != nil {
+		return errwrap.Wrapf("Error inserting rework job: {{err}}", err)
+	}
+
+	if err := jobs.UpdateStatusTx(ctx, tx, reworkID, "QUEUE", i.EmployeeID); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE qc_inspection SET rework_job_id = ? WHERE inspection_id = ?",
+		reworkID, inspectionID)
+
+	if err != nil {
+		return errwrap.Wrapf("Error linking rework job: {{err}}", err)
+	}
+
+	return nil
+}
+
+// ListInspections of a job, with their defects and photos, oldest first
+func ListInspections(ctx context.Context, jobID string) (inspections []Inspection, err error) {
+	rows, err := db().QueryContext(ctx, `SELECT i.inspection_id,i.job_id,i.employee_id,a.email AS employee_email,
+i.accepted,i.rejected,i.notes,i.rework_job_id,i.time
+FROM qc_inspection i LEFT JOIN authentication a ON a.employee_id = i.employee_id
+WHERE i.job_id = ? ORDER BY i.inspection_id`, jobID)
+
+	if err != nil {
+		return nil, errwrap.Wrapf("Error querying inspections: {{err}}", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var i Inspection
+
+		if err := sqlstruct.Scan(&i, rows); err != nil {
+			return nil, errwrap.Wrapf("Error scanning inspection rows: {{err}}", err)
+		}
+
+		inspections = append(inspections, i)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for n := range inspections {
+		if inspections[n].Defects, err = listDefects(ctx, inspections[n].InspectionID); err != nil {
+			return nil, err
+		}
+
+		if inspections[n].Photos, err = listPhotos(ctx, inspections[n].InspectionID); err != nil {
+			return nil, err
+		}
+	}
+
+	return inspections, nil
+}
+
+func listDefects(ctx context.Context, inspectionID int64) (defects []Defect, err error) {
+	rows, err := db().QueryContext(ctx,
+		"SELECT inspection_id,category,quantity FROM qc_defect WHERE inspection_id = ? ORDER BY category",
+		inspectionID)
+
+	if err != nil {
+		return nil, errwrap.Wrapf("Error querying defects: {{err}}", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var d Defect
+
+		if err := sqlstruct.Scan(&d, rows); err != nil {
+			return nil, errwrap.Wrapf("Error scanning defect rows: {{err}}", err)
+		}
+
+		defects = append(defects, d)
+	}
+
+	return defects, rows.Err()
+}
+
+func listPhotos(ctx context.Context, inspectionID int64) (photos []Photo, err error) {
+	rows, err := db().QueryContext(ctx,
+		"SELECT photo_id,inspection_id,hash,filename,mime_type FROM qc_photo WHERE inspection_id = ? ORDER BY photo_id",
+		inspectionID)
+
+	if err != nil {
+		return nil, errwrap.Wrapf("Error querying inspection photos: {{err}}", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var p Photo
+
+		if err := sqlstruct.Scan(&p, rows); err != nil {
+			return nil, errwrap.Wrapf("Error scanning inspection photo rows: {{err}}", err)
+		}
+
+		photos = append(photos, p)
+	}
+
+	return photos, rows.Err()
+}
+
+// GetPhoto by ID
+func GetPhoto(ctx context.Context, photoID int64) (p Photo, err error) {
+	err = db().QueryRowContext(ctx,
+		"SELECT photo_id, inspection_id, hash, filename, mime_type FROM qc_photo WHERE photo_id = ?",
+		photoID).Scan(&p.PhotoID, &p.InspectionID, &p.Hash, &p.Filename, &p.MimeType)
+
+	if err != nil && err != sql.ErrNoRows {
+		err = errwrap.Wrapf("Error querying inspection photo: {{err}}", err)
+	}
+
+	return p, err
+}
@@ -0,0 +1,123 @@
+package qc
+
+import (
+	"context"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/kisielk/sqlstruct"
+)
+
+// Rate of defects of the inspected pieces of a machine or employee
+type Rate struct {
+	ID          string
+	Name        string
+	Inspections int
+	Inspected   int
+	Rejected    int
+
+	// Defects by category
+	Defects map[string]int `sql:"-"`
+}
+
+// RejectedPercent of the inspected pieces
+func (r Rate) RejectedPercent() float64 {
+	if r.Inspected == 0 {
+		return 0
+	}
+
+	return float64(r.Rejected) * 100 / float64(r.Inspected)
+}
+
+// ReportFilter limits the inspections on a report to a period
+// From and To are dates (2006-01-02), both inclusive, and optional.
+type ReportFilter struct {
+	From string
+	To   string
+}
+
+func (f ReportFilter) where() (q string, args []interface{}) {
+	q = " WHERE 1 = 1"
+
+	if f.From != "" {
+		q += " AND i.time >= ?"
+		args = append(args, f.From)
+	}
+
+	if f.To != "" {
+		q += " AND i.time < DATE_ADD(?, INTERVAL 1 DAY)"
+		args = append(args, f.To)
+	}
+
+	return q, args
+}
+
+// RatesByMachine the jobs were sewed on
+func RatesByMachine(ctx context.Context, f ReportFilter) ([]Rate, error) {
+	var joins = " FROM qc_inspection i JOIN job j ON j.job_id = i.job_id JOIN machine m ON m.machine_id = j.machine_id"
+	return rates(ctx, f, "j.machine_id", "m.name", joins)
+}
+
+// RatesByEmployee who worked on the jobs
+// Pieces of jobs worked on by more than one employee count for each of them.
+func RatesByEmployee(ctx context.Context, f ReportFilter) ([]Rate, error) {
+	var joins = ` FROM qc_inspection i
+JOIN (SELECT DISTINCT job_id, employee_id FROM work_session) w ON w.job_id = i.job_id
+JOIN authentication a ON a.employee_id = w.employee_id`
+	return rates(ctx, f, "w.employee_id", "a.email", joins)
+}
+
+func rates(ctx context.Context, f ReportFilter, idColumn, nameColumn, joins string) (rs []Rate, err error) {
+	var where, args = f.where()
+
+	rows, err := db().QueryContext(ctx, "SELECT "+idColumn+" AS id, "+nameColumn+` AS name,
+COUNT(*) AS inspections, SUM(i.accepted + i.rejected) AS inspected, SUM(i.rejected) AS rejected`+
+		joins+where+" GROUP BY "+idColumn+", "+nameColumn+" ORDER BY "+nameColumn, args...)
+
+	if err != nil {
+		return nil, errwrap.Wrapf("Error querying defect rates: {{err}}", err)
+	}
+
+	defer rows.Close()
+
+	var index = map[string]int{}
+
+	for rows.Next() {
+		var r = Rate{Defects: map[string]int{}}
+
+		if err := sqlstruct.Scan(&r, rows); err != nil {
+			return nil, errwrap.Wrapf("Error scanning defect rate rows: {{err}}", err)
+		}
+
+		index[r.ID] = len(rs)
+		rs = append(rs, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	defects, err := db().QueryContext(ctx, "SELECT "+idColumn+", d.category, SUM(d.quantity)"+
+		joins+" JOIN qc_defect d ON d.inspection_id = i.inspection_id"+where+
+		" GROUP BY "+idColumn+", d.category", args...)
+
+	if err != nil {
+		return nil, errwrap.Wrapf("Error querying defects: {{err}}", err)
+	}
+
+	defer defects.Close()
+
+	for defects.Next() {
+		var id, category string
+		var quantity int
+
+		if err := defects.Scan(&id, &category, &quantity); err != nil {
+			return nil, errwrap.Wrapf("Error scanning defect rows: {{err}}", err)
+		}
+
+		if n, ok := index[id]; ok {
+			rs[n].Defects[category] = quantity
+		}
+	}
+
+	return rs, defects.Err()
+}
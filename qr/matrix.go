@@ -0,0 +1,345 @@
+package qr
+
+func newCode(version int, level Level, data []byte) *Code {
+	var size = version*4 + 17
+	var c = &Code{
+		Version: version,
+		Size:    size,
+		Level:   level,
+	}
+
+	c.modules = make([][]bool, size)
+	c.isFunction = make([][]bool, size)
+
+	for i := range c.modules {
+		c.modules[i] = make([]bool, size)
+		c.isFunction[i] = make([]bool, size)
+	}
+
+	c.drawFunctionPatterns()
+	c.drawCodewords(interleave(data, version, level))
+
+	// use the mask with the lowest penalty
+	var best = -1
+	var bestPenalty int
+
+	for mask := 0; mask < 8; mask++ {
+		c.applyMask(mask)
+		c.drawFormatBits(mask)
+
+		if p := c.penalty(); best == -1 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+
+		// masks are XORed, so applying it again undoes it
+		c.applyMask(mask)
+	}
+
+	c.Mask = best
+	c.applyMask(best)
+	c.drawFormatBits(best)
+	c.isFunction = nil
+	return c
+}
+
+func (c *Code) set(x, y int, dark bool) {
+	c.modules[y][x] = dark
+	c.isFunction[y][x] = true
+}
+
+func (c *Code) drawFunctionPatterns() {
+	for i := 0; i < c.Size; i++ {
+		c.set(6, i, i%2 == 0)
+		c.set(i, 6, i%2 == 0)
+	}
+
+	c.drawFinder(3, 3)
+	c.drawFinder(c.Size-4, 3)
+	c.drawFinder(3, c.Size-4)
+
+	var positions = alignmentPositions(c.Version)
+	var last = len(positions) - 1
+
+	for i, x := range positions {
+		for j, y := range positions {
+			// skip the corners with finder patterns
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+
+			c.drawAlignment(x, y)
+		}
+	}
+
+	// reserve the format areas; the bits are drawn once the mask is chosen
+	c.drawFormatBits(0)
+	c.drawVersion()
+}
+
+func (c *Code) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			var xx, yy = x + dx, y + dy
+
+			if xx < 0 || yy < 0 || xx >= c.Size || yy >= c.Size {
+				continue
+			}
+
+			var d = maxInt(abs(dx), abs(dy))
+			c.set(xx, yy, d != 2 && d != 4)
+		}
+	}
+}
+
+func (c *Code) drawAlignment(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			c.set(x+dx, y+dy, maxInt(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+func alignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+
+	var numAlign = version/7 + 2
+	var step = (version*4 + numAlign*2 + 1) / (numAlign*2 - 2) * 2
+
+	if version == 32 {
+		step = 26
+	}
+
+	var size = version*4 + 17
+	var positions = make([]int, numAlign)
+	positions[0] = 6
+
+	for i, pos := numAlign-1, size-7; i >= 1; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+
+	return positions
+}
+
+func (c *Code) drawFormatBits(mask int) {
+	var data = formatBits[c.Level]<<3 | mask
+	var rem = data
+
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+
+	var bits = (data<<10 | rem) ^ 0x5412
+	var bit = func(i int) bool {
+		return (bits>>uint(i))&1 == 1
+	}
+
+	// first copy, around the top left finder
+	for i := 0; i <= 5; i++ {
+		c.set(8, i, bit(i))
+	}
+
+	c.set(8, 7, bit(6))
+	c.set(8, 8, bit(7))
+	c.set(7, 8, bit(8))
+
+	for i := 9; i < 15; i++ {
+		c.set(14-i, 8, bit(i))
+	}
+
+	// second copy, split between the other finders
+	for i := 0; i < 8; i++ {
+		c.set(c.Size-1-i, 8, bit(i))
+	}
+
+	for i := 8; i < 15; i++ {
+		c.set(8, c.Size-15+i, bit(i))
+	}
+
+	// the dark module
+	c.set(8, c.Size-8, true)
+}
+
+func (c *Code) drawVersion() {
+	if c.Version < 7 {
+		return
+	}
+
+	var rem = c.Version
+
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+
+	var bits = c.Version<<12 | rem
+
+	for i := 0; i < 18; i++ {
+		var dark = (bits>>uint(i))&1 == 1
+		var a, b = c.Size - 11 + i%3, i / 3
+		c.set(a, b, dark)
+		c.set(b, a, dark)
+	}
+}
+
+// drawCodewords in the zigzag order, two columns at a time from the right
+func (c *Code) drawCodewords(data []byte) {
+	var i int
+
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		// skip the vertical timing pattern
+		if right == 6 {
+			right = 5
+		}
+
+		for vert := 0; vert < c.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				var x = right - j
+				var y = vert
+
+				if (right+1)&2 == 0 {
+					y = c.Size - 1 - vert
+				}
+
+				if c.isFunction[y][x] || i >= len(data)*8 {
+					continue
+				}
+
+				c.modules[y][x] = (data[i>>3]>>uint(7-i&7))&1 == 1
+				i++
+			}
+		}
+	}
+}
+
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.isFunction[y][x] {
+				continue
+			}
+
+			var invert bool
+
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+
+			if invert {
+				c.modules[y][x] = !c.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty of the symbol, following the four rules of the specification
+func (c *Code) penalty() (p int) {
+	var dark int
+
+	var at = func(x, y int, vertical bool) bool {
+		if vertical {
+			return c.modules[x][y]
+		}
+
+		return c.modules[y][x]
+	}
+
+	for _, vertical := range []bool{false, true} {
+		for y := 0; y < c.Size; y++ {
+			var run int
+
+			for x := 0; x < c.Size; x++ {
+				if x == 0 || at(x, y, vertical) != at(x-1, y, vertical) {
+					run = 1
+				} else {
+					run++
+				}
+
+				switch {
+				case run == 5:
+					p += 3
+				case run > 5:
+					p++
+				}
+
+				// finder-like 1:1:3:1:1 patterns with four light modules on a side
+				if x >= 10 && c.finderLike(x-10, y, vertical, at) {
+					p += 40
+				}
+			}
+		}
+	}
+
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			var v = c.modules[y][x]
+
+			if v {
+				dark++
+			}
+
+			if x > 0 && y > 0 && v == c.modules[y][x-1] && v == c.modules[y-1][x] && v == c.modules[y-1][x-1] {
+				p += 3
+			}
+		}
+	}
+
+	var total = c.Size * c.Size
+	var k = (abs(dark*20-total*10) + total - 1) / total
+	return p + (k-1)*10
+}
+
+var finderPatterns = [2][11]bool{
+	{true, false, true, true, true, false, true, false, false, false, false},
+	{false, false, false, false, true, false, true, true, true, false, true},
+}
+
+func (c *Code) finderLike(x, y int, vertical bool, at func(x, y int, vertical bool) bool) bool {
+	for _, pattern := range finderPatterns {
+		var match = true
+
+		for i, v := range pattern {
+			if at(x+i, y, vertical) != v {
+				match = false
+				break
+			}
+		}
+
+		if match {
+			return true
+		}
+	}
+
+	return false
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+
+	return v
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
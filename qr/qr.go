@@ -0,0 +1,294 @@
+// Package qr encodes QR codes (ISO/IEC 18004) for tickets, labels and
+// payment codes. Only the byte and alphanumeric modes are supported.
+package qr
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"strings"
+)
+
+// ErrTooLong is used when the data doesn't fit on the largest QR code
+var ErrTooLong = errors.New("Data too long for a QR code")
+
+// Level of error correction
+type Level int
+
+// Error correction levels, recovering about 7%, 15%, 25% and 30% of the code
+const (
+	L Level = iota
+	M
+	Q
+	H
+)
+
+// formatBits of each level, as written on the format information
+var formatBits = map[Level]int{L: 1, M: 0, Q: 3, H: 2}
+
+// eccPerBlock and numBlocks by level and version (index 0 is unused)
+var eccPerBlock = [4][41]int{
+	{-1, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{-1, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+var numBlocks = [4][41]int{
+	{-1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{-1, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{-1, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+const alphanumeric = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+
+// Code is a QR code symbol
+type Code struct {
+	Version int
+	Size    int
+	Level   Level
+	Mask    int
+
+	modules    [][]bool
+	isFunction [][]bool
+}
+
+// Dark tells if the module at x, y is dark
+func (c *Code) Dark(x, y int) bool {
+	return x >= 0 && y >= 0 && x < c.Size && y < c.Size && c.modules[y][x]
+}
+
+// Image of the code with the given module size in pixels, including the
+// quiet zone of four modules
+func (c *Code) Image(scale int) *image.Gray {
+	var size = (c.Size + 8) * scale
+	var img = image.NewGray(image.Rect(0, 0, size, size))
+
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			var v = color.Gray{Y: 255}
+
+			if c.Dark(x/scale-4, y/scale-4) {
+				v = color.Gray{Y: 0}
+			}
+
+			img.SetGray(x, y, v)
+		}
+	}
+
+	return img
+}
+
+// Encode text on the smallest QR code with the error correction level
+func Encode(text string, level Level) (*Code, error) {
+	var alnum = isAlphanumeric(text)
+
+	for version := 1; version <= 40; version++ {
+		var bits = encodeData(text, alnum, version)
+		var capacity = dataCodewords(version, level) * 8
+
+		if len(bits) > capacity {
+			continue
+		}
+
+		return newCode(version, level, pad(bits, capacity)), nil
+	}
+
+	return nil, ErrTooLong
+}
+
+func isAlphanumeric(text string) bool {
+	for _, r := range text {
+		if !strings.ContainsRune(alphanumeric, r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+type bitBuffer []bool
+
+func (b *bitBuffer) append(v, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, (v>>uint(i))&1 == 1)
+	}
+}
+
+func encodeData(text string, alnum bool, version int) (b bitBuffer) {
+	if alnum {
+		b.append(0x2, 4)
+		b.append(len(text), countBits(version, 9, 11, 13))
+
+		for i := 0; i < len(text); i += 2 {
+			var v = strings.IndexByte(alphanumeric, text[i])
+
+			if i+1 < len(text) {
+				b.append(v*45+strings.IndexByte(alphanumeric, text[i+1]), 11)
+			} else {
+				b.append(v, 6)
+			}
+		}
+
+		return b
+	}
+
+	b.append(0x4, 4)
+	b.append(len(text), countBits(version, 8, 16, 16))
+
+	for i := 0; i < len(text); i++ {
+		b.append(int(text[i]), 8)
+	}
+
+	return b
+}
+
+func countBits(version, small, medium, large int) int {
+	switch {
+	case version <= 9:
+		return small
+	case version <= 26:
+		return medium
+	default:
+		return large
+	}
+}
+
+// pad the data with the terminator and the pad codewords
+func pad(b bitBuffer, capacity int) []byte {
+	for i := 0; i < 4 && len(b) < capacity; i++ {
+		b = append(b, false)
+	}
+
+	for len(b)%8 != 0 {
+		b = append(b, false)
+	}
+
+	for i := 0; len(b) < capacity; i++ {
+		if i%2 == 0 {
+			b.append(0xEC, 8)
+		} else {
+			b.append(0x11, 8)
+		}
+	}
+
+	var data = make([]byte, len(b)/8)
+
+	for i, bit := range b {
+		if bit {
+			data[i/8] |= 1 << uint(7-i%8)
+		}
+	}
+
+	return data
+}
+
+// rawDataModules of a version: the modules left for data and error correction
+func rawDataModules(version int) int {
+	var result = (16*version+128)*version + 64
+
+	if version >= 2 {
+		var numAlign = version/7 + 2
+		result -= (25*numAlign-10)*numAlign - 55
+
+		if version >= 7 {
+			result -= 36
+		}
+	}
+
+	return result
+}
+
+func dataCodewords(version int, level Level) int {
+	return rawDataModules(version)/8 - eccPerBlock[level][version]*numBlocks[level][version]
+}
+
+// interleave the data blocks with their error correction codewords
+func interleave(data []byte, version int, level Level) []byte {
+	var blocks = numBlocks[level][version]
+	var eccLen = eccPerBlock[level][version]
+	var raw = rawDataModules(version) / 8
+	var shortBlocks = blocks - raw%blocks
+	var shortLen = raw/blocks - eccLen
+
+	var dataBlocks, eccBlocks [][]byte
+	var k int
+
+	for i := 0; i < blocks; i++ {
+		var n = shortLen
+
+		if i >= shortBlocks {
+			n++
+		}
+
+		var d = data[k : k+n]
+		k += n
+		dataBlocks = append(dataBlocks, d)
+		eccBlocks = append(eccBlocks, reedSolomon(d, eccLen))
+	}
+
+	var result []byte
+
+	for i := 0; i <= shortLen; i++ {
+		for _, d := range dataBlocks {
+			if i < len(d) {
+				result = append(result, d[i])
+			}
+		}
+	}
+
+	for i := 0; i < eccLen; i++ {
+		for _, e := range eccBlocks {
+			result = append(result, e[i])
+		}
+	}
+
+	return result
+}
+
+// reedSolomon error correction codewords of the data, over GF(2^8) with the
+// 0x11D polynomial
+func reedSolomon(data []byte, degree int) []byte {
+	// generator polynomial: the product of (x - 2^i) for i < degree
+	var divisor = make([]byte, degree)
+	divisor[degree-1] = 1
+	var root byte = 1
+
+	for i := 0; i < degree; i++ {
+		for j := 0; j < degree; j++ {
+			divisor[j] = gfMultiply(divisor[j], root)
+
+			if j+1 < degree {
+				divisor[j] ^= divisor[j+1]
+			}
+		}
+
+		root = gfMultiply(root, 0x02)
+	}
+
+	var result = make([]byte, degree)
+
+	for _, b := range data {
+		var factor = b ^ result[0]
+		copy(result, result[1:])
+		result[degree-1] = 0
+
+		for i := range result {
+			result[i] ^= gfMultiply(divisor[i], factor)
+		}
+	}
+
+	return result
+}
+
+func gfMultiply(x, y byte) byte {
+	var z int
+
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>uint(i))&1) * int(x)
+	}
+
+	return byte(z)
+}
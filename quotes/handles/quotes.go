@@ -0,0 +1,539 @@
+package quoteshandles
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+	"github.com/henvic/embroidery/address"
+	"github.com/henvic/embroidery/asset"
+	"github.com/henvic/embroidery/clients"
+	"github.com/henvic/embroidery/handles"
+	"github.com/henvic/embroidery/machines"
+	"github.com/henvic/embroidery/pricing"
+	"github.com/henvic/embroidery/quotes"
+	"github.com/henvic/embroidery/server"
+	"github.com/henvic/embroidery/sitetemplate"
+	"github.com/henvic/embroidery/ticket"
+)
+
+var router = server.Instance.Mux
+
+func init() {
+	router().Handle("/quotes", handles.AuthenticatedHandler(quotesHandler))
+	router().Handle("/quotes/add", handles.AuthenticatedHandler(quoteAddHandler))
+	router().Handle("/quotes/{quote_id}", handles.AuthenticatedHandler(quoteEditHandler))
+	router().Handle("/quotes/{quote_id}/items", handles.AuthenticatedHandler(quoteItemAddHandler))
+	router().Handle("/quotes/{quote_id}/items/{item_id:[0-9]+}/delete", handles.AuthenticatedHandler(quoteItemDeleteHandler))
+	router().Handle("/quotes/{quote_id}/quote.pdf", handles.AuthenticatedHandler(quotePDFHandler))
+}
+
+// validity of new quotes, in days
+const validity = 15
+
+// getQuote of the request, writing the error response if it fails
+func getQuote(w http.ResponseWriter, r *http.Request) (q quotes.Quote, ok bool) {
+	q, err := quotes.Get(r.Context(), mux.Vars(r)["quote_id"])
+
+	switch err {
+	case nil:
+		return q, true
+	case sql.ErrNoRows:
+		handles.ErrorHandler(w, r, "Quote not found", http.StatusNotFound)
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+	}
+
+	return q, false
+}
+
+func quotesHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	var f = quotes.ListFilter{
+		ClientID: r.URL.Query().Get("client_id"),
+		Status:   r.URL.Query().Get("status"),
+	}
+
+	if _, ok := quotes.GetStatusFilter()[f.Status]; !ok {
+		handles.ErrorHandler(w, r, "Quote status doesn't exists", http.StatusBadRequest)
+		return
+	}
+
+	if err := quotes.ExpireOverdue(r.Context()); err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	qs, err := quotes.List(r.Context(), f)
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	cs, err := clients.List(r.Context(), clients.ListFilter{})
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	var t = sitetemplate.Template{
+		Title:     "Orçamentos",
+		Section:   "quotes",
+		Filenames: []string{"gui/quotes/list.html"},
+		Data: map[string]interface{}{
+			"Quotes":        qs,
+			"ClientsMap":    clients.GetClientsMapFromSlice(cs),
+			"ClientID":      f.ClientID,
+			"AllStatus":     quotes.GetStatusFilter(),
+			"CurrentStatus": f.Status,
+		},
+		Request:        r,
+		ResponseWriter: w,
+	}
+
+	t.Respond()
+}
+
+func quoteAddHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	switch r.Method {
+	case http.MethodGet:
+		cs, err := clients.List(r.Context(), clients.ListFilter{})
+
+		if err != nil {
+			handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+			return
+		}
+
+		var t = sitetemplate.Template{
+			Title:     "Criando orçamento",
+			Section:   "quotes",
+			Filenames: []string{"gui/quotes/add.html"},
+			Data: map[string]interface{}{
+				"Clients":       cs,
+				"MaybeClientID": r.URL.Query().Get("maybe_client_id"),
+				"ExpiryDate":    time.Now().AddDate(0, 0, validity).Format("2006-01-02"),
+			},
+			Request:        r,
+			ResponseWriter: w,
+		}
+
+		t.Respond()
+	case http.MethodPost:
+		quotePostAddHandler(w, r, s)
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func quotePostAddHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	if err := r.ParseForm(); err != nil {
+		handles.ErrorHandler(w, r, "Invalid form", http.StatusBadRequest)
+		return
+	}
+
+	employeeID, _ := s.Values["user"].(string)
+
+	var q = quotes.Quote{
+		ClientID:   r.PostFormValue("client_id"),
+		ExpiryDate: r.PostFormValue("expiry_date"),
+		Notes:      strings.TrimSpace(r.PostFormValue("notes")),
+		EmployeeID: employeeID,
+	}
+
+	switch _, err := clients.Get(r.Context(), q.ClientID); err {
+	case nil:
+	case sql.ErrNoRows:
+		handles.ErrorHandler(w, r, "Client not found", http.StatusBadRequest)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	if _, err := time.Parse("2006-01-02", q.ExpiryDate); err != nil {
+		handles.ErrorHandler(w, r, "Invalid expiry date", http.StatusBadRequest)
+		return
+	}
+
+	added, err := quotes.Insert(r.Context(), q)
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/quotes/%v", url.QueryEscape(added)), http.StatusSeeOther)
+}
+
+func quoteEditHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	if r.Method == http.MethodPost {
+		quoteStatusHandler(w, r, s)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := quotes.ExpireOverdue(r.Context()); err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	q, ok := getQuote(w, r)
+
+	if !ok {
+		return
+	}
+
+	client, err := clients.Get(r.Context(), q.ClientID)
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	as, err := asset.List(r.Context(), asset.ListFilter{
+		ClientID: client.ClientID,
+	})
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	addresses, err := address.List(r.Context(), address.ListFilter{
+		ClientID: client.ClientID,
+	})
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	ms, err := machines.List(r.Context(), machines.ListFilter{
+		ShowInactive: true,
+	})
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	var assets = map[string]asset.Asset{}
+
+	for _, a := range as {
+		assets[a.AssetID] = a
+	}
+
+	var machinesMap = machines.GetMachinesMapFromSlice(ms)
+
+	// assets and machines of the items, by item ID
+	var itemAssets = map[int64]asset.Asset{}
+	var itemMachines = map[int64]machines.Machine{}
+
+	for _, i := range q.Items {
+		if i.AssetID != nil {
+			itemAssets[i.QuoteItemID] = assets[*i.AssetID]
+		}
+
+		if i.MachineID != nil {
+			itemMachines[i.QuoteItemID] = machinesMap[*i.MachineID]
+		}
+	}
+
+	var active []machines.Machine
+
+	for _, m := range ms {
+		if m.Active {
+			active = append(active, m)
+		}
+	}
+
+	var t = sitetemplate.Template{
+		Title:     fmt.Sprintf("Orçamento para %v %v", client.FirstName, client.LastName),
+		Section:   "quotes",
+		Filenames: []string{"gui/quotes/quote.html"},
+		Data: map[string]interface{}{
+			"Quote":        q,
+			"Client":       client,
+			"Assets":       as,
+			"Addresses":    addresses,
+			"Machines":     active,
+			"ItemAssets":   itemAssets,
+			"ItemMachines": itemMachines,
+			"NextStatus":   quotes.NextStatus(q.Status),
+		},
+		Request:        r,
+		ResponseWriter: w,
+	}
+
+	t.Respond()
+}
+
+func quoteStatusHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	q, ok := getQuote(w, r)
+
+	if !ok {
+		return
+	}
+
+	var status = r.FormValue("status")
+
+	switch status {
+	case "draft", "sent", "rejected", "expired":
+	case "accepted":
+		quoteAcceptHandler(q, w, r)
+		return
+	default:
+		handles.ErrorHandler(w, r, "Invalid quote status", http.StatusBadRequest)
+		return
+	}
+
+	switch err := quotes.UpdateStatus(r.Context(), q.QuoteID, status); err {
+	case nil:
+	case quotes.ErrInvalidTransition:
+		handles.ErrorHandler(w, r,
+			fmt.Sprintf("Quote can't change from %v to %v", strings.ToLower(q.Status), status),
+			http.StatusConflict)
+		return
+	case quotes.ErrNoItems:
+		handles.ErrorHandler(w, r, err.Error(), http.StatusConflict)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/quotes/%v", url.QueryEscape(q.QuoteID)), http.StatusSeeOther)
+}
+
+func quoteAcceptHandler(q quotes.Quote, w http.ResponseWriter, r *http.Request) {
+	var addressID = r.FormValue("client_address_id")
+
+	switch _, err := address.Get(r.Context(), q.ClientID, addressID); err {
+	case nil:
+	case sql.ErrNoRows:
+		handles.ErrorHandler(w, r, "Choose an address of the client before accepting the quote.", http.StatusBadRequest)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	orderID, err := quotes.Accept(r.Context(), q.QuoteID, addressID)
+
+	switch err {
+	case nil:
+	case quotes.ErrInvalidTransition:
+		handles.ErrorHandler(w, r, "Only sent quotes can be accepted", http.StatusConflict)
+		return
+	case quotes.ErrExpired, quotes.ErrNoItems, quotes.ErrIncompleteItem:
+		handles.ErrorHandler(w, r, err.Error(), http.StatusConflict)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/orders/%v", url.QueryEscape(orderID)), http.StatusSeeOther)
+}
+
+func quoteItemAddHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	if r.Method != http.MethodPost {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	q, ok := getQuote(w, r)
+
+	if !ok {
+		return
+	}
+
+	var i = quotes.Item{
+		QuoteID:     q.QuoteID,
+		Description: strings.TrimSpace(r.FormValue("description")),
+		Placement:   strings.TrimSpace(r.FormValue("placement")),
+	}
+
+	if i.Description == "" || len([]rune(i.Description)) > 255 || len([]rune(i.Placement)) > 255 {
+		handles.ErrorHandler(w, r, "Description is required and, with the placement, limited to 255 characters", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+
+	if i.Amount, err = strconv.Atoi(r.FormValue("amount")); err != nil || i.Amount < 1 {
+		handles.ErrorHandler(w, r, "Invalid amount", http.StatusBadRequest)
+		return
+	}
+
+	if assetID := r.FormValue("asset_id"); assetID != "" {
+		switch _, err := asset.Get(r.Context(), q.ClientID, assetID); err {
+		case nil:
+			i.AssetID = &assetID
+		case sql.ErrNoRows:
+			handles.ErrorHandler(w, r, "Asset not found", http.StatusBadRequest)
+			return
+		default:
+			handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+			return
+		}
+	}
+
+	if machineID := r.FormValue("machine_id"); machineID != "" {
+		m, err := machines.Get(r.Context(), machineID)
+
+		switch {
+		case err == sql.ErrNoRows || (err == nil && !m.Active):
+			handles.ErrorHandler(w, r, "Machine not found", http.StatusBadRequest)
+			return
+		case err != nil:
+			handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+			return
+		}
+
+		i.MachineID = &machineID
+	}
+
+	if price := r.FormValue("price"); price != "" {
+		if i.Price, err = strconv.ParseInt(price, 10, 64); err != nil || i.Price < 0 {
+			handles.ErrorHandler(w, r, "Invalid price", http.StatusBadRequest)
+			return
+		}
+	} else if i.Price, err = suggestPrice(r, i); err != nil {
+		handles.ErrorHandler(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch err := quotes.AddItem(r.Context(), i); err {
+	case nil:
+	case quotes.ErrNotDraft:
+		handles.ErrorHandler(w, r, err.Error(), http.StatusConflict)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/quotes/%v", url.QueryEscape(q.QuoteID)), http.StatusSeeOther)
+}
+
+// suggestPrice of an item without a price from the current pricing rules
+func suggestPrice(r *http.Request, i quotes.Item) (int64, error) {
+	var errNoSuggestion = fmt.Errorf("Price is required for items without a design")
+
+	if i.AssetID == nil {
+		return 0, errNoSuggestion
+	}
+
+	d, err := asset.GetDesign(r.Context(), *i.AssetID)
+
+	if err == sql.ErrNoRows {
+		return 0, errNoSuggestion
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	rs, err := pricing.Current(r.Context())
+
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("Price is required: there are no active pricing rules")
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	return rs.Suggest(d, i.Amount).Price, nil
+}
+
+func quoteItemDeleteHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	if r.Method != http.MethodPost {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var quoteID = mux.Vars(r)["quote_id"]
+	itemID, _ := strconv.ParseInt(mux.Vars(r)["item_id"], 10, 64)
+
+	switch err := quotes.RemoveItem(r.Context(), quoteID, itemID); err {
+	case nil:
+	case sql.ErrNoRows:
+		handles.ErrorHandler(w, r, "Quote not found", http.StatusNotFound)
+		return
+	case quotes.ErrNotDraft:
+		handles.ErrorHandler(w, r, err.Error(), http.StatusConflict)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/quotes/%v", url.QueryEscape(quoteID)), http.StatusSeeOther)
+}
+
+func quotePDFHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	if r.Method != http.MethodGet {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	d, err := ticket.LoadQuote(r.Context(), mux.Vars(r)["quote_id"])
+
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		handles.ErrorHandler(w, r, "Quote not found", http.StatusNotFound)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	// render first so errors aren't sent as a broken document
+	var b bytes.Buffer
+
+	if err := d.Write(&b); err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"quote-%v.pdf\"", d.Quote.QuoteID))
+	w.Write(b.Bytes())
+}
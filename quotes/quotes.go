@@ -0,0 +1,439 @@
+// Package quotes keeps the price quotes given to clients before they commit
+// to an order. Accepted quotes become orders with a job for each item.
+package quotes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/henvic/embroidery/jobs"
+	"github.com/henvic/embroidery/orders"
+	"github.com/henvic/embroidery/server"
+	"github.com/kisielk/sqlstruct"
+	uuid "github.com/satori/go.uuid"
+)
+
+var db = server.Instance.DB
+
+// Quote of a client
+// OrderID is set when the quote is accepted.
+type Quote struct {
+	QuoteID     string
+	ClientID    string
+	Status      string
+	ExpiryDate  string
+	Notes       string
+	OrderID     *string
+	EmployeeID  string
+	CreatedTime string
+
+	Items []Item `sql:"-"`
+}
+
+// Item of a quote, sewed as a job of the order when the quote is accepted
+// AssetID and MachineID can be left empty while the quote is a draft, but
+// are required for accepting it.
+type Item struct {
+	QuoteItemID int64
+	QuoteID     string
+	Position    int
+	Description string
+	AssetID     *string
+	MachineID   *string
+	Amount      int
+	Placement   string
+	Price       int64
+}
+
+var (
+	// ErrInvalidTransition is used when a quote can't move to the requested status
+	ErrInvalidTransition = errors.New("Invalid quote status transition")
+
+	// ErrNotDraft is used when changing the items of a quote that was sent
+	ErrNotDraft = errors.New("Only draft quotes can be changed")
+
+	// ErrNoItems is used when sending or accepting a quote without items
+	ErrNoItems = errors.New("The quote has no items")
+
+	// ErrIncompleteItem is used when accepting a quote with items without
+	// an asset or a machine
+	ErrIncompleteItem = errors.New("Every item needs an asset and a machine before the quote is accepted")
+
+	// ErrExpired is used when accepting a quote after its expiry date
+	ErrExpired = errors.New("The quote expired")
+)
+
+// transitions of the status of a quote
+// Sent quotes go back to DRAFT to be revised. ACCEPTED, REJECTED and EXPIRED
+// are final.
+var transitions = map[string][]string{
+	"DRAFT": {"SENT"},
+	"SENT":  {"DRAFT", "ACCEPTED", "REJECTED", "EXPIRED"},
+}
+
+// NextStatus lists the statuses a quote can move to from a status
+func NextStatus(status string) []string {
+	return transitions[strings.ToUpper(status)]
+}
+
+// CanTransition tells if a quote can move from a status to another
+func CanTransition(from, to string) bool {
+	for _, s := range NextStatus(from) {
+		if s == strings.ToUpper(to) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Total price of the items
+func (q Quote) Total() (total int64) {
+	for _, i := range q.Items {
+		total += i.Price
+	}
+
+	return total
+}
+
+const columns = "quote_id,client_id,status,expiry_date,notes,order_id,employee_id,created_time"
+
+// ListFilter sets the filter settings
+type ListFilter struct {
+	ClientID string
+	Status   string
+}
+
+// List quotes, newest first
+// Items aren't loaded.
+func List(ctx context.Context, f ListFilter) (qs []Quote, err error) {
+	var q = "SELECT " + columns + " FROM quote"
+	var where []string
+	var args []interface{}
+
+	if f.ClientID != "" {
+		where = append(where, "client_id = ?")
+		args = append(args, f.ClientID)
+	}
+
+	if f.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, f.Status)
+	}
+
+	if len(where) != 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
+	}
+
+	rows, err := db().QueryContext(ctx, q+" ORDER BY created_time DESC", args...)
+
+	if err != nil {
+		return nil, errwrap.Wrapf("Error querying quotes: {{err}}", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var q Quote
+
+		if err := sqlstruct.Scan(&q, rows); err != nil {
+			return nil, errwrap.Wrapf("Error scanning quote rows: {{err}}", err)
+		}
+
+		qs = append(qs, q)
+	}
+
+	return qs, rows.Err()
+}
+
+// Get quote by ID, with its items
+func Get(ctx context.Context, quoteID string) (q Quote, err error) {
+	rows, err := db().QueryContext(ctx, "SELECT "+columns+" FROM quote WHERE quote_id = ?", quoteID)
+
+	if err != nil {
+		return q, errwrap.Wrapf("Error querying quote: {{err}}", err)
+	}
+
+	defer rows.Close()
+
+	if !rows.Next() {
+		return q, sql.ErrNoRows
+	}
+
+	if err := sqlstruct.Scan(&q, rows); err != nil {
+		return q, errwrap.Wrapf("Error scanning quote rows: {{err}}", err)
+	}
+
+	rows.Close()
+
+	q.Items, err = listItems(ctx, db(), quoteID)
+	return q, err
+}
+
+// querier is either the database or a transaction
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func listItems(ctx context.Context, qr querier, quoteID string) (items []Item, err error) {
+	rows, err := qr.QueryContext(ctx, `SELECT quote_item_id,quote_id,position,description,asset_id,machine_id,
+amount,placement,price FROM quote_item WHERE quote_id = ? ORDER BY position`, quoteID)
+
+	if err != nil {
+		return nil, errwrap.Wrapf("Error querying quote items: {{err}}", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var i Item
+
+		if err := sqlstruct.Scan(&i, rows); err != nil {
+			return nil, errwrap.Wrapf("Error scanning quote item rows: {{err}}", err)
+		}
+
+		items = append(items, i)
+	}
+
+	return items, rows.Err()
+}
+
+// Insert a draft quote
+func Insert(ctx context.Context, q Quote) (uid string, err error) {
+	uid = uuid.NewV4().String()
+
+	_, err = db().ExecContext(ctx,
+		"INSERT INTO quote (quote_id, client_id, status, expiry_date, notes, employee_id) VALUES (?, ?, 'DRAFT', ?, ?, ?)",
+		uid, q.ClientID, q.ExpiryDate, q.Notes, q.EmployeeID)
+
+	if err != nil {
+		return "", errwrap.Wrapf("Error inserting quote: {{err}}", err)
+	}
+
+	return uid, nil
+}
+
+// lockStatus of a quote until the end of the transaction
+func lockStatus(ctx context.Context, tx *sql.Tx, quoteID string) (status string, err error) {
+	err = tx.QueryRowContext(ctx, "SELECT status FROM quote WHERE quote_id = ? FOR UPDATE", quoteID).Scan(&status)
+
+	if err != nil && err != sql.ErrNoRows {
+		err = errwrap.Wrapf("Error querying quote status: {{err}}", err)
+	}
+
+	return status, err
+}
+
+// AddItem to a draft quote, after its last item
+func AddItem(ctx context.Context, i Item) error {
+	tx, err := db().BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	status, err := lockStatus(ctx, tx, i.QuoteID)
+
+	if err != nil {
+		return err
+	}
+
+	if status != "DRAFT" {
+		return ErrNotDraft
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO quote_item
+(quote_id, position, description, asset_id, machine_id, amount, placement, price)
+SELECT ?, IFNULL(MAX(position), 0) + 1, ?, ?, ?, ?, ?, ? FROM quote_item WHERE quote_id = ?`,
+		i.QuoteID, i.Description, i.AssetID, i.MachineID, i.Amount, i.Placement, i.Price, i.QuoteID)
+
+	if err != nil {
+		return errwrap.Wrapf("Error inserting quote item: {{err}}", err)
+	}
+
+	return tx.Commit()
+}
+
+// RemoveItem from a draft quote
+func RemoveItem(ctx context.Context, quoteID string, itemID int64) error {
+	tx, err := db().BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	status, err := lockStatus(ctx, tx, quoteID)
+
+	if err != nil {
+		return err
+	}
+
+	if status != "DRAFT" {
+		return ErrNotDraft
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM quote_item WHERE quote_item_id = ? AND quote_id = ?", itemID, quoteID)
+
+	if err != nil {
+		return errwrap.Wrapf("Error removing quote item: {{err}}", err)
+	}
+
+	return tx.Commit()
+}
+
+// UpdateStatus of a quote
+// Quotes are accepted with Accept, which creates their order.
+func UpdateStatus(ctx context.Context, quoteID, status string) error {
+	var to = strings.ToUpper(status)
+
+	if to == "ACCEPTED" {
+		return ErrInvalidTransition
+	}
+
+	tx, err := db().BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	from, err := lockStatus(ctx, tx, quoteID)
+
+	if err != nil {
+		return err
+	}
+
+	if !CanTransition(from, to) {
+		return ErrInvalidTransition
+	}
+
+	if to == "SENT" {
+		var items int
+
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM quote_item WHERE quote_id = ?", quoteID).Scan(&items); err != nil {
+			return errwrap.Wrapf("Error counting quote items: {{err}}", err)
+		}
+
+		if items == 0 {
+			return ErrNoItems
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE quote SET status = ? WHERE quote_id = ?", to, quoteID); err != nil {
+		return errwrap.Wrapf("Error updating quote status: {{err}}", err)
+	}
+
+	return tx.Commit()
+}
+
+// Accept a sent quote, creating an order with a job for each item
+// The prices of the jobs are the ones on the quote, not the current pricing.
+func Accept(ctx context.Context, quoteID, clientAddressID string) (orderID string, err error) {
+	tx, err := db().BeginTx(ctx, nil)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer tx.Rollback()
+
+	var q Quote
+	var expired bool
+
+	err = tx.QueryRowContext(ctx,
+		"SELECT client_id, status, expiry_date < CURRENT_DATE FROM quote WHERE quote_id = ? FOR UPDATE",
+		quoteID).Scan(&q.ClientID, &q.Status, &expired)
+
+	if err != nil {
+		return "", errwrap.Wrapf("Error querying quote: {{err}}", err)
+	}
+
+	if !CanTransition(q.Status, "ACCEPTED") {
+		return "", ErrInvalidTransition
+	}
+
+	if expired {
+		return "", ErrExpired
+	}
+
+	if q.Items, err = listItems(ctx, tx, quoteID); err != nil {
+		return "", err
+	}
+
+	if len(q.Items) == 0 {
+		return "", ErrNoItems
+	}
+
+	for _, i := range q.Items {
+		if i.AssetID == nil || i.MachineID == nil {
+			return "", ErrIncompleteItem
+		}
+	}
+
+	orderID, err = orders.InsertTx(ctx, tx, orders.Order{
+		ClientID:        q.ClientID,
+		ClientAddressID: clientAddressID,
+	})
+
+	if err != nil {
+		return "", errwrap.Wrapf("Error inserting order of quote: {{err}}", err)
+	}
+
+	for _, i := range q.Items {
+		_, err := jobs.InsertTx(ctx, tx, jobs.Job{
+			OrderID:   orderID,
+			ClientID:  q.ClientID,
+			AssetID:   *i.AssetID,
+			MachineID: *i.MachineID,
+			Amount:    i.Amount,
+			Price:     i.Price,
+			Placement: i.Placement,
+		})
+
+		if err != nil {
+			return "", errwrap.Wrapf("Error inserting job of quote: {{err}}", err)
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE quote SET status = 'ACCEPTED', order_id = ? WHERE quote_id = ?",
+		orderID, quoteID)
+
+	if err != nil {
+		return "", errwrap.Wrapf("Error updating quote status: {{err}}", err)
+	}
+
+	return orderID, tx.Commit()
+}
+
+// ExpireOverdue marks the sent quotes past their expiry date as expired
+func ExpireOverdue(ctx context.Context) error {
+	_, err := db().ExecContext(ctx, "UPDATE quote SET status = 'EXPIRED' WHERE status = 'SENT' AND expiry_date < CURRENT_DATE")
+
+	if err != nil {
+		return errwrap.Wrapf("Error expiring quotes: {{err}}", err)
+	}
+
+	return nil
+}
+
+// GetStatusFilter for quotes
+func GetStatusFilter() map[string]string {
+	return allStatusFilter
+}
+
+var allStatusFilter = map[string]string{
+	"":         "all",
+	"draft":    "draft",
+	"sent":     "sent",
+	"accepted": "accepted",
+	"rejected": "rejected",
+	"expired":  "expired",
+}
@@ -0,0 +1,127 @@
+package scanhandles
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gorilla/sessions"
+	"github.com/henvic/embroidery/handles"
+	"github.com/henvic/embroidery/jobs"
+	"github.com/henvic/embroidery/scan"
+	"github.com/henvic/embroidery/server"
+	"github.com/henvic/embroidery/sitetemplate"
+)
+
+var router = server.Instance.Mux
+
+func init() {
+	router().Handle("/scan", handles.AuthenticatedHandler(scanHandler))
+}
+
+// scanPage keeps the chosen action and reason between scans, so operators
+// only need to scan codes once an action is chosen
+type scanPage struct {
+	Action  string
+	Reason  string
+	Job     *jobs.Job
+	Message string
+	Error   string
+}
+
+func scanHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	var page = scanPage{
+		Action: strings.ToLower(r.FormValue("action")),
+		Reason: strings.ToUpper(r.FormValue("reason")),
+	}
+
+	if !scan.IsAction(page.Action) {
+		page.Action = "start"
+	}
+
+	if !jobs.ValidPauseReason(page.Reason) {
+		page.Reason = "OTHER"
+	}
+
+	var code = http.StatusOK
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		code = scanPostHandler(&page, r, s)
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var t = sitetemplate.Template{
+		Title:     "Leitura de códigos",
+		Section:   "scan",
+		Filenames: []string{"gui/scan/scan.html"},
+		Data: map[string]interface{}{
+			"Page":         page,
+			"Actions":      scan.Actions,
+			"PauseReasons": jobs.PauseReasons,
+		},
+		Request:        r,
+		ResponseWriter: w,
+	}
+
+	w.WriteHeader(code)
+	t.Respond()
+}
+
+// scanPostHandler applies the action to the job of the scanned code and
+// returns the status code of the response
+func scanPostHandler(page *scanPage, r *http.Request, s *sessions.Session) int {
+	var code = r.FormValue("code")
+
+	// printed action codes switch the action instead
+	if scan.IsAction(code) {
+		page.Action = strings.ToLower(strings.TrimSpace(code))
+		page.Message = fmt.Sprintf("Action: %v", page.Action)
+		return http.StatusOK
+	}
+
+	job, err := scan.Resolve(r.Context(), code)
+
+	switch err {
+	case nil:
+	case scan.ErrUnknownCode:
+		page.Error = fmt.Sprintf("%v: %q", err, strings.TrimSpace(code))
+		return http.StatusNotFound
+	default:
+		page.Error = http.StatusText(http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return http.StatusInternalServerError
+	}
+
+	page.Job = &job
+	employeeID, _ := s.Values["user"].(string)
+	err = scan.Apply(r.Context(), job, page.Action, page.Reason, employeeID)
+
+	switch err {
+	case nil:
+	case jobs.ErrInvalidTransition:
+		page.Error = fmt.Sprintf("Job %v can't %v while %v", job.JobID, page.Action, strings.ToLower(job.Status))
+		return http.StatusConflict
+	case jobs.ErrSessionOpen, jobs.ErrNoOpenSession:
+		page.Error = fmt.Sprintf("Job %v: %v", job.JobID, err)
+		return http.StatusConflict
+	case jobs.ErrInvalidReason, scan.ErrInvalidAction:
+		page.Error = err.Error()
+		return http.StatusBadRequest
+	default:
+		page.Error = http.StatusText(http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return http.StatusInternalServerError
+	}
+
+	if updated, err := jobs.Get(r.Context(), job.JobID); err == nil {
+		page.Job = &updated
+	}
+
+	page.Message = fmt.Sprintf("Job %v: %v", job.JobID, page.Action)
+	return http.StatusOK
+}
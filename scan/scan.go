@@ -0,0 +1,124 @@
+// Package scan applies the actions of the shop floor scanning screen to the
+// jobs whose tickets or goods labels are scanned.
+package scan
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/henvic/embroidery/goods"
+	"github.com/henvic/embroidery/jobs"
+	"github.com/henvic/embroidery/orders"
+	"github.com/henvic/embroidery/schedule"
+	"github.com/henvic/embroidery/server"
+)
+
+var db = server.Instance.DB
+
+// Actions of the scanning screen
+var Actions = []string{"start", "pause", "finish", "qc"}
+
+var (
+	// ErrUnknownCode is used when a code doesn't identify a job or good
+	ErrUnknownCode = errors.New("Code doesn't match a job or a good")
+
+	// ErrInvalidAction is used for actions not on the list of actions
+	ErrInvalidAction = errors.New("Invalid scan action")
+)
+
+// IsAction tells if a scanned code is the name of an action, so operators
+// can switch actions by scanning printed codes too
+func IsAction(code string) bool {
+	var c = strings.ToLower(strings.TrimSpace(code))
+
+	for _, a := range Actions {
+		if a == c {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Resolve the job of a scanned code: the ID of a job, printed on its ticket,
+// or the ID of a good, printed on its label
+func Resolve(ctx context.Context, code string) (jobs.Job, error) {
+	// scanners typing with caps lock on send uppercase IDs
+	code = strings.ToLower(strings.TrimSpace(code))
+
+	if code == "" {
+		return jobs.Job{}, ErrUnknownCode
+	}
+
+	job, err := jobs.Get(ctx, code)
+
+	if err != sql.ErrNoRows {
+		return job, err
+	}
+
+	good, err := goods.Get(ctx, code)
+
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		return jobs.Job{}, ErrUnknownCode
+	default:
+		return jobs.Job{}, err
+	}
+
+	return jobs.Get(ctx, good.JobID)
+}
+
+// Apply an action to a job through its state machine
+// Starting opens a work session (moving queued jobs to IN_PROGRESS), pausing
+// closes it with the reason, finishing moves the job to DONE and qc moves it
+// to quality control. Jobs on quality control are only finished by their
+// inspection.
+func Apply(ctx context.Context, job jobs.Job, action, reason, employeeID string) (err error) {
+	tx, err := db().BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	switch strings.ToLower(action) {
+	case "start":
+		err = jobs.StartTx(ctx, tx, job.JobID, employeeID)
+	case "pause":
+		err = jobs.PauseTx(ctx, tx, job.JobID, reason)
+	case "finish":
+		err = jobs.UpdateStatusTx(ctx, tx, job.JobID, "DONE", employeeID)
+	case "qc":
+		err = jobs.UpdateStatusTx(ctx, tx, job.JobID, "QC", employeeID)
+	default:
+		return ErrInvalidAction
+	}
+
+	if err != nil {
+		return err
+	}
+
+	updated, err := jobs.GetTx(ctx, tx, job.JobID)
+
+	if err != nil {
+		return err
+	}
+
+	if updated.Status == job.Status {
+		return tx.Commit()
+	}
+
+	if err := orders.SyncTx(ctx, tx, job.OrderID, employeeID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return schedule.Recompute(ctx)
+}
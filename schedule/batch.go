@@ -0,0 +1,221 @@
+package schedule
+
+import (
+	"strings"
+
+	"github.com/henvic/embroidery/asset"
+)
+
+// jobs queued on a machine are grouped in batches of consecutive jobs whose
+// thread colors fit on the needles of the machine at once, so the machine is
+// only rethreaded between batches. Priorities are respected: only jobs with
+// the same priority are grouped together. Designs without a known palette
+// (i.e., DST and EXP files) are never grouped.
+
+// Needle of a machine and the thread it should hold
+type Needle struct {
+	Number   int
+	Thread   asset.Thread
+	Rethread bool
+}
+
+// Batch of jobs sewed with the same needle setup
+// Batch 0 holds the jobs in progress.
+type Batch struct {
+	Number  int
+	Needles []Needle
+	Swaps   int
+	Entries []Entry
+}
+
+// setup of the needles of a machine, by needle index
+type setup []asset.Thread
+
+func threadKey(t asset.Thread) string {
+	if t.Color != "" {
+		return strings.ToLower(t.Color)
+	}
+
+	return strings.ToLower(t.Code)
+}
+
+// palette of distinct threads of a design, in sewing order
+func palette(d asset.Design) (p []asset.Thread) {
+	var seen = map[string]bool{}
+
+	for _, t := range d.Threads {
+		var k = threadKey(t)
+
+		if k == "" || seen[k] {
+			continue
+		}
+
+		seen[k] = true
+		p = append(p, t)
+	}
+
+	return p
+}
+
+// merge palettes, keeping the order colors are first used
+func merge(a, b []asset.Thread) []asset.Thread {
+	var m = append([]asset.Thread{}, a...)
+	var seen = map[string]bool{}
+
+	for _, t := range a {
+		seen[threadKey(t)] = true
+	}
+
+	for _, t := range b {
+		if !seen[threadKey(t)] {
+			seen[threadKey(t)] = true
+			m = append(m, t)
+		}
+	}
+
+	return m
+}
+
+func shared(a, b []asset.Thread) (n int) {
+	var seen = map[string]bool{}
+
+	for _, t := range a {
+		seen[threadKey(t)] = true
+	}
+
+	for _, t := range b {
+		if seen[threadKey(t)] {
+			n++
+		}
+	}
+
+	return n
+}
+
+// thread the colors of a palette on the needles, keeping the threads already
+// on the machine where they are. Empty needles are used first, then needles
+// holding colors the palette doesn't use. Colors that don't fit are changed
+// while sewing and aren't counted.
+func (s setup) thread(p []asset.Thread) (next setup, swaps int) {
+	next = append(setup{}, s...)
+
+	var needed = map[string]bool{}
+	var threaded = map[string]bool{}
+
+	for _, t := range p {
+		needed[threadKey(t)] = true
+	}
+
+	for _, t := range next {
+		threaded[threadKey(t)] = true
+	}
+
+	for _, t := range p {
+		if threaded[threadKey(t)] {
+			continue
+		}
+
+		var i = next.free(needed)
+
+		if i == -1 {
+			break
+		}
+
+		next[i] = t
+		threaded[threadKey(t)] = true
+		swaps++
+	}
+
+	return next, swaps
+}
+
+func (s setup) free(needed map[string]bool) int {
+	for i, t := range s {
+		if threadKey(t) == "" {
+			return i
+		}
+	}
+
+	for i, t := range s {
+		if !needed[threadKey(t)] {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (s setup) needles(previous setup) (ns []Needle) {
+	for i, t := range s {
+		ns = append(ns, Needle{
+			Number:   i + 1,
+			Thread:   t,
+			Rethread: threadKey(t) != "" && threadKey(t) != threadKey(previous[i]),
+		})
+	}
+
+	return ns
+}
+
+type batchItem struct {
+	priority int
+	palette  []asset.Thread
+	index    int
+}
+
+// group items, given in queue order, in batches that fit on the needles
+// Each batch starts with the first job left on the queue and is filled with
+// the jobs of the same priority sharing the most colors with it.
+func group(needles int, queue []batchItem) (batches [][]batchItem) {
+	var remaining = append([]batchItem{}, queue...)
+
+	for len(remaining) != 0 {
+		var first = remaining[0]
+		var b = []batchItem{first}
+		var colors = first.palette
+
+		remaining = remaining[1:]
+
+		for len(first.palette) != 0 {
+			var best = -1
+			var bestShared int
+
+			for i, it := range remaining {
+				if it.priority != first.priority {
+					break
+				}
+
+				if len(it.palette) == 0 || len(merge(colors, it.palette)) > needles {
+					continue
+				}
+
+				if s := shared(colors, it.palette); best == -1 || s > bestShared {
+					best, bestShared = i, s
+				}
+			}
+
+			if best == -1 {
+				break
+			}
+
+			b = append(b, remaining[best])
+			colors = merge(colors, remaining[best].palette)
+			remaining = append(remaining[:best], remaining[best+1:]...)
+		}
+
+		batches = append(batches, b)
+	}
+
+	return batches
+}
+
+// swapsInOrder counts the needles rethreaded sewing palettes one after another
+func swapsInOrder(s setup, palettes [][]asset.Thread) (swaps int) {
+	for _, p := range palettes {
+		var n int
+		s, n = s.thread(p)
+		swaps += n
+	}
+
+	return swaps
+}
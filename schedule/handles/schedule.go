@@ -0,0 +1,84 @@
+package schedulehandles
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+	"github.com/henvic/embroidery/handles"
+	"github.com/henvic/embroidery/machines"
+	"github.com/henvic/embroidery/schedule"
+	"github.com/henvic/embroidery/server"
+	"github.com/henvic/embroidery/sitetemplate"
+)
+
+var router = server.Instance.Mux
+
+func init() {
+	router().Handle("/machines/{machine_id}/schedule", handles.AuthenticatedHandler(machineScheduleHandler))
+}
+
+func machineScheduleHandler(w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	vars := mux.Vars(r)
+	machineID, ok := vars["machine_id"]
+
+	if !ok {
+		handles.ErrorHandler(w, r, "Missing machine ID parameter", http.StatusBadRequest)
+		return
+	}
+
+	m, err := machines.Get(r.Context(), machineID)
+
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		handles.ErrorHandler(w, r, "Machine not found", http.StatusNotFound)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if err := schedule.Recompute(r.Context()); err != nil {
+			handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+			return
+		}
+
+		http.Redirect(w, r, fmt.Sprintf("/machines/%v/schedule", url.QueryEscape(m.MachineID)), http.StatusSeeOther)
+		return
+	default:
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	plan, err := schedule.MachinePlan(r.Context(), m)
+
+	if err != nil {
+		handles.ErrorHandler(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "Internal Server Error: %v\n", err)
+		return
+	}
+
+	var t = sitetemplate.Template{
+		Title:     fmt.Sprintf("Schedule of %v", m.Name),
+		Section:   "machines",
+		Filenames: []string{"gui/schedule/machine.html"},
+		Data: map[string]interface{}{
+			"Machine": m,
+			"Plan":    plan,
+		},
+		Request:        r,
+		ResponseWriter: w,
+	}
+
+	t.Respond()
+}
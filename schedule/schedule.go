@@ -0,0 +1,491 @@
+package schedule
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/henvic/embroidery/asset"
+	"github.com/henvic/embroidery/estimate"
+	"github.com/henvic/embroidery/jobs"
+	"github.com/henvic/embroidery/machines"
+	"github.com/henvic/embroidery/server"
+	"github.com/kisielk/sqlstruct"
+)
+
+var db = server.Instance.DB
+
+// the schedule is a plan of when queued jobs are going to be sewed and on
+// which machine. It's recomputed from scratch whenever jobs change, so it's
+// never edited by hand. Jobs in progress stay on their machine and queued jobs
+// are assigned greedily, by priority and due date, to the compatible machine
+// that finishes them first. Jobs queued on a machine are then grouped in
+// batches sharing thread colors (see batch.go).
+// Machines run continuously (no work hours).
+
+const timeLayout = "2006-01-02 15:04:05"
+
+// defaultDuration is used for jobs without an estimate (i.e., not a design)
+const defaultDuration = time.Hour
+
+// Slot of a job on the timeline of a machine
+type Slot struct {
+	JobID        string
+	MachineID    string
+	Position     int
+	Batch        int
+	PlannedStart string
+	PlannedEnd   string
+}
+
+// Entry of the schedule of a machine
+type Entry struct {
+	Slot
+	Job  jobs.Job
+	Late bool
+}
+
+type assignment struct {
+	job      jobs.Job
+	machine  string
+	start    time.Time
+	end      time.Time
+	batch    int
+	estimate *estimate.Estimate
+}
+
+type timeline struct {
+	machine  machines.Machine
+	free     time.Time
+	position int
+}
+
+// plan the jobs in progress and queued on the machines
+func plan(now time.Time, ms []machines.Machine, inProgress, queued []jobs.Job,
+	designs map[string]asset.Design) (as []assignment) {
+	var timelines = map[string]*timeline{}
+	var queuedOn = map[string][]assignment{}
+
+	for _, m := range ms {
+		timelines[m.MachineID] = &timeline{machine: m, free: now}
+	}
+
+	for _, j := range inProgress {
+		var t, ok = timelines[j.MachineID]
+
+		if !ok {
+			continue
+		}
+
+		var start = parseTime(j.StartTime, now)
+		var end = start.Add(duration(j, nil))
+
+		// jobs running late are expected to finish any moment now
+		if end.Before(now) {
+			end = now
+		}
+
+		if end.After(t.free) {
+			t.free = end
+		}
+
+		as = append(as, assignment{job: j, machine: j.MachineID, start: start, end: end})
+	}
+
+	sort.SliceStable(queued, func(i, k int) bool {
+		return before(queued[i], queued[k])
+	})
+
+	for _, j := range queued {
+		var best *timeline
+		var bestEnd time.Time
+		var bestEstimate *estimate.Estimate
+
+		for _, m := range ms {
+			var t = timelines[m.MachineID]
+			d, isDesign := designs[j.AssetID]
+
+			if !m.Active || (isDesign && (!m.Supports(d.Format) || !m.Fits(d))) {
+				continue
+			}
+
+			var e *estimate.Estimate
+
+			if isDesign {
+				var je = estimate.Job(d, m.Profile(), j.Amount)
+				e = &je
+			}
+
+			var end = t.free.Add(duration(j, e))
+
+			if best == nil || end.Before(bestEnd) || (end.Equal(bestEnd) && m.MachineID == j.MachineID) {
+				best, bestEnd, bestEstimate = t, end, e
+			}
+		}
+
+		if best == nil {
+			continue
+		}
+
+		queuedOn[best.machine.MachineID] = append(queuedOn[best.machine.MachineID], assignment{
+			job:      j,
+			machine:  best.machine.MachineID,
+			start:    best.free,
+			end:      bestEnd,
+			estimate: bestEstimate,
+		})
+
+		best.free = bestEnd
+	}
+
+	for _, m := range ms {
+		as = append(as, batchQueue(m, queuedOn[m.MachineID], designs)...)
+	}
+
+	return as
+}
+
+// batchQueue reorders the jobs queued on a machine in batches sharing colors
+func batchQueue(m machines.Machine, qs []assignment, designs map[string]asset.Design) (batched []assignment) {
+	if len(qs) == 0 {
+		return nil
+	}
+
+	var items = make([]batchItem, len(qs))
+
+	for i, a := range qs {
+		items[i] = batchItem{
+			priority: a.job.Priority,
+			palette:  palette(designs[a.job.AssetID]),
+			index:    i,
+		}
+	}
+
+	var t = qs[0].start
+
+	for n, b := range group(m.Needles, items) {
+		for _, it := range b {
+			var a = qs[it.index]
+			var d = a.end.Sub(a.start)
+
+			a.start, a.end, a.batch = t, t.Add(d), n+1
+			t = a.end
+			batched = append(batched, a)
+		}
+	}
+
+	return batched
+}
+
+// before tells if a job goes before another on the queue
+func before(a, b jobs.Job) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+
+	switch {
+	case a.DueDate != nil && b.DueDate == nil:
+		return true
+	case a.DueDate == nil && b.DueDate != nil:
+		return false
+	case a.DueDate != nil && *a.DueDate != *b.DueDate:
+		return *a.DueDate < *b.DueDate
+	}
+
+	return a.CreatedTime < b.CreatedTime
+}
+
+func duration(j jobs.Job, e *estimate.Estimate) time.Duration {
+	switch {
+	case e != nil:
+		return time.Duration(e.TotalSeconds) * time.Second
+	case j.EstimatedTotalSeconds != nil:
+		return time.Duration(*j.EstimatedTotalSeconds) * time.Second
+	default:
+		return defaultDuration
+	}
+}
+
+// late tells if a job planned to end at the given time misses its due date
+// Jobs are due by the end of the day, as on the late job alerts.
+func late(plannedEnd string, dueDate *string) bool {
+	return dueDate != nil && plannedEnd[:10] > *dueDate
+}
+
+func parseTime(s *string, fallback time.Time) time.Time {
+	if s == nil {
+		return fallback
+	}
+
+	t, err := time.ParseInLocation(timeLayout, *s, time.Local)
+
+	if err != nil {
+		return fallback
+	}
+
+	return t
+}
+
+// Recompute the schedule of all machines
+// Queued jobs are reassigned to the machine chosen for them.
+func Recompute(ctx context.Context) error {
+	ms, err := machines.List(ctx, machines.ListFilter{
+		ShowInactive: true,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	inProgress, err := jobs.List(ctx, jobs.ListFilter{
+		Status: "IN_PROGRESS",
+	})
+
+	if err != nil {
+		return err
+	}
+
+	queued, err := jobs.List(ctx, jobs.ListFilter{
+		Status: "QUEUE",
+	})
+
+	if err != nil {
+		return err
+	}
+
+	var designs = map[string]asset.Design{}
+
+	for _, j := range append(inProgress, queued...) {
+		d, err := asset.GetDesign(ctx, j.AssetID)
+
+		switch err {
+		case nil:
+			designs[j.AssetID] = d
+		case sql.ErrNoRows:
+		default:
+			return err
+		}
+	}
+
+	var as = plan(time.Now(), ms, inProgress, queued, designs)
+
+	tx, err := db().BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM schedule_slot"); err != nil {
+		return errwrap.Wrapf("Error deleting schedule slots: {{err}}", err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx,
+		"INSERT INTO schedule_slot (job_id, machine_id, position, batch, planned_start, planned_end) VALUES (?, ?, ?, ?, ?, ?)")
+
+	if err != nil {
+		return errwrap.Wrapf("Error preparing schedule slot insert query: {{err}}", err)
+	}
+
+	defer stmt.Close()
+
+	var positions = map[string]int{}
+
+	for _, a := range as {
+		_, err := stmt.ExecContext(ctx,
+			a.job.JobID,
+			a.machine,
+			positions[a.machine],
+			a.batch,
+			a.start.Format(timeLayout),
+			a.end.Format(timeLayout),
+		)
+
+		if err != nil {
+			return errwrap.Wrapf("Error inserting schedule slot: {{err}}", err)
+		}
+
+		positions[a.machine]++
+
+		if a.job.Status != "QUEUE" {
+			continue
+		}
+
+		// jobs without an estimate are still moved to their machine
+		var pieceSeconds, totalSeconds *int64
+
+		if a.estimate != nil {
+			pieceSeconds, totalSeconds = &a.estimate.PieceSeconds, &a.estimate.TotalSeconds
+		}
+
+		err = jobs.AssignTx(ctx, tx, a.job.JobID, a.machine, pieceSeconds, totalSeconds)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ListSlots of a machine, in order
+func ListSlots(ctx context.Context, machineID string) (slots []Slot, err error) {
+	stmt, err := db().PrepareContext(ctx, `SELECT job_id,machine_id,position,batch,planned_start,planned_end
+FROM schedule_slot WHERE machine_id = ? ORDER BY position`)
+
+	if err != nil {
+		return nil, errwrap.Wrapf("Error preparing schedule slot query: {{err}}", err)
+	}
+
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, machineID)
+
+	if err != nil {
+		return nil, errwrap.Wrapf("Error querying schedule slots: {{err}}", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var s Slot
+
+		if err := sqlstruct.Scan(&s, rows); err != nil {
+			return nil, errwrap.Wrapf("Error scanning schedule slot rows: {{err}}", err)
+		}
+
+		slots = append(slots, s)
+	}
+
+	return slots, rows.Err()
+}
+
+// MachineSchedule lists the jobs planned for a machine, in order
+func MachineSchedule(ctx context.Context, machineID string) (entries []Entry, err error) {
+	slots, err := ListSlots(ctx, machineID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	js, err := jobs.List(ctx, jobs.ListFilter{
+		ScheduledOn: machineID,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	var byID = map[string]jobs.Job{}
+
+	for _, j := range js {
+		byID[j.JobID] = j
+	}
+
+	for _, s := range slots {
+		j, ok := byID[s.JobID]
+
+		// the schedule was recomputed while it was read
+		if !ok {
+			continue
+		}
+
+		entries = append(entries, Entry{
+			Slot: s,
+			Job:  j,
+			Late: late(s.PlannedEnd, j.DueDate),
+		})
+	}
+
+	return entries, nil
+}
+
+// Plan of the batches of a machine
+// SwapsAvoided compares the needles rethreaded with the ones needed to sew
+// the same jobs in queue order.
+type Plan struct {
+	Batches      []Batch
+	Swaps        int
+	SwapsAvoided int
+}
+
+// MachinePlan groups the schedule of a machine in batches and suggests the
+// needle setup of each one
+func MachinePlan(ctx context.Context, m machines.Machine) (p Plan, err error) {
+	entries, err := MachineSchedule(ctx, m.MachineID)
+
+	if err != nil {
+		return p, err
+	}
+
+	var palettes = map[string][]asset.Thread{}
+	var queue []Entry
+
+	for _, e := range entries {
+		if _, ok := palettes[e.Job.AssetID]; !ok {
+			d, err := asset.GetDesign(ctx, e.Job.AssetID)
+
+			switch err {
+			case nil:
+				palettes[e.Job.AssetID] = palette(d)
+			case sql.ErrNoRows:
+				palettes[e.Job.AssetID] = nil
+			default:
+				return p, err
+			}
+		}
+
+		if len(p.Batches) == 0 || p.Batches[len(p.Batches)-1].Number != e.Batch {
+			p.Batches = append(p.Batches, Batch{Number: e.Batch})
+		}
+
+		var b = &p.Batches[len(p.Batches)-1]
+		b.Entries = append(b.Entries, e)
+
+		if e.Batch != 0 {
+			queue = append(queue, e)
+		}
+	}
+
+	var s = make(setup, m.Needles)
+	var initial = s
+
+	for i := range p.Batches {
+		var b = &p.Batches[i]
+		var colors []asset.Thread
+
+		for _, e := range b.Entries {
+			colors = merge(colors, palettes[e.Job.AssetID])
+		}
+
+		next, swaps := s.thread(colors)
+
+		// the machine is already threaded for the jobs in progress
+		if b.Number == 0 {
+			b.Needles = next.needles(next)
+			s, initial = next, next
+			continue
+		}
+
+		b.Needles = next.needles(s)
+		b.Swaps = swaps
+		p.Swaps += swaps
+		s = next
+	}
+
+	sort.SliceStable(queue, func(i, k int) bool {
+		return before(queue[i].Job, queue[k].Job)
+	})
+
+	var inOrder [][]asset.Thread
+
+	for _, e := range queue {
+		inOrder = append(inOrder, palettes[e.Job.AssetID])
+	}
+
+	p.SwapsAvoided = swapsInOrder(initial, inOrder) - p.Swaps
+	return p, nil
+}
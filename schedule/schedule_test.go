@@ -0,0 +1,101 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/henvic/embroidery/jobs"
+	"github.com/henvic/embroidery/machines"
+)
+
+func local(s string) time.Time {
+	t, err := time.ParseInLocation(timeLayout, s, time.Local)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return t
+}
+
+func strptr(s string) *string {
+	return &s
+}
+
+func int64ptr(i int64) *int64 {
+	return &i
+}
+
+// TestPlanStalledMachine checks a queued job becomes late when the job in
+// progress before it isn't finished, without any change to the queue
+func TestPlanStalledMachine(t *testing.T) {
+	var ms = []machines.Machine{
+		{MachineID: "m1", Needles: 6, Active: true},
+	}
+
+	var inProgress = []jobs.Job{
+		{
+			JobID:                 "running",
+			Status:                "IN_PROGRESS",
+			MachineID:             "m1",
+			StartTime:             strptr("2026-10-19 08:00:00"),
+			EstimatedTotalSeconds: int64ptr(4 * 3600),
+		},
+	}
+
+	var queued = []jobs.Job{
+		{
+			JobID:                 "queued",
+			Status:                "QUEUE",
+			MachineID:             "m1",
+			DueDate:               strptr("2026-10-20"),
+			EstimatedTotalSeconds: int64ptr(2 * 3600),
+		},
+	}
+
+	var cases = []struct {
+		now  string
+		end  string
+		late bool
+	}{
+		{"2026-10-19 09:00:00", "2026-10-19 14:00:00", false},
+		{"2026-10-20 21:00:00", "2026-10-20 23:00:00", false},
+		{"2026-10-20 23:00:00", "2026-10-21 01:00:00", true},
+	}
+
+	for _, c := range cases {
+		var end string
+
+		for _, a := range plan(local(c.now), ms, inProgress, queued, nil) {
+			if a.job.JobID == "queued" {
+				end = a.end.Format(timeLayout)
+			}
+		}
+
+		if end != c.end {
+			t.Errorf("Expected queued job planned at %v to end at %v, got %v instead", c.now, c.end, end)
+		}
+
+		if got := late(end, queued[0].DueDate); got != c.late {
+			t.Errorf("Expected queued job planned at %v to be late = %v, got %v instead", c.now, c.late, got)
+		}
+	}
+}
+
+func TestLate(t *testing.T) {
+	var cases = []struct {
+		end  string
+		due  *string
+		want bool
+	}{
+		{"2026-10-20 23:59:59", strptr("2026-10-20"), false},
+		{"2026-10-21 00:00:00", strptr("2026-10-20"), true},
+		{"2026-10-21 00:00:00", nil, false},
+	}
+
+	for _, c := range cases {
+		if got := late(c.end, c.due); got != c.want {
+			t.Errorf("Expected late(%v, %v) to be %v, got %v instead", c.end, c.due, c.want, got)
+		}
+	}
+}
@@ -49,8 +49,9 @@ func Start(ctx context.Context, params Params) error {
 
 // Params for configuring the server
 type Params struct {
-	Address string
-	DSN     string
+	Address    string
+	DSN        string
+	StorageDir string
 }
 
 // Server for handling requests
@@ -66,6 +67,7 @@ type Server struct {
 	temporaryToken string
 	email          string
 	err            error
+	background     []func(ctx context.Context)
 }
 
 // DB is a handle for MySQL
@@ -78,6 +80,11 @@ func (s *Server) Mux() *mux.Router {
 	return s.mux
 }
 
+// StorageDir is the directory where uploaded files are stored
+func (s *Server) StorageDir() string {
+	return s.params.StorageDir
+}
+
 func (s *Server) createDBHandle() error {
 	db, err := sql.Open("mysql", s.params.DSN)
 
@@ -93,12 +100,23 @@ func (s *Server) createDBHandle() error {
 	return nil
 }
 
-// Serve handlers
-func (s *Server) Serve(ctx context.Context, params Params) error {
+// Background registers a function to run alongside the HTTP server, once the
+// database is connected
+// The function should return when its context is done.
+func (s *Server) Background(f func(ctx context.Context)) {
+	s.background = append(s.background, f)
+}
+
+// Connect to the database without serving, for the setup commands
+func (s *Server) Connect(ctx context.Context, params Params) error {
 	s.ctx = ctx
 	s.params = params
+	return s.createDBHandle()
+}
 
-	if err := s.createDBHandle(); err != nil {
+// Serve handlers
+func (s *Server) Serve(ctx context.Context, params Params) error {
+	if err := s.Connect(ctx, params); err != nil {
 		return err
 	}
 
@@ -108,6 +126,10 @@ func (s *Server) Serve(ctx context.Context, params Params) error {
 		return err
 	}
 
+	for _, f := range s.background {
+		go f(s.ctx)
+	}
+
 	fmt.Fprintf(os.Stdout, "Starting server on %v\n", address)
 	return s.serve()
 }
@@ -146,7 +168,7 @@ func (s *Server) serve() error {
 	var serverErr = s.httpServer.Serve(s.netListener)
 
 	if serverErr != http.ErrServerClosed {
-		fmt.Fprintf(os.Stderr, fmt.Sprintf("Error closing authentication server: %v", serverErr))
+		fmt.Fprintf(os.Stderr, "Error closing authentication server: %v", serverErr)
 	}
 
 	w.Wait()
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/henvic/embroidery/jobs"
+	"github.com/henvic/embroidery/server"
+)
+
+var (
+	params = server.Params{}
+	fix    bool
+)
+
+// reconcile reports the orders whose price_total drifted from the sum of the
+// prices of their jobs, recomputing them with -fix
+func reconcile(ctx context.Context) (drifts []jobs.Drift, err error) {
+	if drifts, err = jobs.ListOrderPriceDrift(ctx); err != nil {
+		return nil, err
+	}
+
+	for _, d := range drifts {
+		fmt.Printf("order %v: price_total %d, jobs %d (drift %+d)\n", d.OrderID, d.Stored, d.Computed, d.Difference())
+
+		if !fix {
+			continue
+		}
+
+		if err := jobs.RecomputeOrderPrice(ctx, d.OrderID); err != nil {
+			return nil, err
+		}
+	}
+
+	return drifts, nil
+}
+
+func main() {
+	flag.Parse()
+
+	var ctx = context.Background()
+
+	if err := server.Instance.Connect(ctx, params); err != nil {
+		fmt.Fprintf(os.Stderr, "%+v\n", err)
+		os.Exit(1)
+	}
+
+	drifts, err := reconcile(ctx)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%+v\n", err)
+		os.Exit(1)
+	}
+
+	switch {
+	case len(drifts) == 0:
+		fmt.Println("All orders are consistent")
+	case fix:
+		fmt.Printf("%d orders recomputed\n", len(drifts))
+	default:
+		fmt.Printf("%d orders drifted; use -fix to recompute them\n", len(drifts))
+		os.Exit(2)
+	}
+}
+
+func init() {
+	flag.StringVar(&params.DSN, "dsn", "root@/embroidery", "dsn (MySQL)")
+	flag.BoolVar(&fix, "fix", false, "Recompute the price_total of the drifted orders")
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/henvic/embroidery/server"
 )
@@ -37,6 +38,9 @@ var basicFunctions = template.FuncMap{
 	"title": strings.Title,
 	"lower": strings.ToLower,
 	"upper": strings.ToUpper,
+	"duration": func(seconds int64) string {
+		return (time.Duration(seconds) * time.Second).String()
+	},
 }
 
 func (t *Template) isSectionActiveFunc(v interface{}) bool {
@@ -0,0 +1,242 @@
+package stitch
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// Tajima DST files have a 512 bytes ASCII header followed by 3 bytes records.
+// Each record moves the needle by up to ±121 units on each axis using a
+// balanced ternary encoding (±1, ±3, ±9, ±27, ±81) and the last two bits
+// of the third byte flag jumps, color changes and the end of the design.
+
+const dstHeaderSize = 512
+
+// dstTrimJumps is the number of consecutive jumps Tajima machines read as a trim
+const dstTrimJumps = 3
+
+type dstBit struct {
+	b     int
+	mask  byte
+	value int
+}
+
+var dstXBits = []dstBit{
+	{2, 1 << 2, 81}, {2, 1 << 3, -81},
+	{1, 1 << 2, 27}, {1, 1 << 3, -27},
+	{0, 1 << 2, 9}, {0, 1 << 3, -9},
+	{1, 1 << 0, 3}, {1, 1 << 1, -3},
+	{0, 1 << 0, 1}, {0, 1 << 1, -1},
+}
+
+var dstYBits = []dstBit{
+	{2, 1 << 5, 81}, {2, 1 << 4, -81},
+	{1, 1 << 5, 27}, {1, 1 << 4, -27},
+	{0, 1 << 5, 9}, {0, 1 << 4, -9},
+	{1, 1 << 7, 3}, {1, 1 << 6, -3},
+	{0, 1 << 7, 1}, {0, 1 << 6, -1},
+}
+
+func dstDecode(rec []byte, bits []dstBit) (v int) {
+	for _, b := range bits {
+		if rec[b.b]&b.mask != 0 {
+			v += b.value
+		}
+	}
+
+	return v
+}
+
+// ReadDST decodes a Tajima DST file
+func ReadDST(r io.Reader) (*Pattern, error) {
+	var data, err = ioutil.ReadAll(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < dstHeaderSize || !strings.HasPrefix(string(data), "LA:") {
+		return nil, ErrInvalidFile
+	}
+
+	var p = &Pattern{
+		Format: "dst",
+		Label:  dstLabel(data[:dstHeaderSize]),
+	}
+
+	var x, y int
+	var jumps []Stitch
+	var ended bool
+
+	for i := dstHeaderSize; i+3 <= len(data); i += 3 {
+		var rec = data[i : i+3]
+
+		x += dstDecode(rec, dstXBits)
+		// DST's y axis grows upwards
+		y -= dstDecode(rec, dstYBits)
+
+		switch {
+		case rec[2]&0xF3 == 0xF3:
+			ended = true
+		case rec[2]&0xC3 == 0xC3:
+			p.Stitches = appendJumps(p.Stitches, jumps)
+			jumps = nil
+			p.Stitches = append(p.Stitches, Stitch{X: x, Y: y, Command: ColorChange})
+		case rec[2]&0x83 == 0x83:
+			jumps = append(jumps, Stitch{X: x, Y: y, Command: Jump})
+		default:
+			// sequin mode toggles (0x43) carry no stitch information
+			if rec[2]&0x43 == 0x43 {
+				continue
+			}
+
+			p.Stitches = appendJumps(p.Stitches, jumps)
+			jumps = nil
+			p.Stitches = append(p.Stitches, Stitch{X: x, Y: y, Command: Normal})
+		}
+
+		if ended {
+			break
+		}
+	}
+
+	p.Stitches = appendJumps(p.Stitches, jumps)
+	p.Stitches = append(p.Stitches, Stitch{X: x, Y: y, Command: End})
+	return p, nil
+}
+
+// appendJumps decodes a run of jumps, which are read as a trim when long enough
+func appendJumps(stitches, jumps []Stitch) []Stitch {
+	if len(jumps) == 0 {
+		return stitches
+	}
+
+	if len(jumps) >= dstTrimJumps {
+		var x, y int
+
+		if len(stitches) != 0 {
+			x, y = stitches[len(stitches)-1].X, stitches[len(stitches)-1].Y
+		}
+
+		stitches = append(stitches, Stitch{X: x, Y: y, Command: Trim})
+	}
+
+	return append(stitches, jumps...)
+}
+
+func dstLabel(header []byte) string {
+	var h = string(header)
+
+	if end := strings.IndexAny(h, "\r\n"); end != -1 {
+		h = h[:end]
+	}
+
+	return strings.TrimSpace(strings.TrimPrefix(h, "LA:"))
+}
+
+// dstMaxMove is the longest move a single DST record can encode
+const dstMaxMove = 121
+
+// WriteDST encodes a pattern as a Tajima DST file
+func WriteDST(w io.Writer, p *Pattern) error {
+	var records []byte
+	var count, colorChanges int
+	var x, y int
+
+	var record = func(dx, dy int, flags byte) {
+		var rec = []byte{0, 0, 0x03 | flags}
+		dstEncode(rec, dstXBits, dx)
+		// DST's y axis grows upwards
+		dstEncode(rec, dstYBits, -dy)
+		records = append(records, rec...)
+		count++
+	}
+
+	var move = func(tx, ty int, flags byte) {
+		for {
+			var dx, dy = clamp(tx-x, dstMaxMove), clamp(ty-y, dstMaxMove)
+			x, y = x+dx, y+dy
+
+			if x == tx && y == ty {
+				record(dx, dy, flags)
+				return
+			}
+
+			record(dx, dy, 0x80)
+		}
+	}
+
+	for _, s := range p.Stitches {
+		switch s.Command {
+		case Normal:
+			move(s.X, s.Y, 0)
+		case Jump:
+			move(s.X, s.Y, 0x80)
+		case Trim:
+			for i := 0; i < dstTrimJumps; i++ {
+				record(0, 0, 0x80)
+			}
+		case ColorChange:
+			record(0, 0, 0xC0)
+			colorChanges++
+		}
+	}
+
+	records = append(records, 0, 0, 0xF3)
+
+	var s = p.Stats()
+	var h bytes.Buffer
+	fmt.Fprintf(&h, "LA:%-16.16s\r", p.Label)
+	fmt.Fprintf(&h, "ST:%7d\r", count)
+	fmt.Fprintf(&h, "CO:%3d\r", colorChanges)
+	fmt.Fprintf(&h, "+X:%5d\r", maxInt(0, int(s.MaxX*10)))
+	fmt.Fprintf(&h, "-X:%5d\r", maxInt(0, -int(s.MinX*10)))
+	fmt.Fprintf(&h, "+Y:%5d\r", maxInt(0, -int(s.MinY*10)))
+	fmt.Fprintf(&h, "-Y:%5d\r", maxInt(0, int(s.MaxY*10)))
+	fmt.Fprintf(&h, "AX:%s\r", dstSigned(x))
+	fmt.Fprintf(&h, "AY:%s\r", dstSigned(-y))
+	fmt.Fprintf(&h, "MX:%s\r", dstSigned(0))
+	fmt.Fprintf(&h, "MY:%s\r", dstSigned(0))
+	fmt.Fprintf(&h, "PD:%6s\r", "******")
+	h.WriteByte(0x1A)
+
+	var header = bytes.Repeat([]byte{' '}, dstHeaderSize)
+	copy(header, h.Bytes())
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	_, err := w.Write(records)
+	return err
+}
+
+// dstEncode sets the bits for v using balanced ternary digits
+func dstEncode(rec []byte, bits []dstBit, v int) {
+	// bits are ordered from the highest to the lowest digit, in +/- pairs
+	for i := len(bits) - 2; i >= 0; i -= 2 {
+		var digit = ((v % 3) + 3) % 3
+
+		switch digit {
+		case 1:
+			rec[bits[i].b] |= bits[i].mask
+			v--
+		case 2:
+			rec[bits[i+1].b] |= bits[i+1].mask
+			v++
+		}
+
+		v /= 3
+	}
+}
+
+func dstSigned(v int) string {
+	if v < 0 {
+		return fmt.Sprintf("-%5d", -v)
+	}
+
+	return fmt.Sprintf("+%5d", v)
+}
@@ -0,0 +1,68 @@
+package stitch
+
+import (
+	"io"
+	"os"
+	"testing"
+)
+
+// testdata/square.dst sews a 10 mm square, changes the color, moves away with
+// three jumps (read as a trim) and sews a corner of 5 mm on each side.
+func TestReadDST(t *testing.T) {
+	f, err := os.Open("testdata/square.dst")
+
+	if err != nil {
+		t.Fatalf("Expected no error opening fixture, got %v instead", err)
+	}
+
+	defer f.Close()
+
+	p, err := ReadDST(f)
+
+	if err != nil {
+		t.Fatalf("Expected no error reading, got %v instead", err)
+	}
+
+	if p.Label != "SQUARE" {
+		t.Errorf("Expected label to be SQUARE, got %v instead", p.Label)
+	}
+
+	var want = Stats{
+		Stitches:     7,
+		ColorChanges: 1,
+		Trims:        1,
+		Jumps:        3,
+		MinX:         0,
+		MinY:         0,
+		MaxX:         20,
+		MaxY:         10,
+		ThreadLength: 40,
+	}
+
+	if got := p.Stats(); got != want {
+		t.Errorf("Expected stats to be %+v, got %+v instead", want, got)
+	}
+
+	if last := p.Stitches[len(p.Stitches)-1]; last != (Stitch{X: 200, Y: 50, Command: End}) {
+		t.Errorf("Expected design to end at (200, 50), got %v instead", last)
+	}
+}
+
+func TestReadDSTInvalidHeader(t *testing.T) {
+	f, err := os.Open("testdata/square.dst")
+
+	if err != nil {
+		t.Fatalf("Expected no error opening fixture, got %v instead", err)
+	}
+
+	defer f.Close()
+
+	// skip the label, so the header doesn't start with LA:
+	if _, err := f.Seek(3, io.SeekStart); err != nil {
+		t.Fatalf("Expected no error seeking, got %v instead", err)
+	}
+
+	if _, err := ReadDST(f); err != ErrInvalidFile {
+		t.Errorf("Expected error to be %v, got %v instead", ErrInvalidFile, err)
+	}
+}
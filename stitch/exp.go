@@ -0,0 +1,115 @@
+package stitch
+
+import (
+	"io"
+	"io/ioutil"
+)
+
+// Melco EXP files have no header: each record is a pair of signed bytes with
+// the relative move of the needle. A 0x80 byte escapes a control record,
+// followed by the command and a move.
+
+const (
+	expEscape      = 0x80
+	expColorChange = 0x01
+	expJump        = 0x04
+	expTrim        = 0x80
+)
+
+// expMaxMove is the longest move a single EXP record can encode
+const expMaxMove = 127
+
+// ReadEXP decodes a Melco EXP file
+func ReadEXP(r io.Reader) (*Pattern, error) {
+	var data, err = ioutil.ReadAll(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var p = &Pattern{
+		Format: "exp",
+	}
+
+	var x, y int
+
+	for i := 0; i+1 < len(data); i += 2 {
+		if data[i] != expEscape {
+			x += int(int8(data[i]))
+			// EXP's y axis grows upwards
+			y -= int(int8(data[i+1]))
+			p.Stitches = append(p.Stitches, Stitch{X: x, Y: y, Command: Normal})
+			continue
+		}
+
+		var control = data[i+1]
+		i += 2
+
+		if i+1 >= len(data) {
+			break
+		}
+
+		var dx, dy = int(int8(data[i])), -int(int8(data[i+1]))
+
+		switch control {
+		case expTrim:
+			p.Stitches = append(p.Stitches, Stitch{X: x, Y: y, Command: Trim})
+		case expColorChange:
+			p.Stitches = append(p.Stitches, Stitch{X: x, Y: y, Command: ColorChange})
+
+			if dx != 0 || dy != 0 {
+				x, y = x+dx, y+dy
+				p.Stitches = append(p.Stitches, Stitch{X: x, Y: y, Command: Jump})
+			}
+		case expJump:
+			x, y = x+dx, y+dy
+			p.Stitches = append(p.Stitches, Stitch{X: x, Y: y, Command: Jump})
+		default:
+			x, y = x+dx, y+dy
+			p.Stitches = append(p.Stitches, Stitch{X: x, Y: y, Command: Normal})
+		}
+	}
+
+	p.Stitches = append(p.Stitches, Stitch{X: x, Y: y, Command: End})
+	return p, nil
+}
+
+// WriteEXP encodes a pattern as a Melco EXP file
+func WriteEXP(w io.Writer, p *Pattern) error {
+	var data []byte
+	var x, y int
+
+	var move = func(tx, ty int, jump bool) {
+		for {
+			var dx, dy = clamp(tx-x, expMaxMove), clamp(ty-y, expMaxMove)
+			x, y = x+dx, y+dy
+
+			if !jump && x == tx && y == ty {
+				data = append(data, byte(int8(dx)), byte(int8(-dy)))
+				return
+			}
+
+			data = append(data, expEscape, expJump, byte(int8(dx)), byte(int8(-dy)))
+
+			if x == tx && y == ty {
+				return
+			}
+		}
+	}
+
+	for _, s := range p.Stitches {
+		switch s.Command {
+		case Normal:
+			move(s.X, s.Y, false)
+		case Jump:
+			move(s.X, s.Y, true)
+		case Trim:
+			data = append(data, expEscape, expTrim, 0x07, 0x00)
+		case ColorChange:
+			data = append(data, expEscape, expColorChange, 0x00, 0x00)
+		}
+	}
+
+	_, err := w.Write(data)
+	return err
+}
@@ -0,0 +1,399 @@
+package stitch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// PEC is the Brother stitch block embedded in PES files (or standalone .pec).
+// The header holds a label and the color indices for the PEC palette below,
+// and the stitch block uses relative moves that are either 7 bits long or,
+// when the high bit is set, 12 bits long with jump/trim flags.
+
+const (
+	pecColorCountOffset  = 48
+	pecStitchBlockOffset = 512
+	pecStitchDataOffset  = 528
+)
+
+const (
+	pecLongForm = 0x80
+	pecTrim     = 0x20
+	pecJump     = 0x10
+)
+
+// pecThreads is the fixed Brother PEC palette. Index 0 is unused
+var pecThreads = []Thread{
+	{"#000000", "Unknown", "0"},
+	{"#1a0a94", "Prussian Blue", "1"},
+	{"#0f75ff", "Blue", "2"},
+	{"#00934c", "Teal Green", "3"},
+	{"#babdfe", "Corn Flower Blue", "4"},
+	{"#ec0000", "Red", "5"},
+	{"#e4995a", "Reddish Brown", "6"},
+	{"#cc48ab", "Magenta", "7"},
+	{"#fdc4fa", "Light Lilac", "8"},
+	{"#dd84cd", "Lilac", "9"},
+	{"#6bd38a", "Mint Green", "10"},
+	{"#e4a945", "Deep Gold", "11"},
+	{"#ffbd42", "Orange", "12"},
+	{"#ffe600", "Yellow", "13"},
+	{"#6cd900", "Lime Green", "14"},
+	{"#c1a941", "Brass", "15"},
+	{"#b5ad97", "Silver", "16"},
+	{"#ba9c5f", "Russet Brown", "17"},
+	{"#faf59e", "Cream Brown", "18"},
+	{"#808080", "Pewter", "19"},
+	{"#000000", "Black", "20"},
+	{"#001cdf", "Ultramarine", "21"},
+	{"#df00b8", "Royal Purple", "22"},
+	{"#626262", "Dark Gray", "23"},
+	{"#69260d", "Dark Brown", "24"},
+	{"#ff0060", "Deep Rose", "25"},
+	{"#bf8200", "Light Brown", "26"},
+	{"#f39178", "Salmon Pink", "27"},
+	{"#ff6805", "Vermilion", "28"},
+	{"#f0f0f0", "White", "29"},
+	{"#c832cd", "Violet", "30"},
+	{"#b0bf9b", "Seacrest", "31"},
+	{"#65bfeb", "Sky Blue", "32"},
+	{"#ffba04", "Pumpkin", "33"},
+	{"#fff06c", "Cream Yellow", "34"},
+	{"#feca15", "Khaki", "35"},
+	{"#f38101", "Clay Brown", "36"},
+	{"#37a923", "Leaf Green", "37"},
+	{"#23465f", "Peacock Blue", "38"},
+	{"#a6a695", "Gray", "39"},
+	{"#cebfa6", "Warm Gray", "40"},
+	{"#96aa02", "Dark Olive", "41"},
+	{"#ffe3c6", "Linen", "42"},
+	{"#ff99d7", "Pink", "43"},
+	{"#007004", "Deep Green", "44"},
+	{"#edccfb", "Lavender", "45"},
+	{"#c089d8", "Wisteria Violet", "46"},
+	{"#e7d9b4", "Beige", "47"},
+	{"#e90e86", "Carmine", "48"},
+	{"#cf6829", "Amber Red", "49"},
+	{"#408615", "Olive Green", "50"},
+	{"#db1797", "Dark Fuchsia", "51"},
+	{"#ffa704", "Tangerine", "52"},
+	{"#b9ffff", "Light Blue", "53"},
+	{"#228927", "Emerald Green", "54"},
+	{"#b612cd", "Purple", "55"},
+	{"#00aa00", "Moss Green", "56"},
+	{"#fea9dc", "Flesh Pink", "57"},
+	{"#fed510", "Harvest Gold", "58"},
+	{"#0097df", "Electric Blue", "59"},
+	{"#ffff84", "Lemon Yellow", "60"},
+	{"#cfe774", "Fresh Green", "61"},
+	{"#ffc864", "Applique Material", "62"},
+	{"#ffc8c8", "Applique Position", "63"},
+	{"#ffc8c8", "Applique", "64"},
+}
+
+// ReadPEC decodes a standalone Brother PEC file
+func ReadPEC(r io.Reader) (*Pattern, error) {
+	var data, err = ioutil.ReadAll(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(string(data), "#PEC0001") {
+		return nil, ErrInvalidFile
+	}
+
+	p, err := readPEC(data[8:])
+
+	if err != nil {
+		return nil, err
+	}
+
+	p.Format = "pec"
+	return p, nil
+}
+
+func readPEC(pec []byte) (*Pattern, error) {
+	if len(pec) < pecStitchDataOffset || !strings.HasPrefix(string(pec), "LA:") {
+		return nil, ErrInvalidFile
+	}
+
+	var p = &Pattern{
+		Label: strings.TrimSpace(string(pec[3:19])),
+	}
+
+	var colors = int(pec[pecColorCountOffset]) + 1
+
+	for _, c := range pec[pecColorCountOffset+1 : pecColorCountOffset+1+colors] {
+		if int(c) >= len(pecThreads) {
+			c = 0
+		}
+
+		p.Threads = append(p.Threads, pecThreads[c])
+	}
+
+	var end = len(pec)
+
+	// the block length is counted from the start of the stitch block
+	var length = int(uint32(pec[514]) | uint32(pec[515])<<8 | uint32(pec[516])<<16)
+
+	if l := pecStitchBlockOffset + length; l > pecStitchDataOffset && l < end {
+		end = l
+	}
+
+	p.Stitches = decodePECStitches(pec[pecStitchDataOffset:end])
+	return p, nil
+}
+
+func decodePECStitches(data []byte) (stitches []Stitch) {
+	var x, y int
+
+	for i := 0; i+1 < len(data); {
+		var b1, b2 = data[i], data[i+1]
+
+		if b1 == 0xFF {
+			break
+		}
+
+		if b1 == 0xFE && b2 == 0xB0 {
+			// the third byte toggles between 1 and 2 and has no meaning
+			stitches = append(stitches, Stitch{X: x, Y: y, Command: ColorChange})
+			i += 3
+			continue
+		}
+
+		var dx, dy int
+		var jump, trim bool
+
+		if b1&pecLongForm != 0 {
+			trim = b1&pecTrim != 0
+			jump = b1&pecJump != 0
+			dx = signed12(uint16(b1)<<8 | uint16(b2))
+			i += 2
+		} else {
+			dx = signed7(b1)
+			i++
+		}
+
+		if i >= len(data) {
+			break
+		}
+
+		b2 = data[i]
+
+		if b2&pecLongForm != 0 {
+			if i+1 >= len(data) {
+				break
+			}
+
+			trim = trim || b2&pecTrim != 0
+			jump = jump || b2&pecJump != 0
+			dy = signed12(uint16(b2)<<8 | uint16(data[i+1]))
+			i += 2
+		} else {
+			dy = signed7(b2)
+			i++
+		}
+
+		x += dx
+		y += dy
+
+		switch {
+		case trim:
+			stitches = append(stitches, Stitch{X: x - dx, Y: y - dy, Command: Trim})
+			stitches = append(stitches, Stitch{X: x, Y: y, Command: Jump})
+		case jump:
+			stitches = append(stitches, Stitch{X: x, Y: y, Command: Jump})
+		default:
+			stitches = append(stitches, Stitch{X: x, Y: y, Command: Normal})
+		}
+	}
+
+	return append(stitches, Stitch{X: x, Y: y, Command: End})
+}
+
+func signed7(b byte) int {
+	if b > 63 {
+		return int(b) - 128
+	}
+
+	return int(b)
+}
+
+func signed12(v uint16) int {
+	v &= 0x0FFF
+
+	if v > 0x7FF {
+		return int(v) - 0x1000
+	}
+
+	return int(v)
+}
+
+// pecMaxMove is the longest move a long form PEC record can encode
+const pecMaxMove = 2047
+
+const (
+	pecIconStride = 6
+	pecIconHeight = 38
+)
+
+// writePEC encodes the PEC block of a pattern
+func writePEC(w io.Writer, p *Pattern) error {
+	var colors = pecColorIndices(p)
+	var header = bytes.Repeat([]byte{' '}, pecStitchBlockOffset)
+
+	copy(header, fmt.Sprintf("LA:%-16.16s\r", p.Label))
+	header[32], header[33] = 0xFF, 0x00
+	header[34], header[35] = pecIconStride, pecIconHeight
+	header[pecColorCountOffset] = byte(len(colors) - 1)
+	copy(header[pecColorCountOffset+1:], colors)
+
+	var stitches = encodePECStitches(p)
+	var s = p.Stats()
+	var block = make([]byte, pecStitchDataOffset-pecStitchBlockOffset)
+
+	// the block length is counted from the start of the stitch block
+	var length = len(block) + len(stitches)
+	block[2], block[3], block[4] = byte(length), byte(length>>8), byte(length>>16)
+	block[5], block[6], block[7] = 0x31, 0xFF, 0xF0
+	binary.LittleEndian.PutUint16(block[8:], uint16(s.Width()*10))
+	binary.LittleEndian.PutUint16(block[10:], uint16(s.Height()*10))
+	binary.LittleEndian.PutUint16(block[12:], 0x1E0)
+	binary.LittleEndian.PutUint16(block[14:], 0x1B0)
+
+	// blank icons: one for the whole design and one for each color
+	var icons = make([]byte, (len(colors)+1)*pecIconStride*pecIconHeight)
+
+	for _, b := range [][]byte{header, block, stitches, icons} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func encodePECStitches(p *Pattern) (data []byte) {
+	var x, y int
+	var trim bool
+	var colorTwo = true
+
+	var long = func(v int, flags uint16) []byte {
+		var code = uint16(v)&0x0FFF | pecLongForm<<8 | flags
+		return []byte{byte(code >> 8), byte(code)}
+	}
+
+	var move = func(tx, ty int, jump bool) {
+		for {
+			var dx, dy = clamp(tx-x, pecMaxMove), clamp(ty-y, pecMaxMove)
+			x, y = x+dx, y+dy
+			var last = x == tx && y == ty
+
+			// trims are read back as a trim and a jump, so a pending trim
+			// gets a record of its own instead of taking the place of a stitch
+			if trim && last && !jump {
+				data = append(data, long(0, pecTrim<<8)...)
+				data = append(data, long(0, pecTrim<<8)...)
+				trim = false
+			}
+
+			switch {
+			case trim:
+				data = append(data, long(dx, pecTrim<<8)...)
+				data = append(data, long(dy, pecTrim<<8)...)
+				trim = false
+			case jump || !last:
+				data = append(data, long(dx, pecJump<<8)...)
+				data = append(data, long(dy, pecJump<<8)...)
+			case dx > -64 && dx < 64 && dy > -64 && dy < 64:
+				data = append(data, byte(dx)&0x7F, byte(dy)&0x7F)
+			default:
+				data = append(data, long(dx, 0)...)
+				data = append(data, long(dy, 0)...)
+			}
+
+			if last {
+				return
+			}
+		}
+	}
+
+	// the first record is always a long jump to the start of the design
+	var first = true
+
+	for _, s := range p.Stitches {
+		switch s.Command {
+		case Normal:
+			if first {
+				move(s.X, s.Y, true)
+			}
+
+			move(s.X, s.Y, false)
+		case Jump:
+			move(s.X, s.Y, true)
+		case Trim:
+			trim = true
+		case ColorChange:
+			data = append(data, 0xFE, 0xB0, 1)
+
+			if colorTwo {
+				data[len(data)-1] = 2
+			}
+
+			colorTwo = !colorTwo
+		default:
+			continue
+		}
+
+		first = false
+	}
+
+	return append(data, 0xFF, 0x00)
+}
+
+// pecColorIndices maps the threads of a pattern to the closest PEC palette color
+func pecColorIndices(p *Pattern) []byte {
+	var blocks = p.Stats().ColorChanges + 1
+	var indices = make([]byte, blocks)
+
+	for i := range indices {
+		if i >= len(p.Threads) {
+			indices[i] = defaultPECColors[i%len(defaultPECColors)]
+			continue
+		}
+
+		indices[i] = closestPECColor(p.Threads[i].Color)
+	}
+
+	return indices
+}
+
+// defaultPECColors are used for designs without thread information
+var defaultPECColors = []byte{20, 5, 2, 13, 37, 12, 7, 29, 24, 32}
+
+func closestPECColor(color string) byte {
+	var r, g, b, ok = parseColor(color)
+
+	if !ok {
+		return defaultPECColors[0]
+	}
+
+	var best byte = 1
+	var bestDistance = -1
+
+	for i, t := range pecThreads[1:] {
+		var tr, tg, tb, _ = parseColor(t.Color)
+		var d = (r-tr)*(r-tr) + (g-tg)*(g-tg) + (b-tb)*(b-tb)
+
+		if bestDistance == -1 || d < bestDistance {
+			best, bestDistance = byte(i+1), d
+		}
+	}
+
+	return best
+}
@@ -0,0 +1,56 @@
+package stitch
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// PES files start with "#PES" and a version, followed by the offset of the
+// PEC block. The PES section describes the design for Brother's software,
+// but the machine only needs the PEC block, which is what is decoded here.
+
+const pesHeaderSize = 12
+
+// ReadPES decodes a Brother PES file
+func ReadPES(r io.Reader) (*Pattern, error) {
+	var data, err = ioutil.ReadAll(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < pesHeaderSize || !strings.HasPrefix(string(data), "#PES") {
+		return nil, ErrInvalidFile
+	}
+
+	var offset = int(binary.LittleEndian.Uint32(data[8:12]))
+
+	if offset < pesHeaderSize || offset >= len(data) {
+		return nil, ErrInvalidFile
+	}
+
+	p, err := readPEC(data[offset:])
+
+	if err != nil {
+		return nil, err
+	}
+
+	p.Format = "pes"
+	return p, nil
+}
+
+// WritePES encodes a pattern as a Brother PES file
+// Only a truncated version 1 PES section is written: machines read the PEC block
+func WritePES(w io.Writer, p *Pattern) error {
+	var header = make([]byte, pesHeaderSize+10)
+	copy(header, "#PES0001")
+	binary.LittleEndian.PutUint32(header[8:], uint32(len(header)))
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	return writePEC(w, p)
+}
@@ -0,0 +1,218 @@
+package stitch
+
+import (
+	"errors"
+	"io"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// coordinates are stored in 0.1 mm units (the resolution used by most
+// embroidery machines) with the y axis growing downwards, like on the screen.
+
+// ErrUnknownFormat is used when a file is not in a supported stitch format
+var ErrUnknownFormat = errors.New("Unknown stitch file format")
+
+// ErrInvalidFile is used when a file can't be decoded
+var ErrInvalidFile = errors.New("Invalid or corrupted stitch file")
+
+// Command of a stitch record
+type Command int
+
+const (
+	// Normal stitch: the needle moves to the position and penetrates the fabric
+	Normal Command = iota
+
+	// Jump moves the frame without stitching
+	Jump
+
+	// Trim cuts the thread
+	Trim
+
+	// ColorChange stops the machine to change the thread
+	ColorChange
+
+	// End of the design
+	End
+)
+
+// Stitch record
+type Stitch struct {
+	X       int
+	Y       int
+	Command Command
+}
+
+// Thread used by a color block
+type Thread struct {
+	Color string
+	Name  string
+	Code  string
+}
+
+// Pattern of a design
+type Pattern struct {
+	Format   string
+	Label    string
+	Stitches []Stitch
+	Threads  []Thread
+}
+
+// Stats of a pattern. Lengths are in mm
+type Stats struct {
+	Stitches     int
+	ColorChanges int
+	Trims        int
+	Jumps        int
+	MinX         float64
+	MinY         float64
+	MaxX         float64
+	MaxY         float64
+	ThreadLength float64
+}
+
+// Width of the design in mm
+func (s Stats) Width() float64 {
+	return s.MaxX - s.MinX
+}
+
+// Height of the design in mm
+func (s Stats) Height() float64 {
+	return s.MaxY - s.MinY
+}
+
+// Stats of the pattern
+func (p *Pattern) Stats() Stats {
+	var s Stats
+	var x, y int
+	var minX, minY, maxX, maxY int
+	var length float64
+	var first = true
+	var sewing bool
+
+	for _, st := range p.Stitches {
+		switch st.Command {
+		case Normal:
+			s.Stitches++
+
+			if first {
+				minX, maxX, minY, maxY = st.X, st.X, st.Y, st.Y
+				first = false
+			}
+
+			// thread carried over jumps is trimmed away, so it isn't counted
+			if sewing {
+				length += math.Hypot(float64(st.X-x), float64(st.Y-y))
+			}
+
+			minX, maxX = minInt(minX, st.X), maxInt(maxX, st.X)
+			minY, maxY = minInt(minY, st.Y), maxInt(maxY, st.Y)
+		case Jump:
+			s.Jumps++
+		case Trim:
+			s.Trims++
+		case ColorChange:
+			s.ColorChanges++
+		}
+
+		x, y = st.X, st.Y
+		sewing = st.Command == Normal
+	}
+
+	s.MinX, s.MinY = float64(minX)/10, float64(minY)/10
+	s.MaxX, s.MaxY = float64(maxX)/10, float64(maxY)/10
+	s.ThreadLength = math.Round(length) / 10
+	return s
+}
+
+// Format of a stitch file, inferred from its name
+func Format(filename string) string {
+	return strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
+}
+
+// Readable tells if files in the given format can be decoded
+func Readable(format string) bool {
+	switch format {
+	case "dst", "pes", "pec", "exp":
+		return true
+	default:
+		return false
+	}
+}
+
+// Read a stitch file in the given format
+func Read(r io.Reader, format string) (*Pattern, error) {
+	switch format {
+	case "dst":
+		return ReadDST(r)
+	case "pes":
+		return ReadPES(r)
+	case "pec":
+		return ReadPEC(r)
+	case "exp":
+		return ReadEXP(r)
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// WriteFormats are the formats a pattern can be converted to
+var WriteFormats = []string{"dst", "pes", "exp"}
+
+// Write a pattern in the given format
+func Write(w io.Writer, p *Pattern, format string) error {
+	switch format {
+	case "dst":
+		return WriteDST(w, p)
+	case "pes":
+		return WritePES(w, p)
+	case "exp":
+		return WriteEXP(w, p)
+	default:
+		return ErrUnknownFormat
+	}
+}
+
+// parseColor parses a #rrggbb color
+func parseColor(color string) (r, g, b int, ok bool) {
+	if len(color) != 7 || color[0] != '#' {
+		return 0, 0, 0, false
+	}
+
+	v, err := strconv.ParseUint(color[1:], 16, 32)
+
+	if err != nil {
+		return 0, 0, 0, false
+	}
+
+	return int(v >> 16 & 0xFF), int(v >> 8 & 0xFF), int(v & 0xFF), true
+}
+
+func clamp(v, limit int) int {
+	switch {
+	case v > limit:
+		return limit
+	case v < -limit:
+		return -limit
+	default:
+		return v
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,160 @@
+package stitch
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+var roundTripCases = []struct {
+	name    string
+	pattern *Pattern
+}{
+	{
+		// the jump after the color change is kept short, as DST reads runs
+		// of jumps as trims
+		"moves, trim and color change",
+		&Pattern{
+			Label: "TEST",
+			Stitches: []Stitch{
+				{X: 0, Y: 0, Command: Normal},
+				{X: 10, Y: 5, Command: Normal},
+				{X: 70, Y: -40, Command: Normal},
+				{X: 70, Y: -40, Command: Trim},
+				{X: 400, Y: 300, Command: Jump},
+				{X: 400, Y: 300, Command: Normal},
+				{X: 390, Y: 320, Command: Normal},
+				{X: 390, Y: 320, Command: ColorChange},
+				{X: 200, Y: 250, Command: Jump},
+				{X: 200, Y: 250, Command: Normal},
+				{X: 250, Y: 210, Command: Normal},
+				{X: 250, Y: 210, Command: End},
+			},
+			Threads: []Thread{
+				{Color: "#ff0000"},
+				{Color: "#0000ff"},
+			},
+		},
+	},
+	{
+		"trim before a stitch",
+		&Pattern{
+			Stitches: []Stitch{
+				{X: 0, Y: 0, Command: Normal},
+				{X: 20, Y: 20, Command: Normal},
+				{X: 20, Y: 20, Command: Trim},
+				{X: 50, Y: 10, Command: Normal},
+				{X: 60, Y: -30, Command: Normal},
+				{X: 60, Y: -30, Command: End},
+			},
+		},
+	},
+}
+
+// sewn positions of a pattern, with the color changes
+func sewn(p *Pattern) (stitches []Stitch) {
+	for _, s := range p.Stitches {
+		if s.Command == Normal || s.Command == ColorChange {
+			stitches = append(stitches, s)
+		}
+	}
+
+	return stitches
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, c := range roundTripCases {
+		for _, format := range WriteFormats {
+			t.Run(c.name+"/"+format, func(t *testing.T) {
+				testRoundTrip(t, c.pattern, format)
+			})
+		}
+	}
+}
+
+func testRoundTrip(t *testing.T, want *Pattern, format string) {
+	var buf bytes.Buffer
+
+	if err := Write(&buf, want, format); err != nil {
+		t.Fatalf("Expected no error writing, got %v instead", err)
+	}
+
+	p, err := Read(&buf, format)
+
+	if err != nil {
+		t.Fatalf("Expected no error reading, got %v instead", err)
+	}
+
+	if got, ws := sewn(p), sewn(want); !reflect.DeepEqual(got, ws) {
+		t.Errorf("Expected stitches to be %v, got %v instead", ws, got)
+	}
+
+	var stats, wantStats = p.Stats(), want.Stats()
+
+	if stats.Stitches != wantStats.Stitches {
+		t.Errorf("Expected %v stitches, got %v instead", wantStats.Stitches, stats.Stitches)
+	}
+
+	if stats.ColorChanges != wantStats.ColorChanges {
+		t.Errorf("Expected %v color changes, got %v instead", wantStats.ColorChanges, stats.ColorChanges)
+	}
+
+	if stats.Trims != wantStats.Trims {
+		t.Errorf("Expected %v trims, got %v instead", wantStats.Trims, stats.Trims)
+	}
+
+	if stats.ThreadLength != wantStats.ThreadLength {
+		t.Errorf("Expected thread length to be %v, got %v instead", wantStats.ThreadLength, stats.ThreadLength)
+	}
+
+	if last := p.Stitches[len(p.Stitches)-1]; last.Command != End {
+		t.Errorf("Expected pattern to end with an end command, got %v instead", last)
+	}
+}
+
+// TestRoundTripLongMove checks moves longer than a record reach their position
+// DST and EXP split them into jumps, so only the last stitch is compared.
+func TestRoundTripLongMove(t *testing.T) {
+	var p = &Pattern{
+		Stitches: []Stitch{
+			{X: 0, Y: 0, Command: Normal},
+			{X: 1000, Y: -800, Command: Normal},
+			{X: 1000, Y: -800, Command: End},
+		},
+	}
+
+	for _, format := range WriteFormats {
+		var buf bytes.Buffer
+
+		if err := Write(&buf, p, format); err != nil {
+			t.Fatalf("Expected no error writing %v, got %v instead", format, err)
+		}
+
+		got, err := Read(&buf, format)
+
+		if err != nil {
+			t.Fatalf("Expected no error reading %v, got %v instead", format, err)
+		}
+
+		var stitches = sewn(got)
+
+		if len(stitches) == 0 || stitches[len(stitches)-1] != (Stitch{X: 1000, Y: -800}) {
+			t.Errorf("Expected last %v stitch at (1000, -800), got %v instead", format, stitches)
+		}
+	}
+}
+
+func TestReadUnknownFormat(t *testing.T) {
+	if _, err := Read(&bytes.Buffer{}, "svg"); err != ErrUnknownFormat {
+		t.Errorf("Expected error to be %v, got %v instead", ErrUnknownFormat, err)
+	}
+}
+
+func TestReadInvalidFile(t *testing.T) {
+	// EXP files have no header, so any data can be read as stitches
+	for _, format := range []string{"dst", "pes"} {
+		if _, err := Read(bytes.NewBufferString("not a design"), format); err == nil {
+			t.Errorf("Expected error reading invalid %v file", format)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/henvic/embroidery/server"
+)
+
+// files are stored "as is" on the filesystem and are addressed by the
+// SHA-256 hash of their content, so storing the same file twice is a no-op.
+// The path of a file is derived from its hash: ab/cd/abcd...
+
+var dir = server.Instance.StorageDir
+
+// ErrInvalidHash is used when a hash is not a hex-encoded SHA-256 sum
+var ErrInvalidHash = errors.New("Invalid file hash")
+
+// File stored on the storage directory
+type File struct {
+	Hash     string
+	Size     int64
+	MIMEType string
+}
+
+// Path of a file relative to the storage directory
+func Path(hash string) (string, error) {
+	if b, err := hex.DecodeString(hash); err != nil || len(b) != sha256.Size {
+		return "", ErrInvalidHash
+	}
+
+	return filepath.Join(hash[0:2], hash[2:4], hash), nil
+}
+
+// Store a file on the storage directory
+// The original filename is only used to infer its MIME type
+func Store(r io.Reader, filename string) (File, error) {
+	var tmpDir = filepath.Join(dir(), "tmp")
+
+	if err := os.MkdirAll(tmpDir, 0700); err != nil {
+		return File{}, errwrap.Wrapf("Can't create storage directory: {{err}}", err)
+	}
+
+	tmp, err := ioutil.TempFile(tmpDir, "upload")
+
+	if err != nil {
+		return File{}, errwrap.Wrapf("Can't create temporary file: {{err}}", err)
+	}
+
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	var br = bufio.NewReaderSize(r, 512)
+	head, _ := br.Peek(512)
+
+	var h = sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), br)
+
+	if err != nil {
+		return File{}, errwrap.Wrapf("Can't write file to storage: {{err}}", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return File{}, errwrap.Wrapf("Can't write file to storage: {{err}}", err)
+	}
+
+	var f = File{
+		Hash:     hex.EncodeToString(h.Sum(nil)),
+		Size:     size,
+		MIMEType: mimeType(filename, head),
+	}
+
+	p, err := Path(f.Hash)
+
+	if err != nil {
+		return File{}, err
+	}
+
+	p = filepath.Join(dir(), p)
+
+	if _, err := os.Stat(p); err == nil {
+		return f, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return File{}, errwrap.Wrapf("Can't create storage directory: {{err}}", err)
+	}
+
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return File{}, errwrap.Wrapf("Can't move file to storage: {{err}}", err)
+	}
+
+	return f, nil
+}
+
+// Open a stored file by its hash
+func Open(hash string) (*os.File, error) {
+	var p, err = Path(hash)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return os.Open(filepath.Join(dir(), p))
+}
+
+func mimeType(filename string, head []byte) string {
+	if t := mime.TypeByExtension(filepath.Ext(filename)); t != "" {
+		return t
+	}
+
+	return http.DetectContentType(head)
+}
+
+// Cached opens a file derived from a stored file (i.e., a preview), creating
+// it with the create function if it doesn't exist yet. The derived file is
+// kept next to the stored file, with the given suffix.
+func Cached(hash, suffix string, create func(w io.Writer) error) (*os.File, error) {
+	var p, err = Path(hash)
+
+	if err != nil {
+		return nil, err
+	}
+
+	p = filepath.Join(dir(), p+suffix)
+
+	if f, err := os.Open(p); err == nil {
+		return f, nil
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(p), "cache")
+
+	if err != nil {
+		return nil, errwrap.Wrapf("Can't create cache file: {{err}}", err)
+	}
+
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := create(tmp); err != nil {
+		return nil, err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return nil, errwrap.Wrapf("Can't write cache file: {{err}}", err)
+	}
+
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return nil, errwrap.Wrapf("Can't move cache file: {{err}}", err)
+	}
+
+	return os.Open(p)
+}
@@ -0,0 +1,223 @@
+package ticket
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/henvic/embroidery/address"
+	"github.com/henvic/embroidery/barcode"
+	"github.com/henvic/embroidery/boleto"
+	"github.com/henvic/embroidery/clients"
+	"github.com/henvic/embroidery/orders"
+	"github.com/henvic/embroidery/pdf"
+)
+
+// BoletoDocument is the printable boleto of an order, with the receipt of
+// the payer (recibo do pagador) and the ficha de compensação read by banks
+type BoletoDocument struct {
+	Boleto  boleto.Boleto
+	Client  clients.Client
+	Address *address.Address
+}
+
+// LoadBoleto document
+// sql.ErrNoRows is returned if the boleto doesn't exist.
+func LoadBoleto(ctx context.Context, boletoID int64) (d BoletoDocument, err error) {
+	if d.Boleto, err = boleto.Get(ctx, boletoID); err != nil {
+		return d, err
+	}
+
+	if d.Client, err = clients.Get(ctx, d.Boleto.ClientID); err != nil {
+		return d, err
+	}
+
+	o, err := orders.Get(ctx, d.Boleto.OrderID)
+
+	if err != nil || o.ClientAddressID == "" {
+		return d, err
+	}
+
+	a, err := address.Get(ctx, o.ClientID, o.ClientAddressID)
+
+	switch err {
+	case nil:
+		d.Address = &a
+	case sql.ErrNoRows:
+	default:
+		return d, err
+	}
+
+	return d, nil
+}
+
+const (
+	boletoLabelSize = 6
+	boletoBoxHeight = 24
+)
+
+// box of the ficha de compensação, with its label on the top left corner
+func (w *writer) box(x, width, height float64, label, value string) {
+	w.page.StrokeRect(x, w.y, width, height, 0.5, darkGray)
+	w.page.Text(x+3, w.y+boletoLabelSize+2, pdf.Helvetica, boletoLabelSize, darkGray, label)
+	w.page.Text(x+3, w.y+boletoLabelSize+lineHeight, pdf.Helvetica, fontSize, pdf.Black, fit(value, pdf.Helvetica, fontSize, width-6))
+}
+
+// date formatted as DD/MM/YYYY from YYYY-MM-DD
+func date(s string) string {
+	if len(s) < 10 {
+		return s
+	}
+
+	return s[8:10] + "/" + s[5:7] + "/" + s[0:4]
+}
+
+// Write the boleto as a PDF document
+func (d BoletoDocument) Write(w io.Writer) error {
+	var b = d.Boleto
+	var cfg = boleto.Config
+	var tw = &writer{doc: pdf.New()}
+	tw.newPage()
+
+	var right = tw.doc.Width - margin
+	var width = right - margin
+	var side = margin + width*0.7
+
+	var payer = strings.TrimSpace(d.Client.FirstName + " " + d.Client.LastName)
+	var payerAddress []string
+
+	if a := d.Address; a != nil {
+		payerAddress = append(payerAddress,
+			strings.TrimSpace(a.AddressLine1+" "+a.AddressLine2),
+			strings.TrimSpace(strings.Trim(a.City+", "+a.State, ", ")+" "+a.ZipCode))
+	}
+
+	var beneficiary = cfg.Beneficiary
+
+	if cfg.Document != "" {
+		beneficiary += " - " + cfg.Document
+	}
+
+	// the account is printed as the boleto was issued, as on its barcode
+	var account = strings.Trim(b.Agency+" / "+b.Account, " /")
+
+	// header of each part: bank, bank code and the digitable line
+	header := func(title string) {
+		tw.y += 18
+		tw.page.Text(margin, tw.y, pdf.HelveticaBold, 13, pdf.Black, fit(b.BankName(), pdf.HelveticaBold, 13, 140))
+		tw.page.Text(margin+150, tw.y, pdf.HelveticaBold, 15, pdf.Black, b.BankCodeDisplay())
+		tw.page.Text(margin+205, tw.y, pdf.HelveticaBold, fontSize, pdf.Black, fit(title, pdf.HelveticaBold, fontSize, right-margin-205))
+		tw.y += 6
+		tw.page.Line(margin, tw.y, right, tw.y, 1.5, pdf.Black)
+	}
+
+	header("Recibo do pagador")
+
+	var receipt = [][2]string{
+		{"Beneficiário", beneficiary},
+		{"Agência / Código do beneficiário", account},
+		{"Pagador", payer},
+		{"Nosso número", b.OurNumberDisplay()},
+		{"Número do documento", strconv.FormatInt(b.BoletoID, 10)},
+		{"Vencimento", date(b.DueDate)},
+		{"Valor do documento", money(b.Amount)},
+	}
+
+	tw.y += lineHeight * 1.5
+
+	for _, detail := range receipt {
+		tw.detail(detail[0], detail[1])
+	}
+
+	tw.y += lineHeight
+	tw.page.Text(margin, tw.y, pdf.Helvetica, boletoLabelSize, darkGray, "Autenticação mecânica")
+	tw.y += lineHeight * 3
+
+	// the ficha de compensação is detached on the cut line
+	for x := float64(margin); x < right; x += 6 {
+		tw.page.Line(x, tw.y, x+3, tw.y, 0.5, darkGray)
+	}
+
+	tw.y += lineHeight
+	header(b.DigitableLine)
+
+	tw.box(margin, side-margin, boletoBoxHeight, "Local de pagamento", "Pagável em qualquer banco até o vencimento")
+	tw.box(side, right-side, boletoBoxHeight, "Vencimento", date(b.DueDate))
+	tw.y += boletoBoxHeight
+
+	tw.box(margin, side-margin, boletoBoxHeight, "Beneficiário", beneficiary)
+	tw.box(side, right-side, boletoBoxHeight, "Agência / Código do beneficiário", account)
+	tw.y += boletoBoxHeight
+
+	var cell = (side - margin) / 5
+
+	tw.box(margin, cell, boletoBoxHeight, "Data do documento", date(b.CreatedTime))
+	tw.box(margin+cell, cell, boletoBoxHeight, "Número do documento", strconv.FormatInt(b.BoletoID, 10))
+	tw.box(margin+2*cell, cell, boletoBoxHeight, "Espécie doc.", "DM")
+	tw.box(margin+3*cell, cell, boletoBoxHeight, "Aceite", "N")
+	tw.box(margin+4*cell, cell, boletoBoxHeight, "Data do processamento", date(b.CreatedTime))
+	tw.box(side, right-side, boletoBoxHeight, "Nosso número", b.OurNumberDisplay())
+	tw.y += boletoBoxHeight
+
+	tw.box(margin, cell, boletoBoxHeight, "Uso do banco", "")
+	tw.box(margin+cell, cell, boletoBoxHeight, "Carteira", b.Wallet)
+	tw.box(margin+2*cell, cell, boletoBoxHeight, "Espécie", "R$")
+	tw.box(margin+3*cell, cell, boletoBoxHeight, "Quantidade", "")
+	tw.box(margin+4*cell, cell, boletoBoxHeight, "Valor", "")
+	tw.box(side, right-side, boletoBoxHeight, "(=) Valor do documento", money(b.Amount))
+	tw.y += boletoBoxHeight
+
+	// instructions are on the left of the discounts and additions
+	var sides = []string{"(-) Desconto / Abatimento", "(+) Mora / Multa", "(=) Valor cobrado"}
+	var top = tw.y
+
+	tw.page.StrokeRect(margin, top, side-margin, boletoBoxHeight*float64(len(sides)), 0.5, darkGray)
+	tw.page.Text(margin+3, top+boletoLabelSize+2, pdf.Helvetica, boletoLabelSize, darkGray, "Instruções (texto de responsabilidade do beneficiário)")
+
+	for i, label := range sides {
+		tw.y = top + boletoBoxHeight*float64(i)
+		tw.box(side, right-side, boletoBoxHeight, label, "")
+	}
+
+	tw.y = top + boletoLabelSize + lineHeight
+
+	for _, paragraph := range strings.Split(cfg.Instructions, "\n") {
+		for _, line := range wrap(strings.TrimRight(paragraph, "\r"), pdf.Helvetica, fontSize-1, side-margin-6) {
+			if tw.y > top+boletoBoxHeight*float64(len(sides))-4 {
+				break
+			}
+
+			tw.page.Text(margin+3, tw.y, pdf.Helvetica, fontSize-1, pdf.Black, line)
+			tw.y += lineHeight - 2
+		}
+	}
+
+	tw.y = top + boletoBoxHeight*float64(len(sides))
+
+	var payerHeight = boletoBoxHeight + lineHeight*float64(len(payerAddress))
+	tw.page.StrokeRect(margin, tw.y, width, payerHeight, 0.5, darkGray)
+	tw.page.Text(margin+3, tw.y+boletoLabelSize+2, pdf.Helvetica, boletoLabelSize, darkGray, "Pagador")
+	tw.y += boletoLabelSize + lineHeight
+
+	for _, line := range append([]string{payer + " - " + d.Client.Email}, payerAddress...) {
+		tw.page.Text(margin+3, tw.y, pdf.Helvetica, fontSize, pdf.Black, fit(line, pdf.Helvetica, fontSize, width-6))
+		tw.y += lineHeight
+	}
+
+	tw.y += lineHeight - boletoLabelSize
+
+	widths, err := barcode.ITF(b.Barcode)
+
+	if err != nil {
+		return err
+	}
+
+	// the barcode is about 103 mm wide and 13 mm tall on the FEBRABAN rules
+	drawBarcode(tw.page, widths, margin, tw.y, 300, barcodeHeight)
+	tw.page.Text(right-130, tw.y+lineHeight, pdf.Helvetica, boletoLabelSize, darkGray, "Autenticação mecânica")
+	tw.page.Text(right-130, tw.y+lineHeight+boletoLabelSize+2, pdf.HelveticaBold, boletoLabelSize+1, pdf.Black, "Ficha de compensação")
+
+	return tw.doc.Write(w)
+}
@@ -0,0 +1,121 @@
+package ticket
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/henvic/embroidery/invoices"
+	"github.com/henvic/embroidery/pdf"
+)
+
+// InvoiceDocument is the printable invoice or credit note of an order
+// Credited is the invoice corrected by a credit note.
+type InvoiceDocument struct {
+	Invoice  invoices.Invoice
+	Credited *invoices.Invoice
+}
+
+// LoadInvoice document
+// sql.ErrNoRows is returned if the invoice doesn't exist.
+func LoadInvoice(ctx context.Context, invoiceID string) (d InvoiceDocument, err error) {
+	if d.Invoice, err = invoices.Get(ctx, invoiceID); err != nil {
+		return d, err
+	}
+
+	if d.Invoice.CreditOfInvoiceID == nil {
+		return d, nil
+	}
+
+	credited, err := invoices.Get(ctx, *d.Invoice.CreditOfInvoiceID)
+
+	if err != nil {
+		return d, err
+	}
+
+	d.Credited = &credited
+	return d, nil
+}
+
+// Write the invoice as a PDF document
+// Everything printed comes from the snapshot taken when it was issued.
+func (d InvoiceDocument) Write(w io.Writer) error {
+	var i = d.Invoice
+	var tw = &writer{doc: pdf.New()}
+	tw.newPage()
+
+	var title = "Nota fiscal"
+
+	if i.Kind == invoices.KindCreditNote {
+		title = "Nota de crédito"
+	}
+
+	tw.y += 18
+	tw.page.Text(margin, tw.y, pdf.HelveticaBold, 18, pdf.Black, title+" "+i.Code())
+	tw.y += lineHeight + 4
+	tw.page.Text(margin, tw.y, pdf.Helvetica, fontSize, darkGray, i.InvoiceID)
+	tw.y += lineHeight * 2
+
+	var details = [][2]string{
+		{"Issued", i.IssuedTime},
+		{"Order", i.OrderID},
+	}
+
+	if d.Credited != nil {
+		details = append(details, [2]string{"Corrects invoice", d.Credited.Code()})
+	}
+
+	for _, detail := range details {
+		tw.detail(detail[0], detail[1])
+	}
+
+	tw.heading("Bill to")
+
+	var address = []string{
+		i.ClientName,
+		i.ClientEmail,
+		i.AddressName,
+		strings.TrimSpace(i.AddressLine1 + " " + i.AddressLine2),
+		strings.Trim(i.City+", "+i.State, ", "),
+		strings.TrimSpace(i.ZipCode + " " + i.Country),
+	}
+
+	for _, line := range address {
+		if line != "" {
+			tw.row(pdf.Helvetica, []float64{margin}, line)
+		}
+	}
+
+	tw.heading("Items")
+
+	var xs = []float64{margin, margin + 24, margin + 250, margin + 320, margin + 410}
+	tw.row(pdf.HelveticaBold, xs, "#", "Description", "Quantity", "Unit price", "Price")
+
+	for _, l := range i.Lines {
+		var unit = "-"
+
+		if l.Amount != 0 {
+			unit = money(l.Price / int64(l.Amount))
+		}
+
+		tw.row(pdf.Helvetica, xs, strconv.Itoa(l.Position), l.Description, strconv.Itoa(l.Amount), unit, money(l.Price))
+	}
+
+	tw.space(lineHeight * 2)
+	tw.page.Line(xs[3], tw.y-lineHeight+4, tw.doc.Width-margin, tw.y-lineHeight+4, 0.5, darkGray)
+	tw.y += 4
+	tw.row(pdf.HelveticaBold, xs, "", "", "", "Total", money(i.Total))
+
+	if i.Reason != "" {
+		tw.heading("Reason")
+
+		for _, paragraph := range strings.Split(i.Reason, "\n") {
+			for _, line := range wrap(strings.TrimRight(paragraph, "\r"), pdf.Helvetica, fontSize, tw.doc.Width-2*margin) {
+				tw.row(pdf.Helvetica, []float64{margin}, line)
+			}
+		}
+	}
+
+	return tw.doc.Write(w)
+}
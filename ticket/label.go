@@ -0,0 +1,81 @@
+package ticket
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/henvic/embroidery/barcode"
+	"github.com/henvic/embroidery/clients"
+	"github.com/henvic/embroidery/goods"
+	"github.com/henvic/embroidery/jobs"
+	"github.com/henvic/embroidery/pdf"
+)
+
+// Label of a good, with the barcode of its ID to be read on the scanning
+// screen
+type Label struct {
+	Good   goods.Good
+	Job    jobs.Job
+	Client clients.Client
+}
+
+// size of the labels (100 x 50 mm), in points
+const (
+	labelWidth  = 283.46
+	labelHeight = 141.73
+	labelMargin = 10
+)
+
+// LoadLabel of a good
+// sql.ErrNoRows is returned if the good doesn't exist.
+func LoadLabel(ctx context.Context, goodID string) (l Label, err error) {
+	if l.Good, err = goods.Get(ctx, goodID); err != nil {
+		return l, err
+	}
+
+	if l.Job, err = jobs.Get(ctx, l.Good.JobID); err != nil {
+		return l, err
+	}
+
+	l.Client, err = clients.Get(ctx, l.Good.OwnerID)
+	return l, err
+}
+
+// Write the label as a PDF document
+func (l Label) Write(w io.Writer) error {
+	var doc = pdf.New()
+	doc.Width, doc.Height = labelWidth, labelHeight
+
+	var p = doc.AddPage()
+	var textWidth = labelWidth - 2*labelMargin
+	var y float64 = labelMargin + 11
+
+	var client = strings.TrimSpace(l.Client.FirstName + " " + l.Client.LastName)
+	p.Text(labelMargin, y, pdf.HelveticaBold, 11, pdf.Black, fit(client, pdf.HelveticaBold, 11, textWidth))
+	y += 12
+
+	var desc = fmt.Sprintf("%v, %d %v", strings.ToLower(l.Good.Type), l.Good.Amount, strings.ToLower(l.Good.Unit))
+
+	if l.Job.Placement != "" {
+		desc += " - " + l.Job.Placement
+	}
+
+	p.Text(labelMargin, y, pdf.Helvetica, 8, pdf.Black, fit(desc, pdf.Helvetica, 8, textWidth))
+	y += 10
+	p.Text(labelMargin, y, pdf.Helvetica, 7, darkGray, "Job "+l.Job.JobID)
+	y += 6
+
+	bars, err := barcode.Code128(l.Good.GoodID)
+
+	if err != nil {
+		return err
+	}
+
+	var height = labelHeight - labelMargin - 10 - y
+	drawBarcode(p, bars, 0, y, labelWidth, height)
+	p.Text(labelMargin, labelHeight-labelMargin, pdf.Helvetica, 7, pdf.Black, l.Good.GoodID)
+
+	return doc.Write(w)
+}
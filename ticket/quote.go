@@ -0,0 +1,169 @@
+package ticket
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/henvic/embroidery/asset"
+	"github.com/henvic/embroidery/clients"
+	"github.com/henvic/embroidery/pdf"
+	"github.com/henvic/embroidery/quotes"
+)
+
+// QuoteDocument is the printable quote sent to a client
+type QuoteDocument struct {
+	Quote  quotes.Quote
+	Client clients.Client
+	Assets map[string]asset.Asset
+}
+
+// LoadQuote document
+// sql.ErrNoRows is returned if the quote doesn't exist.
+func LoadQuote(ctx context.Context, quoteID string) (d QuoteDocument, err error) {
+	if d.Quote, err = quotes.Get(ctx, quoteID); err != nil {
+		return d, err
+	}
+
+	if d.Client, err = clients.Get(ctx, d.Quote.ClientID); err != nil {
+		return d, err
+	}
+
+	d.Assets = map[string]asset.Asset{}
+
+	for _, i := range d.Quote.Items {
+		if i.AssetID == nil {
+			continue
+		}
+
+		a, err := asset.Get(ctx, d.Quote.ClientID, *i.AssetID)
+
+		switch err {
+		case nil:
+			d.Assets[a.AssetID] = a
+		case sql.ErrNoRows:
+		default:
+			return d, err
+		}
+	}
+
+	return d, nil
+}
+
+// money formats cents as Brazilian reais
+func money(cents int64) string {
+	var sign string
+
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+
+	var units = strconv.FormatInt(cents/100, 10)
+	var groups []string
+
+	for len(units) > 3 {
+		groups = append([]string{units[len(units)-3:]}, groups...)
+		units = units[:len(units)-3]
+	}
+
+	groups = append([]string{units}, groups...)
+	return fmt.Sprintf("%vR$ %v,%02d", sign, strings.Join(groups, "."), cents%100)
+}
+
+// wrap a text in lines that fit on the width, breaking it between words
+func wrap(text string, f pdf.Font, size, width float64) (lines []string) {
+	var line string
+
+	for _, word := range strings.Fields(text) {
+		if line != "" && pdf.TextWidth(line+" "+word, f, size) > width {
+			lines = append(lines, line)
+			line = ""
+		}
+
+		if line != "" {
+			line += " "
+		}
+
+		line += word
+	}
+
+	return append(lines, line)
+}
+
+// Write the quote as a PDF document
+func (d QuoteDocument) Write(w io.Writer) error {
+	var tw = &writer{doc: pdf.New()}
+	tw.newPage()
+
+	tw.y += 18
+	tw.page.Text(margin, tw.y, pdf.HelveticaBold, 18, pdf.Black, "Orçamento")
+	tw.y += lineHeight + 4
+	tw.page.Text(margin, tw.y, pdf.Helvetica, fontSize, darkGray, d.Quote.QuoteID)
+	tw.y += lineHeight * 2
+
+	var details = [][2]string{
+		{"Client", strings.TrimSpace(d.Client.FirstName + " " + d.Client.LastName)},
+		{"E-mail", d.Client.Email},
+		{"Date", strings.SplitN(d.Quote.CreatedTime, " ", 2)[0]},
+		{"Valid until", d.Quote.ExpiryDate},
+	}
+
+	for _, detail := range details {
+		tw.detail(detail[0], detail[1])
+	}
+
+	tw.heading("Items")
+
+	var xs = []float64{margin, margin + 24, margin + 250, margin + 320, margin + 410}
+	tw.row(pdf.HelveticaBold, xs, "#", "Description", "Quantity", "Unit price", "Price")
+
+	for _, i := range d.Quote.Items {
+		var description = i.Description
+
+		if i.Placement != "" {
+			description += " (" + i.Placement + ")"
+		}
+
+		var unit = "-"
+
+		if i.Amount != 0 {
+			unit = money(i.Price / int64(i.Amount))
+		}
+
+		tw.row(pdf.Helvetica, xs, strconv.Itoa(i.Position), description, strconv.Itoa(i.Amount), unit, money(i.Price))
+
+		if i.AssetID != nil {
+			if a, ok := d.Assets[*i.AssetID]; ok {
+				tw.space(lineHeight)
+				tw.page.Text(xs[1], tw.y-3, pdf.Helvetica, fontSize-2, darkGray,
+					fit("Design: "+a.OriginalFilepath, pdf.Helvetica, fontSize-2, xs[2]-xs[1]-6))
+				tw.y += lineHeight - 3
+			}
+		}
+	}
+
+	tw.space(lineHeight * 2)
+	tw.page.Line(xs[3], tw.y-lineHeight+4, tw.doc.Width-margin, tw.y-lineHeight+4, 0.5, darkGray)
+	tw.y += 4
+	tw.row(pdf.HelveticaBold, xs, "", "", "", "Total", money(d.Quote.Total()))
+
+	if d.Quote.Notes != "" {
+		tw.heading("Notes")
+
+		for _, paragraph := range strings.Split(d.Quote.Notes, "\n") {
+			for _, line := range wrap(strings.TrimRight(paragraph, "\r"), pdf.Helvetica, fontSize, tw.doc.Width-2*margin) {
+				tw.row(pdf.Helvetica, []float64{margin}, line)
+			}
+		}
+	}
+
+	tw.y += lineHeight
+	tw.space(lineHeight)
+	tw.page.Text(margin, tw.y, pdf.Helvetica, fontSize-1, darkGray,
+		"Prices are valid until "+d.Quote.ExpiryDate+" and are kept on the order when the quote is accepted.")
+
+	return tw.doc.Write(w)
+}
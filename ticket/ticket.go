@@ -0,0 +1,448 @@
+// Package ticket prints the job tickets operators follow at the machines, the
+// labels of the goods and the documents sent to clients.
+package ticket
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/henvic/embroidery/asset"
+	"github.com/henvic/embroidery/barcode"
+	"github.com/henvic/embroidery/clients"
+	"github.com/henvic/embroidery/jobs"
+	"github.com/henvic/embroidery/machines"
+	"github.com/henvic/embroidery/orders"
+	"github.com/henvic/embroidery/pdf"
+	"github.com/henvic/embroidery/personalization"
+	"github.com/henvic/embroidery/preview"
+	"github.com/henvic/embroidery/qr"
+	"github.com/henvic/embroidery/stitch"
+)
+
+// Ticket of a job with everything printed on it
+// Design and Pattern are nil when the asset isn't a stitch file.
+type Ticket struct {
+	Job     jobs.Job
+	Order   orders.Order
+	Client  clients.Client
+	Machine machines.Machine
+	Asset   asset.Asset
+	Design  *asset.Design
+	Pattern *stitch.Pattern
+	Lines   []jobs.Line
+	Names   []personalization.Name
+}
+
+// Stop of the machine to sew a color block
+type Stop struct {
+	Number   int
+	Thread   asset.Thread
+	Stitches int
+}
+
+// Load the ticket of a job
+// sql.ErrNoRows is returned if the job doesn't exist.
+func Load(ctx context.Context, jobID string) (t Ticket, err error) {
+	if t.Job, err = jobs.Get(ctx, jobID); err != nil {
+		return t, err
+	}
+
+	if t.Order, err = orders.Get(ctx, t.Job.OrderID); err != nil {
+		return t, err
+	}
+
+	if t.Client, err = clients.Get(ctx, t.Job.ClientID); err != nil {
+		return t, err
+	}
+
+	if t.Machine, err = machines.Get(ctx, t.Job.MachineID); err != nil {
+		return t, err
+	}
+
+	if t.Asset, err = asset.Get(ctx, t.Client.ClientID, t.Job.AssetID); err != nil {
+		return t, err
+	}
+
+	if t.Lines, err = jobs.ListLines(ctx, jobID); err != nil {
+		return t, err
+	}
+
+	if t.Names, err = personalization.ListNames(ctx, jobID); err != nil {
+		return t, err
+	}
+
+	if !t.Asset.IsDesign() {
+		return t, nil
+	}
+
+	d, err := asset.GetDesign(ctx, t.Asset.AssetID)
+
+	switch err {
+	case nil:
+		t.Design = &d
+	case sql.ErrNoRows:
+	default:
+		return t, err
+	}
+
+	t.Pattern, err = asset.ReadPattern(t.Asset)
+	return t, err
+}
+
+// Stops of the machine, in the sewing order
+func (t Ticket) Stops() (stops []Stop) {
+	var threads []asset.Thread
+
+	if t.Design != nil {
+		threads = t.Design.Threads
+	}
+
+	if t.Pattern == nil {
+		for i, th := range threads {
+			stops = append(stops, Stop{Number: i + 1, Thread: th})
+		}
+
+		return stops
+	}
+
+	var stop = Stop{Number: 1}
+
+	for _, st := range t.Pattern.Stitches {
+		switch st.Command {
+		case stitch.Normal:
+			stop.Stitches++
+		case stitch.ColorChange:
+			stops = append(stops, stop)
+			stop = Stop{Number: stop.Number + 1}
+		}
+	}
+
+	// designs ending with a color change don't use the last thread
+	if stop.Stitches != 0 || len(stops) == 0 {
+		stops = append(stops, stop)
+	}
+
+	for i := range stops {
+		if i < len(threads) {
+			stops[i].Thread = threads[i]
+		}
+	}
+
+	return stops
+}
+
+// layout of the A4 page, in points
+const (
+	margin     = 40
+	lineHeight = 14
+	fontSize   = 10
+	qrSize     = 96
+	previewPt  = 220
+	previewPx  = 660
+	swatchSize = 10
+
+	barcodeHeight = 36
+)
+
+var (
+	lightGray = pdf.Color{R: 220, G: 220, B: 220}
+	darkGray  = pdf.Color{R: 90, G: 90, B: 90}
+)
+
+// writer keeps the position of the next line of the ticket
+type writer struct {
+	doc  *pdf.Document
+	page *pdf.Page
+	y    float64
+}
+
+func (w *writer) newPage() {
+	w.page = w.doc.AddPage()
+	w.y = margin
+}
+
+// space makes sure there is room for the given height, adding a page if not
+func (w *writer) space(height float64) {
+	if w.y+height > w.doc.Height-margin {
+		w.newPage()
+	}
+}
+
+func (w *writer) heading(text string) {
+	w.space(lineHeight * 3)
+	w.y += lineHeight * 1.5
+	w.page.Text(margin, w.y, pdf.HelveticaBold, 13, pdf.Black, text)
+	w.y += 6
+	w.page.Line(margin, w.y, w.doc.Width-margin, w.y, 0.5, darkGray)
+	w.y += lineHeight
+}
+
+// detail with its label, kept clear of the QR code on the top of the page
+func (w *writer) detail(label, value string) {
+	const valueX = margin + 110
+	var right = w.doc.Width - margin
+
+	if w.y < margin+qrSize+lineHeight {
+		right -= qrSize + lineHeight
+	}
+
+	w.space(lineHeight)
+	w.page.Text(margin, w.y, pdf.HelveticaBold, fontSize, pdf.Black, label)
+	w.page.Text(valueX, w.y, pdf.Helvetica, fontSize, pdf.Black, fit(value, pdf.Helvetica, fontSize, right-valueX))
+	w.y += lineHeight
+}
+
+// row of a table, with the x positions of the columns and their texts
+func (w *writer) row(font pdf.Font, xs []float64, texts ...string) {
+	w.space(lineHeight)
+
+	for i, text := range texts {
+		var width = w.doc.Width - margin - xs[i]
+
+		if i+1 < len(xs) {
+			width = xs[i+1] - xs[i] - 6
+		}
+
+		w.page.Text(xs[i], w.y, font, fontSize, pdf.Black, fit(text, font, fontSize, width))
+	}
+
+	w.y += lineHeight
+}
+
+// fit a text on the width, cutting it with an ellipsis
+func fit(text string, f pdf.Font, size, width float64) string {
+	if pdf.TextWidth(text, f, size) <= width {
+		return text
+	}
+
+	var r = []rune(text)
+
+	for len(r) != 0 && pdf.TextWidth(string(r)+"…", f, size) > width {
+		r = r[:len(r)-1]
+	}
+
+	return string(r) + "…"
+}
+
+func duration(seconds *int64) string {
+	if seconds == nil {
+		return "-"
+	}
+
+	return (time.Duration(*seconds) * time.Second).String()
+}
+
+func orEmpty(s *string) string {
+	if s == nil {
+		return "-"
+	}
+
+	return *s
+}
+
+// Write the ticket as a PDF document
+func (t Ticket) Write(w io.Writer) error {
+	var tw = &writer{doc: pdf.New()}
+	tw.newPage()
+
+	code, err := qr.Encode(t.Job.JobID, qr.M)
+
+	if err != nil {
+		return err
+	}
+
+	drawQR(tw.page, code, tw.doc.Width-margin-qrSize, margin)
+
+	tw.y += 18
+	tw.page.Text(margin, tw.y, pdf.HelveticaBold, 18, pdf.Black, "Job ticket")
+	tw.y += lineHeight + 4
+	tw.page.Text(margin, tw.y, pdf.Helvetica, fontSize, darkGray, t.Job.JobID)
+	tw.y += lineHeight * 2
+
+	var placement = t.Job.Placement
+
+	if placement == "" {
+		placement = "-"
+	}
+
+	var details = [][2]string{
+		{"Client", strings.TrimSpace(t.Client.FirstName + " " + t.Client.LastName)},
+		{"Order", t.Order.OrderID + " (" + t.Order.OpenTime + ")"},
+		{"Machine", fmt.Sprintf("%v, %v (%d heads, %d needles)", t.Machine.Name, t.Machine.Brand, t.Machine.Heads, t.Machine.Needles)},
+		{"Quantity", strconv.Itoa(t.Job.Amount)},
+		{"Placement", placement},
+		{"Due date", orEmpty(t.Job.DueDate)},
+		{"Priority", strconv.Itoa(t.Job.Priority)},
+		{"Design", t.Asset.OriginalFilepath},
+	}
+
+	if t.Design != nil {
+		details = append(details,
+			[2]string{"Size", fmt.Sprintf("%.1f x %.1f mm", t.Design.Width(), t.Design.Height())},
+			[2]string{"Stitches", fmt.Sprintf("%d (%d color changes, %d trims)",
+				t.Design.StitchCount, t.Design.ColorChanges, t.Design.Trims)})
+	}
+
+	details = append(details,
+		[2]string{"Time per piece", duration(t.Job.EstimatedPieceSeconds)},
+		[2]string{"Estimated run time", duration(t.Job.EstimatedTotalSeconds)})
+
+	for _, d := range details {
+		tw.detail(d[0], d[1])
+	}
+
+	bars, err := barcode.Code128(t.Job.JobID)
+
+	if err != nil {
+		return err
+	}
+
+	tw.y += lineHeight / 2
+	drawBarcode(tw.page, bars, margin, tw.y, tw.doc.Width-2*margin, barcodeHeight)
+	tw.y += barcodeHeight + lineHeight/2
+
+	if t.Pattern != nil {
+		tw.space(previewPt + lineHeight)
+		tw.y += lineHeight / 2
+
+		if err := tw.page.Image(preview.Image(t.Pattern, previewPx), margin, tw.y, previewPt, previewPt); err != nil {
+			return err
+		}
+
+		tw.page.StrokeRect(margin, tw.y, previewPt, previewPt, 0.5, lightGray)
+		tw.y += previewPt
+	}
+
+	t.writeStops(tw)
+	t.writeLines(tw)
+	t.writeNames(tw)
+
+	return tw.doc.Write(w)
+}
+
+func (t Ticket) writeStops(tw *writer) {
+	var stops = t.Stops()
+
+	if len(stops) == 0 {
+		return
+	}
+
+	tw.heading("Color sequence")
+
+	var xs = []float64{margin, margin + 30, margin + 50, margin + 260, margin + 360}
+	tw.row(pdf.HelveticaBold, xs, "Stop", "", "Thread", "Code", "Stitches")
+
+	for _, s := range stops {
+		var name = s.Thread.Name
+
+		if name == "" {
+			name = s.Thread.Color
+		}
+
+		var stitches = "-"
+
+		if t.Pattern != nil {
+			stitches = strconv.Itoa(s.Stitches)
+		}
+
+		tw.space(lineHeight)
+
+		if c, ok := parseColor(s.Thread.Color); ok {
+			tw.page.Rect(xs[1], tw.y-swatchSize+1, swatchSize, swatchSize, c)
+			tw.page.StrokeRect(xs[1], tw.y-swatchSize+1, swatchSize, swatchSize, 0.5, darkGray)
+		}
+
+		tw.row(pdf.Helvetica, xs, strconv.Itoa(s.Number), "", name, s.Thread.Code, stitches)
+	}
+}
+
+func (t Ticket) writeLines(tw *writer) {
+	if len(t.Lines) == 0 {
+		return
+	}
+
+	tw.heading("Garments")
+
+	var xs = []float64{margin, margin + 200, margin + 280, margin + 420}
+	tw.row(pdf.HelveticaBold, xs, "Garment", "Size", "Color", "Quantity")
+
+	for _, l := range t.Lines {
+		tw.row(pdf.Helvetica, xs, l.GarmentType, l.Size, l.Color, strconv.Itoa(l.Quantity))
+	}
+}
+
+func (t Ticket) writeNames(tw *writer) {
+	if len(t.Names) == 0 {
+		return
+	}
+
+	tw.heading("Names")
+
+	var xs = []float64{margin, margin + 40, margin + 260}
+	tw.row(pdf.HelveticaBold, xs, "Piece", "Name", "Description")
+
+	for _, n := range t.Names {
+		tw.row(pdf.Helvetica, xs, strconv.Itoa(n.Position), n.Name, n.Piece)
+	}
+}
+
+// drawQR with its top left corner at x, y, joining the dark modules of each
+// row to keep the document small
+func drawQR(p *pdf.Page, code *qr.Code, x, y float64) {
+	var module = qrSize / float64(code.Size)
+
+	for row := 0; row < code.Size; row++ {
+		for col := 0; col < code.Size; col++ {
+			if !code.Dark(col, row) {
+				continue
+			}
+
+			var start = col
+
+			for col+1 < code.Size && code.Dark(col+1, row) {
+				col++
+			}
+
+			p.Rect(x+float64(start)*module, y+float64(row)*module, float64(col-start+1)*module, module, pdf.Black)
+		}
+	}
+}
+
+// drawBarcode with its top left corner at x, y, fitting the bars and the
+// quiet zones on the width
+func drawBarcode(p *pdf.Page, widths []int, x, y, width, height float64) {
+	var module = width / float64(barcode.Modules(widths)+2*barcode.QuietZone)
+	x += barcode.QuietZone * module
+
+	for i, w := range widths {
+		// bars are on the even indexes, spaces on the odd ones
+		if i%2 == 0 {
+			p.Rect(x, y, float64(w)*module, height, pdf.Black)
+		}
+
+		x += float64(w) * module
+	}
+}
+
+// parseColor of a thread, written as #rrggbb
+func parseColor(s string) (pdf.Color, bool) {
+	var c pdf.Color
+
+	if len(s) != 7 || s[0] != '#' {
+		return c, false
+	}
+
+	v, err := strconv.ParseUint(s[1:], 16, 32)
+
+	if err != nil {
+		return c, false
+	}
+
+	c.R, c.G, c.B = uint8(v>>16), uint8(v>>8), uint8(v)
+	return c, true
+}